@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"nftmintalert/opensea"
+)
+
+const defaultOpenSeaEventPages = 4
+
+// EventActivity is what OpenSea's events show of a contract over the time
+// window: the mints and sales it saw and the prices paid.
+type EventActivity struct {
+	// Mints are the tokens minted and Minters the wallets minted to
+	Mints   int `json:"mints"`
+	Minters int `json:"minters"`
+	// PricedMints are the mints sold through OpenSea and MintValue the
+	// amount paid for them
+	PricedMints int     `json:"priced_mints,omitempty"`
+	MintValue   float64 `json:"mint_value,omitempty"`
+	// Sales are the tokens sold after the mint and SaleValue their volume
+	Sales     int     `json:"sales"`
+	SaleValue float64 `json:"sale_value,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+	// Partial is set when there were more events than OPENSEA_EVENT_PAGES
+	// pages
+	Partial bool `json:"partial,omitempty"`
+}
+
+// eventReader reads the OpenSea events of the alerted collections, see
+// OPENSEA_EVENTS.
+type eventReader struct {
+	// pages is the most pages of events read for a collection
+	pages int
+}
+
+// newEventReader returns the event reader, or nil if OPENSEA_EVENTS is off.
+func newEventReader() *eventReader {
+	if !envBool("OPENSEA_EVENTS") {
+		return nil
+	}
+	pages := envInt("OPENSEA_EVENT_PAGES", defaultOpenSeaEventPages)
+	if pages < 1 {
+		pages = 1
+	}
+	return &eventReader{pages: pages}
+}
+
+// activity reads the contract's mints and sales on the chain over the time
+// window from the collection's events, a page at a time from the newest.
+func (a *alerter) activity(ctx context.Context, chain Chain, slug string, contract string) (*EventActivity, error) {
+	query := opensea.EventsQuery{
+		EventTypes: []string{opensea.EventTypeSale, opensea.EventTypeTransfer},
+		After:      time.Now().Add(-time.Duration(a.minutes) * time.Minute),
+		Limit:      opensea.MaxEventsPage,
+	}
+	activity := &EventActivity{}
+	minters := make(map[string]bool)
+	for page := 0; page < a.events.pages; page++ {
+		reqCtx, calls := countRequests(ctx)
+		events, err := a.osclient.Events(reqCtx, slug, query)
+		a.summary.Usage.OpenSea += calls()
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events.AssetEvents {
+			// a collection can span contracts and chains
+			if event.NFT == nil || !strings.EqualFold(event.NFT.Contract, contract) || event.Chain != chain.OpenSea {
+				continue
+			}
+			quantity := event.Quantity
+			if quantity < 1 {
+				quantity = 1
+			}
+			if event.IsMint() {
+				activity.Mints += quantity
+				minters[strings.ToLower(event.Recipient())] = true
+				if event.Payment != nil {
+					activity.PricedMints += quantity
+					activity.MintValue += event.Payment.Amount()
+					activity.Currency = event.Payment.Symbol
+				}
+				continue
+			}
+			if event.EventType == opensea.EventTypeSale && event.Payment != nil {
+				activity.Sales += quantity
+				activity.SaleValue += event.Payment.Amount()
+				activity.Currency = event.Payment.Symbol
+			}
+		}
+		if events.Next == "" {
+			activity.Minters = len(minters)
+			return activity, nil
+		}
+		query.Next = events.Next
+	}
+	activity.Minters = len(minters)
+	activity.Partial = true
+	return activity, nil
+}
+
+// addActivity adds the OpenSea events to the alert when OPENSEA_EVENTS is
+// on. The mint count is cross-checked with the chain's, and the prices and
+// minters fill in what the chain didn't give.
+func (a *alerter) addActivity(ctx context.Context, chain Chain, alert *Alert) {
+	slug := alert.Collection.Collection.Slug
+	if a.events == nil || slug == "" || !a.enrich() {
+		return
+	}
+	activity, err := a.activity(ctx, chain, slug, alert.Contract)
+	if err != nil {
+		// post without the activity
+		a.summary.OpenSeaErrors++
+		a.summary.addError("Opensea API error on events for %v: %v", slug, err)
+		return
+	}
+	alert.Activity = activity
+	switch alert.Kind {
+	case "":
+		if !activity.Partial && activity.Mints != alert.Count {
+			// OpenSea indexes the mints a little behind the chain
+			slog.Info("OpenSea mint count differs from the chain", "chain", chain.Name, "contract", alert.Contract, "count", alert.Count, "opensea", activity.Mints)
+		}
+		if alert.Price == nil && activity.PricedMints > 0 {
+			average := activity.MintValue / float64(activity.PricedMints)
+			alert.Price = &MintStatus{
+				Count:    alert.Count,
+				Value:    average * float64(alert.Count),
+				Currency: activity.Currency,
+				Sampled:  activity.PricedMints < alert.Count,
+			}
+		}
+		if alert.Minters == nil && activity.Minters > 0 {
+			alert.Minters = &MinterStats{Unique: activity.Minters}
+		}
+	case alertKindSales:
+		if alert.Price == nil && activity.Sales > 0 {
+			alert.Price = &MintStatus{
+				Count:    activity.Sales,
+				Value:    activity.SaleValue,
+				Currency: activity.Currency,
+				Sampled:  activity.Partial,
+			}
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// daemonRuns tracks the daemon's scans for /healthz and /status.
+var daemonRuns = &runTracker{started: time.Now()}
+
+// runTracker holds the times and outcome of the last scan.
+type runTracker struct {
+	mu       sync.Mutex
+	started  time.Time
+	interval time.Duration
+	running  bool
+	lastRun  time.Time
+	last     *RunSummary
+}
+
+func (t *runTracker) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = true
+}
+
+func (t *runTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = false
+	t.lastRun = time.Now()
+}
+
+// finished keeps the summary of the run, called as the run is reported.
+func (t *runTracker) finished(summary *RunSummary) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = summary
+}
+
+// healthy reports whether a scan finished within two intervals, so a daemon
+// whose runs hang is restarted.
+func (t *runTracker) healthy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	since := t.started
+	if !t.lastRun.IsZero() {
+		since = t.lastRun
+	}
+	return t.interval <= 0 || time.Since(since) < 2*t.interval
+}
+
+// adminServer is the HTTP server of daemon and subscribe mode on ADMIN_ADDR:
+// /healthz and /status for monitoring, and with ADMIN_TOKEN set the admin
+// endpoints to edit the blocklist and trigger a scan.
+type adminServer struct {
+	token string
+	// scans requests a scan from the daemon loop
+	scans chan struct{}
+}
+
+// serveAdmin serves the admin API on ADMIN_ADDR, e.g. ":8080", if it is set.
+// The metrics are served on it too when METRICS_ADDR is the same address.
+func serveAdmin(scans chan struct{}) {
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" {
+		return
+	}
+	s := &adminServer{token: os.Getenv("ADMIN_TOKEN"), scans: scans}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/status", s.status)
+	mux.HandleFunc("/admin/blocklist", s.admin(s.blocklist))
+	mux.HandleFunc("/admin/scan", s.admin(s.scan))
+	if os.Getenv("METRICS_ADDR") == addr {
+		mux.Handle("/metrics", promMetrics)
+	}
+	if s.token == "" {
+		slog.Warn("ADMIN_TOKEN is not set, the admin endpoints are disabled")
+	}
+	slog.Info("Serving the admin API", "addr", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Admin server stopped", "error", err)
+		}
+	}()
+}
+
+func writeJSONResponse(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, format string, v ...interface{}) {
+	writeJSONResponse(w, code, map[string]string{"error": fmt.Sprintf(format, v...)})
+}
+
+func (s *adminServer) healthz(w http.ResponseWriter, r *http.Request) {
+	if !daemonRuns.healthy() {
+		http.Error(w, "no scan finished in two intervals", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// adminStatus is the /status response.
+type adminStatus struct {
+	Version string `json:"version"`
+	Running bool   `json:"running"`
+	// LastRun is when the last scan finished and NextRun when the next is
+	// due
+	LastRun *time.Time `json:"last_run,omitempty"`
+	NextRun *time.Time `json:"next_run,omitempty"`
+	// the outcome of the last scan
+	LastAlerts int      `json:"last_alerts"`
+	LastFailed bool     `json:"last_failed"`
+	LastErrors []string `json:"last_errors,omitempty"`
+	// Checkpoints is the last block scanned on each chain
+	Checkpoints map[string]uint64 `json:"checkpoints"`
+	LastAlert   *time.Time        `json:"last_alert,omitempty"`
+	// QueueDepth is the number of deliveries waiting to be retried
+	QueueDepth    int `json:"queue_depth"`
+	Continuations int `json:"continuations"`
+}
+
+// status reports the daemon's last scan and the saved status.
+func (s *adminServer) status(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "unable to create a new session: %v", err)
+		return
+	}
+	store, err := newStateStore(sess, os.Getenv("S3_BUCKET"), os.Getenv("S3_FILE_KEY"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	status := store.load()
+	response := adminStatus{
+		Version:       buildInfo(),
+		Checkpoints:   status.Checkpoints,
+		QueueDepth:    len(status.Pending),
+		Continuations: len(status.Continuations),
+	}
+	if !status.LastAlert.IsZero() {
+		response.LastAlert = &status.LastAlert
+	}
+
+	daemonRuns.mu.Lock()
+	response.Running = daemonRuns.running
+	if !daemonRuns.lastRun.IsZero() {
+		lastRun := daemonRuns.lastRun
+		nextRun := lastRun.Add(daemonRuns.interval)
+		response.LastRun = &lastRun
+		response.NextRun = &nextRun
+	}
+	if last := daemonRuns.last; last != nil {
+		response.LastAlerts = last.Alerts
+		response.LastFailed = last.Failed
+		response.LastErrors = last.Errors
+	}
+	daemonRuns.mu.Unlock()
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// admin wraps an admin endpoint with the ADMIN_TOKEN bearer token check.
+func (s *adminServer) admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token == "" {
+			writeError(w, http.StatusNotFound, "the admin endpoints are disabled, set ADMIN_TOKEN")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// blocklist lists the blocked contracts on GET, adds the ?address= contract
+// on POST and removes it on DELETE. The changes are written to
+// BLOCKLIST_FILE and apply from the next scan.
+func (s *adminServer) blocklist(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		list, err := loadContractList("BLOCKLIST")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		addresses := []string{}
+		for address := range list {
+			addresses = append(addresses, address.Hex())
+		}
+		writeJSONResponse(w, http.StatusOK, map[string][]string{"blocklist": addresses})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "use GET, POST or DELETE")
+		return
+	}
+	value := r.URL.Query().Get("address")
+	if !common.IsHexAddress(value) {
+		writeError(w, http.StatusBadRequest, "invalid address %q", value)
+		return
+	}
+	address := common.HexToAddress(value)
+	file := os.Getenv("BLOCKLIST_FILE")
+	if file == "" {
+		writeError(w, http.StatusConflict, "BLOCKLIST_FILE must be set to edit the blocklist")
+		return
+	}
+	var err error
+	if r.Method == http.MethodPost {
+		err = editBlocklist(file, address, true)
+	} else {
+		if fixed, _ := parseAddresses(os.Getenv("BLOCKLIST")); containsAddress(fixed, address) {
+			writeError(w, http.StatusConflict, "%v is in BLOCKLIST and can only be removed there", address.Hex())
+			return
+		}
+		err = editBlocklist(file, address, false)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	slog.Info("Blocklist edited", "method", r.Method, "contract", address.Hex())
+	writeJSONResponse(w, http.StatusOK, map[string]string{"address": address.Hex()})
+}
+
+// blocklistMu keeps the blocklist edits from overwriting each other.
+var blocklistMu sync.Mutex
+
+// editBlocklist adds the address to the blocklist file or removes its lines,
+// keeping the rest of the file and its comments.
+func editBlocklist(file string, address common.Address, block bool) error {
+	blocklistMu.Lock()
+	defer blocklistMu.Unlock()
+	buf, err := readConfigFile(file)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		err = nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	found := false
+	for _, line := range strings.Split(strings.TrimRight(string(buf), "\n"), "\n") {
+		entry := line
+		if i := strings.Index(entry, "#"); i >= 0 {
+			entry = entry[:i]
+		}
+		if listed, _ := parseAddresses(entry); containsAddress(listed, address) {
+			found = true
+			if !block {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	if block && !found {
+		lines = append(lines, fmt.Sprintf("%v # added %v", address.Hex(), time.Now().UTC().Format(time.RFC3339)))
+	}
+	return writeConfigFile(file, []byte(strings.TrimLeft(strings.Join(lines, "\n"), "\n")+"\n"))
+}
+
+// scan asks the daemon for a scan now rather than at the next interval. A
+// scan asked for while one is running starts when it finishes.
+func (s *adminServer) scan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if s.scans == nil {
+		writeError(w, http.StatusNotFound, "scans can only be triggered in daemon mode")
+		return
+	}
+	select {
+	case s.scans <- struct{}{}:
+	default:
+		// one is already waiting
+	}
+	writeJSONResponse(w, http.StatusAccepted, map[string]string{"scan": "queued"})
+}
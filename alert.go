@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nftmintalert/opensea"
+)
+
+// collectionSource looks up the OpenSea details for a contract.
+type collectionSource interface {
+	ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error)
+	Stats(ctx context.Context, slug string) (*opensea.Stats, error)
+	Events(ctx context.Context, slug string, query opensea.EventsQuery) (*opensea.Events, error)
+}
+
+const (
+	defaultOpenSeaRequestsPerSecond = 2.0
+	defaultOpenSeaMaxRetries        = 3
+	defaultOpenSeaConcurrency       = 4
+	defaultOpenSeaTimeoutSeconds    = 30
+)
+
+// newOpenSeaClient returns a client for the OpenSea API, rate limited to
+// OPENSEA_REQUESTS_PER_SECOND and retrying OPENSEA_MAX_RETRIES times.
+func newOpenSeaClient(key string) *opensea.Client {
+	return &opensea.Client{
+		Client:            http.DefaultClient,
+		Host:              "https://api.opensea.io",
+		Authorizer:        key,
+		RequestsPerSecond: envFloat("OPENSEA_REQUESTS_PER_SECOND", defaultOpenSeaRequestsPerSecond),
+		MaxRetries:        envInt("OPENSEA_MAX_RETRIES", defaultOpenSeaMaxRetries),
+	}
+}
+
+// alerter looks up the details of the collections that are minting and
+// posts the alerts.
+type alerter struct {
+	osclient collectionSource
+	targets  *notifiers
+	summary  *RunSummary
+	budget   timeBudget
+	// preview logs the alerts instead of posting them, see DRY_RUN
+	preview bool
+	canary  canaryConfig
+	cache   *metadataCache
+	// tiers are the alert levels from the highest threshold down
+	tiers []alertTier
+	// minutes is the time the mint counts cover
+	minutes int
+	// prices reads the amount spent on the mints. Nil skips the prices.
+	prices priceSource
+	// deployments finds the stealth mints. Nil turns them off.
+	deployments deploymentSource
+	// names finds the notable minters. Nil skips them.
+	names nameSource
+	// tokens limits the token standards, supply and age of the collections
+	// and supplies reads the supply the metadata lacks. Nil skips reading.
+	tokens   tokenFilter
+	supplies supplySource
+	// events reads the collections' OpenSea events. Nil skips them.
+	events *eventReader
+	// scorer rates the contracts for the tiers, see SCORING. Nil uses the
+	// mint count. scores, previous and spent are the scores, previous
+	// window counts and amounts spent of the chain being posted.
+	scorer   scorer
+	scores   map[string]int
+	previous map[string]int
+	spent    map[string]*MintStatus
+	// cooldown is how long a collection is not alerted again after a post
+	cooldown time.Duration
+	filter   statsFilter
+	safelist safelistFilter
+	lists    contractLists
+	// concurrency is how many OpenSea lookups run at once and
+	// requestTimeout limits each request
+	concurrency    int
+	requestTimeout time.Duration
+	// minters are the wallets each contract minted to on the chain being
+	// posted. Nil skips the minter filter.
+	minters      map[string]*MinterStats
+	minterFilter minterFilter
+}
+
+// lookup returns the collection details and stats for the contract and
+// whether it meets the call out criteria, using the metadata cache while it
+// is fresh. The OpenSea requests are made now unless prefetch already made
+// them.
+func (a *alerter) lookup(ctx context.Context, chain Chain, contract string, count int, prefetched map[string]*fetched) (*opensea.OpenSeaCollection, *opensea.Stats, bool, error) {
+	key := recentKey(chain.Name, contract)
+	if entry := a.cache.get(key); entry != nil {
+		slog.Debug("Metadata cache hit", "contract", key, "call_out", entry.CallOut)
+		return entry.Collection, entry.Stats, entry.CallOut, nil
+	}
+	result, ok := prefetched[contract]
+	if !ok {
+		result = a.fetch(ctx, chain, contract, count)
+	}
+	a.summary.Usage.OpenSea += result.calls
+	if result.err != nil {
+		return nil, nil, false, result.err
+	}
+	if result.statsErr != nil {
+		a.summary.OpenSeaErrors++
+		a.summary.addError("Opensea API error on stats for %v: %v", result.collection.Collection.Slug, result.statsErr)
+	}
+	callOut := result.callOut && a.filter.passes(contract, result.stats) && a.safelist.passes(contract, result.collection)
+	a.cache.put(key, result.collection, result.stats, callOut)
+	return result.collection, result.stats, callOut, nil
+}
+
+// fetched holds the OpenSea responses for a contract.
+type fetched struct {
+	collection *opensea.OpenSeaCollection
+	stats      *opensea.Stats
+	// callOut is the call out decision before the stats filters
+	callOut bool
+	// calls is the number of OpenSea requests made
+	calls    int
+	err      error
+	statsErr error
+}
+
+// fetch looks up the collection and, if it meets the call out criteria, its
+// stats. It only uses the OpenSea client so several can run at once.
+func (a *alerter) fetch(ctx context.Context, chain Chain, contract string, count int) *fetched {
+	result := &fetched{}
+	ctx, calls := countRequests(ctx)
+	defer func() { result.calls = calls() }()
+	reqCtx, cancel := a.requestContext(ctx)
+	result.collection, result.err = a.osclient.ChainAssetContract(reqCtx, chain.OpenSea, contract)
+	cancel()
+	if result.err != nil {
+		return result
+	}
+	result.callOut = callOut(result.collection, contract, count)
+	if !result.callOut || result.collection.Collection.Slug == "" || !a.enrich() {
+		return result
+	}
+	reqCtx, cancel = a.requestContext(ctx)
+	result.stats, result.statsErr = a.osclient.Stats(reqCtx, result.collection.Collection.Slug)
+	cancel()
+	return result
+}
+
+// countRequests returns a context that counts the OpenSea requests made
+// with it and a function returning the count so far.
+func countRequests(ctx context.Context) (context.Context, func() int) {
+	var count int64
+	return opensea.WithRequestCount(ctx, &count), func() int { return int(atomic.LoadInt64(&count)) }
+}
+
+// requestContext limits a single OpenSea request to OPENSEA_TIMEOUT_SECONDS.
+func (a *alerter) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.requestTimeout)
+}
+
+// prefetch looks up the contracts in the mint list that may be alerted, up
+// to OPENSEA_CONCURRENCY at a time, rather than one after the other while
+// posting. It returns the results by contract for lookup.
+func (a *alerter) prefetch(ctx context.Context, status *Status, chain Chain, mintlist PairList) map[string]*fetched {
+	results := make(map[string]*fetched)
+	if a.concurrency <= 1 {
+		return results
+	}
+	var todo PairList
+	for _, mint := range mintlist {
+		if a.tierFor(mint) == nil ||
+			status.recentlyPosted(recentKey(chain.Name, mint.Key), a.cooldown) ||
+			!a.mintersPass(mint.Key) ||
+			a.cache.get(recentKey(chain.Name, mint.Key)) != nil {
+			continue
+		}
+		todo = append(todo, mint)
+	}
+	if len(todo) < 2 {
+		return results
+	}
+	slog.Debug("Looking up collections", "chain", chain.Name, "collections", len(todo), "concurrency", a.concurrency)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, a.concurrency)
+	for _, mint := range todo {
+		if a.budget.low() {
+			// post will defer the rest
+			break
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(mint Pair) {
+			defer wg.Done()
+			result := a.fetch(ctx, chain, mint.Key, mint.Value)
+			<-slots
+			mu.Lock()
+			results[mint.Key] = result
+			mu.Unlock()
+		}(mint)
+	}
+	wg.Wait()
+	return results
+}
+
+// enrich reports whether there is time to add the mint prices, the ENS
+// names of the minters and the OpenSea events and stats to the alerts.
+func (a *alerter) enrich() bool {
+	if a.budget.short() {
+		slog.Debug("Time budget short, posting without enrichment", "remaining", a.budget.remaining().Round(time.Second))
+		return false
+	}
+	return true
+}
+
+// mintersPass reports whether the contract's minters meet the minter
+// filter. Allowed contracts always pass.
+func (a *alerter) mintersPass(contract string) bool {
+	return a.lists.allowed(contract) || a.minterFilter.passes(contract, a.minters[contract])
+}
+
+// send posts the alert to the notifiers, or logs it in preview mode.
+func (a *alerter) send(ctx context.Context, status *Status, alert Alert, persist func()) {
+	if !a.preview {
+		a.targets.notify(ctx, status, a.summary, alert, persist)
+		return
+	}
+	slog.Info("Preview alert", "chain", alert.Chain, "contract", alert.Contract, "count", alert.Count, "tier", alert.Tier, "name", alert.Collection.Name)
+	if a.targets != nil {
+		a.targets.preview(alert)
+	}
+}
+
+// post sends an alert for every collection in the mint list that crosses the
+// threshold and hasn't been posted recently. persist saves the status.
+func (a *alerter) post(ctx context.Context, status *Status, chain Chain, mintlist PairList, toBlock *big.Int, persist func()) {
+	prefetched := a.prefetch(ctx, status, chain, mintlist)
+	for index, mint := range mintlist {
+		slog.Debug("Mint count", "chain", chain.Name, "contract", mint.Key, "count", mint.Value)
+		recent := recentKey(chain.Name, mint.Key)
+		if tier := a.tierFor(mint); tier != nil {
+			// Check to see if we've already posted about this nft
+			if status.recentlyPosted(recent, a.cooldown) {
+				continue
+			}
+			if a.budget.low() {
+				// Save the rest for the next run rather than get killed mid-post
+				var deferred PairList
+				for _, next := range mintlist[index:] {
+					if a.tierFor(next) != nil {
+						deferred = append(deferred, next)
+					}
+				}
+				if status.Continuations == nil {
+					status.Continuations = make(map[string]*Continuation)
+				}
+				status.Continuations[chain.Name] = &Continuation{Block: toBlock.String(), Mints: deferred}
+				a.summary.addError("Time budget low (%v left), deferring %v %v collections to the next run", a.budget.remaining().Round(time.Second), len(deferred), chain.DisplayName)
+				break
+			}
+			if !a.mintersPass(mint.Key) {
+				continue
+			}
+			collection, stats, result, err := a.lookup(ctx, chain, mint.Key, mint.Value, prefetched)
+			stealth := false
+			if err != nil {
+				if a.deployments == nil || !notIndexed(err) {
+					// Skip this collection, the rest can still be posted.
+					a.summary.OpenSeaErrors++
+					a.summary.addError("Opensea API error on contract %v: %v", mint.Key, err)
+					continue
+				}
+				slog.Info("No collection yet, alerting as a stealth mint", "chain", chain.Name, "contract", mint.Key)
+				collection = a.stealthCollection(ctx, mint.Key)
+				stealth = true
+			} else if a.deployments != nil && a.isStealth(ctx, chain, mint.Key, toBlock) {
+				slog.Info("Contract deployed within the window, alerting as a stealth mint", "chain", chain.Name, "contract", mint.Key)
+				stealth = true
+			}
+			if !a.tokenPasses(ctx, mint.Key, collection) {
+				continue
+			}
+			// stealth mints rarely have links or stats yet
+			result = a.lists.callOut(mint.Key, result || stealth)
+			canary := a.canary.selects(mint.Key)
+			unverified := !result && a.targets != nil && a.targets.acceptsUnverified(canary)
+			if result || unverified {
+				slog.Info("Posting alert", "chain", chain.Name, "contract", mint.Key, "count", mint.Value, "slug", collection.Collection.Slug, "twitter", collection.Collection.TwitterUsername)
+				alert := Alert{
+					Key:        alertKey(chain.Name, mint.Key, toBlock.Uint64(), chain.BlockWindow),
+					Chain:      chain.Name,
+					Contract:   mint.Key,
+					Count:      mint.Value,
+					Collection: collection,
+					Stats:      stats,
+					Canary:     canary,
+					Unverified: unverified,
+					Tier:       tier.Name,
+					Headline:   tier.Headline,
+					Minutes:    a.minutes,
+					Minters:    a.notableMinters(ctx, a.minters[mint.Key]),
+					Stealth:    stealth,
+				}
+				if a.scorer != nil {
+					alert.Score = a.score(mint)
+					alert.Previous = a.previous[mint.Key]
+				}
+				if stealth {
+					alert.Headline = stealthHeadline()
+				}
+				a.safelist.label(&alert)
+				if price := a.spent[mint.Key]; price != nil {
+					// read for the score
+					alert.Price = price
+				} else if a.prices != nil && a.enrich() {
+					price, err := a.prices.mintValue(ctx, mint.Key, mint.Value)
+					if err != nil {
+						// post without the price
+						a.summary.addError("Unable to price the mints of %v: %v", mint.Key, err)
+					} else {
+						alert.Price = price
+					}
+				}
+				a.addActivity(ctx, chain, &alert)
+				if alert.Canary {
+					slog.Info("Canary alert, posting to the canary channels only", "contract", mint.Key)
+				}
+				a.send(ctx, status, alert, persist)
+				// Record the NFT project as posted
+				status.markPosted(recent)
+				status.LastAlert = time.Now()
+				a.summary.Alerts++
+			}
+		}
+	}
+}
+
+// countedAlert is an alert type other than the mint alerts, e.g. sales. The
+// collections counted past the threshold are posted with their own headline
+// and a cool-down apart from the mint alerts.
+type countedAlert struct {
+	kind      string
+	threshold int
+	headline  string
+}
+
+// postCounted sends an alert for every collection in the list with a count
+// over the threshold that hasn't had one of the same kind recently.
+func (a *alerter) postCounted(ctx context.Context, status *Status, chain Chain, counted countedAlert, list PairList, toBlock *big.Int, persist func()) {
+	prefix := counted.kind + ":"
+	for _, entry := range list {
+		if entry.Value <= counted.threshold {
+			// the list is ordered, the rest counted less
+			break
+		}
+		slog.Debug("Count", "kind", counted.kind, "chain", chain.Name, "contract", entry.Key, "count", entry.Value)
+		recent := prefix + recentKey(chain.Name, entry.Key)
+		if a.lists.blocked(entry.Key) || status.recentlyPosted(recent, a.cooldown) {
+			continue
+		}
+		if a.budget.low() {
+			a.summary.addError("Time budget low (%v left), skipping the %v %v alerts", a.budget.remaining().Round(time.Second), chain.DisplayName, counted.kind)
+			break
+		}
+		collection, stats, result, err := a.lookup(ctx, chain, entry.Key, entry.Value, nil)
+		if err != nil {
+			a.summary.OpenSeaErrors++
+			a.summary.addError("Opensea API error on contract %v: %v", entry.Key, err)
+			continue
+		}
+		if !a.tokenPasses(ctx, entry.Key, collection) || !a.lists.callOut(entry.Key, result) {
+			continue
+		}
+		slog.Info("Posting alert", "kind", counted.kind, "chain", chain.Name, "contract", entry.Key, "count", entry.Value, "slug", collection.Collection.Slug)
+		alert := Alert{
+			Key:        prefix + alertKey(chain.Name, entry.Key, toBlock.Uint64(), chain.BlockWindow),
+			Kind:       counted.kind,
+			Chain:      chain.Name,
+			Contract:   entry.Key,
+			Count:      entry.Value,
+			Collection: collection,
+			Stats:      stats,
+			Canary:     a.canary.selects(entry.Key),
+			Headline:   counted.headline,
+			Minutes:    a.minutes,
+		}
+		a.safelist.label(&alert)
+		a.addActivity(ctx, chain, &alert)
+		a.send(ctx, status, alert, persist)
+		status.markPosted(recent)
+		status.LastAlert = time.Now()
+		a.summary.Alerts++
+	}
+}
+
+// action is what the alert counts, e.g. "minted" or "sold".
+func (a Alert) action() string {
+	switch a.Kind {
+	case alertKindSales:
+		return "sold"
+	case alertKindBurn:
+		return "burned"
+	}
+	return "minted"
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	archiveBackendS3       = "s3"
+	archiveBackendDynamoDB = "dynamodb"
+
+	defaultArchivePrefix = "alerts/"
+	// archiveDay is the date format the archive is partitioned by
+	archiveDay     = "2006-01-02"
+	archiveTimeout = 30 * time.Second
+)
+
+// archiveRecord is the history of one alert: what was alerted and where it
+// was delivered. Alerts retried on a later run are recorded again with the
+// channels delivered by the retry.
+type archiveRecord struct {
+	Time       time.Time `json:"time"`
+	Key        string    `json:"key"`
+	Chain      string    `json:"chain"`
+	Kind       string    `json:"kind,omitempty"`
+	Contract   string    `json:"contract"`
+	Name       string    `json:"name"`
+	Slug       string    `json:"slug,omitempty"`
+	Count      int       `json:"count"`
+	Tier       string    `json:"tier,omitempty"`
+	Canary     bool      `json:"canary,omitempty"`
+	FloorPrice *float64  `json:"floor_price,omitempty"`
+	FloorToken string    `json:"floor_token,omitempty"`
+	Sent       []string  `json:"sent,omitempty"`
+	Failed     []string  `json:"failed,omitempty"`
+}
+
+func newArchiveRecord(alert Alert, sent []string, failed []string) archiveRecord {
+	record := archiveRecord{
+		Time:     time.Now().UTC(),
+		Key:      alert.Key,
+		Chain:    alert.Chain,
+		Kind:     alert.Kind,
+		Contract: alert.Contract,
+		Count:    alert.Count,
+		Tier:     alert.Tier,
+		Canary:   alert.Canary,
+		Sent:     sent,
+		Failed:   failed,
+	}
+	if record.Chain == "" {
+		record.Chain = chainEthereum
+	}
+	if alert.Collection != nil {
+		record.Name = alert.Collection.Name
+		record.Slug = alert.Collection.Collection.Slug
+	}
+	if alert.Stats != nil {
+		floor := alert.Stats.Total.FloorPrice
+		record.FloorPrice = &floor
+		record.FloorToken = alert.Stats.Total.FloorPriceSymbol
+	}
+	return record
+}
+
+// archive records the alert's deliveries for the alert archive.
+func (s *RunSummary) archive(alert Alert, sent []string, failed []string) {
+	if len(sent) == 0 && len(failed) == 0 {
+		return
+	}
+	s.Archive = append(s.Archive, newArchiveRecord(alert, sent, failed))
+}
+
+// alertArchive is the durable history of the alerts, kept when
+// ARCHIVE_BACKEND is set.
+type alertArchive interface {
+	write(ctx context.Context, records []archiveRecord) error
+	// read returns the records of the days from from to to, inclusive
+	read(ctx context.Context, from time.Time, to time.Time) ([]archiveRecord, error)
+}
+
+// newAlertArchive returns the archive selected by ARCHIVE_BACKEND, or nil
+// when the alerts are not archived.
+func newAlertArchive(sess *session.Session) (alertArchive, error) {
+	switch backend := os.Getenv("ARCHIVE_BACKEND"); backend {
+	case "":
+		return nil, nil
+	case archiveBackendS3:
+		bucket := os.Getenv("ARCHIVE_BUCKET")
+		if bucket == "" {
+			bucket = os.Getenv("S3_BUCKET")
+		}
+		if bucket == "" {
+			return nil, fmt.Errorf("archive bucket environment variable (ARCHIVE_BUCKET or S3_BUCKET) is not set")
+		}
+		prefix := os.Getenv("ARCHIVE_PREFIX")
+		if prefix == "" {
+			prefix = defaultArchivePrefix
+		}
+		return &s3Archive{svc: s3.New(sess), bucket: bucket, prefix: prefix}, nil
+	case archiveBackendDynamoDB:
+		table := os.Getenv("ARCHIVE_TABLE")
+		if table == "" {
+			table = os.Getenv("DYNAMODB_TABLE")
+		}
+		if table == "" {
+			return nil, fmt.Errorf("archive table environment variable (ARCHIVE_TABLE or DYNAMODB_TABLE) is not set")
+		}
+		retention := time.Duration(envInt("ARCHIVE_RETENTION_DAYS", 0)) * 24 * time.Hour
+		return &dynamoArchive{svc: dynamodb.New(sess), table: table, retention: retention}, nil
+	default:
+		return nil, fmt.Errorf("unknown ARCHIVE_BACKEND %q", backend)
+	}
+}
+
+// archiveRun writes the run's alerts to the archive. Failures are recorded
+// in the summary, the alerts have been posted either way.
+func archiveRun(summary *RunSummary) {
+	if len(summary.Archive) == 0 || os.Getenv("ARCHIVE_BACKEND") == "" {
+		return
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		summary.addError("Unable to archive alerts: %v", err)
+		return
+	}
+	archive, err := newAlertArchive(sess)
+	if err != nil {
+		summary.addError("Unable to archive alerts: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+	if err := archive.write(ctx, summary.Archive); err != nil {
+		summary.addError("Unable to archive alerts: %v", err)
+		return
+	}
+	summary.Archive = nil
+}
+
+// s3Archive keeps the alerts as JSON Lines in S3, one object per run under
+// a date=YYYY-MM-DD prefix so the archive can be queried with Athena.
+type s3Archive struct {
+	svc    *s3.S3
+	bucket string
+	prefix string
+}
+
+func (a *s3Archive) dayPrefix(day time.Time) string {
+	return a.prefix + "date=" + day.UTC().Format(archiveDay) + "/"
+}
+
+func (a *s3Archive) write(ctx context.Context, records []archiveRecord) error {
+	// a run can span midnight, each day gets its own object
+	days := make(map[string]*bytes.Buffer)
+	var order []string
+	for _, record := range records {
+		prefix := a.dayPrefix(record.Time)
+		buf, ok := days[prefix]
+		if !ok {
+			buf = &bytes.Buffer{}
+			days[prefix] = buf
+			order = append(order, prefix)
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	name := records[0].Time.Format("150405.000000000") + ".jsonl"
+	for _, prefix := range order {
+		_, err := a.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(a.bucket),
+			Key:         aws.String(prefix + name),
+			Body:        bytes.NewReader(days[prefix].Bytes()),
+			ContentType: aws.String("application/x-ndjson"),
+		})
+		if err != nil {
+			return fmt.Errorf("s3 put %v: %w", prefix+name, err)
+		}
+	}
+	return nil
+}
+
+func (a *s3Archive) read(ctx context.Context, from time.Time, to time.Time) ([]archiveRecord, error) {
+	var records []archiveRecord
+	for day := from.UTC(); !day.After(to.UTC()); day = day.AddDate(0, 0, 1) {
+		var keys []string
+		err := a.svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(a.bucket),
+			Prefix: aws.String(a.dayPrefix(day)),
+		}, func(page *s3.ListObjectsV2Output, last bool) bool {
+			for _, object := range page.Contents {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %v: %w", a.dayPrefix(day), err)
+		}
+		for _, key := range keys {
+			result, err := a.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(a.bucket),
+				Key:    aws.String(key),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("s3 get %v: %w", key, err)
+			}
+			scanner := bufio.NewScanner(result.Body)
+			for scanner.Scan() {
+				var record archiveRecord
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					continue
+				}
+				records = append(records, record)
+			}
+			err = scanner.Err()
+			result.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("s3 read %v: %w", key, err)
+			}
+		}
+	}
+	return records, nil
+}
+
+// dynamoArchive keeps the alerts in the DynamoDB table, partitioned by day
+// with the "alert#YYYY-MM-DD" partition key and sorted by time. The items
+// expire after ARCHIVE_RETENTION_DAYS when it is set.
+type dynamoArchive struct {
+	svc       *dynamodb.DynamoDB
+	table     string
+	retention time.Duration
+}
+
+func dynamoArchiveKey(day time.Time) string {
+	return "alert#" + day.UTC().Format(archiveDay)
+}
+
+func (a *dynamoArchive) write(ctx context.Context, records []archiveRecord) error {
+	for _, record := range records {
+		buf, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		item := dynamoKey(dynamoArchiveKey(record.Time), record.Time.Format(time.RFC3339Nano)+"#"+record.Key)
+		item["data"] = &dynamodb.AttributeValue{S: aws.String(string(buf))}
+		if a.retention > 0 {
+			item["expires"] = dynamoNumber(record.Time.Add(a.retention).Unix())
+		}
+		_, err = a.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(a.table),
+			Item:      item,
+		})
+		if err != nil {
+			return fmt.Errorf("dynamodb put %v: %w", record.Key, err)
+		}
+	}
+	return nil
+}
+
+func (a *dynamoArchive) read(ctx context.Context, from time.Time, to time.Time) ([]archiveRecord, error) {
+	var records []archiveRecord
+	for day := from.UTC(); !day.After(to.UTC()); day = day.AddDate(0, 0, 1) {
+		err := a.svc.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(a.table),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":pk": {S: aws.String(dynamoArchiveKey(day))},
+			},
+		}, func(page *dynamodb.QueryOutput, last bool) bool {
+			for _, item := range page.Items {
+				data := item["data"]
+				if data == nil || data.S == nil {
+					continue
+				}
+				var record archiveRecord
+				if err := json.Unmarshal([]byte(*data.S), &record); err != nil {
+					continue
+				}
+				records = append(records, record)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dynamodb query %v: %w", dynamoArchiveKey(day), err)
+		}
+	}
+	return records, nil
+}
+
+// collectionHistory is the alert history of one collection.
+type collectionHistory struct {
+	Chain    string
+	Contract string
+	Name     string
+	Slug     string
+	Alerts   int
+	Mints    int
+	First    time.Time
+	Last     time.Time
+	// FloorPrice and FloorToken are the floor price at the last alert
+	// that had one
+	FloorPrice *float64
+	FloorToken string
+}
+
+// channelHistory is the delivery history of one channel.
+type channelHistory struct {
+	Sent   int
+	Failed int
+}
+
+// HitRate is the share of the alerts the channel delivered.
+func (c channelHistory) HitRate() float64 {
+	if c.Sent+c.Failed == 0 {
+		return 0
+	}
+	return float64(c.Sent) / float64(c.Sent+c.Failed)
+}
+
+// alertHistory summarises the archived alerts over a period.
+type alertHistory struct {
+	Alerts      int
+	Collections map[string]*collectionHistory
+	Channels    map[string]*channelHistory
+	PerDay      map[string]int
+}
+
+// summarizeHistory merges the records of each alert, so a retried delivery
+// counts once, and totals them per collection, channel and day. Canary
+// alerts are left out.
+func summarizeHistory(records []archiveRecord) alertHistory {
+	history := alertHistory{
+		Collections: make(map[string]*collectionHistory),
+		Channels:    make(map[string]*channelHistory),
+		PerDay:      make(map[string]int),
+	}
+	type delivery struct {
+		record archiveRecord
+		sent   map[string]bool
+		failed map[string]bool
+	}
+	alerts := make(map[string]*delivery)
+	var order []string
+	for _, record := range records {
+		if record.Canary {
+			continue
+		}
+		d, ok := alerts[record.Key]
+		if !ok {
+			d = &delivery{record: record, sent: make(map[string]bool), failed: make(map[string]bool)}
+			alerts[record.Key] = d
+			order = append(order, record.Key)
+		}
+		for _, channel := range record.Sent {
+			d.sent[channel] = true
+		}
+		for _, channel := range record.Failed {
+			d.failed[channel] = true
+		}
+	}
+	for _, key := range order {
+		d := alerts[key]
+		record := d.record
+		history.Alerts++
+		history.PerDay[record.Time.UTC().Format(archiveDay)]++
+		recent := recentKey(record.Chain, record.Contract)
+		collection, ok := history.Collections[recent]
+		if !ok {
+			collection = &collectionHistory{Chain: record.Chain, Contract: record.Contract, First: record.Time}
+			history.Collections[recent] = collection
+		}
+		collection.Alerts++
+		collection.Mints += record.Count
+		collection.Name = record.Name
+		collection.Last = record.Time
+		if record.Slug != "" {
+			collection.Slug = record.Slug
+		}
+		if record.FloorPrice != nil {
+			collection.FloorPrice = record.FloorPrice
+			collection.FloorToken = record.FloorToken
+		}
+		for channel := range d.sent {
+			history.channel(channel).Sent++
+		}
+		for channel := range d.failed {
+			// a failure that a later retry delivered is not counted
+			if !d.sent[channel] {
+				history.channel(channel).Failed++
+			}
+		}
+	}
+	return history
+}
+
+func (h alertHistory) channel(name string) *channelHistory {
+	channel, ok := h.Channels[name]
+	if !ok {
+		channel = &channelHistory{}
+		h.Channels[name] = channel
+	}
+	return channel
+}
+
+// repeats returns the collections alerted more than once, most alerted
+// first.
+func (h alertHistory) repeats() []*collectionHistory {
+	var list []*collectionHistory
+	for _, collection := range h.Collections {
+		if collection.Alerts > 1 {
+			list = append(list, collection)
+		}
+	}
+	sortCollections(list, func(c *collectionHistory) int { return c.Alerts })
+	return list
+}
+
+// top returns up to n collections with the most mints across their alerts.
+func (h alertHistory) top(n int) []*collectionHistory {
+	var list []*collectionHistory
+	for _, collection := range h.Collections {
+		list = append(list, collection)
+	}
+	sortCollections(list, func(c *collectionHistory) int { return c.Mints })
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// RepeatRate is the share of the alerted collections that were alerted
+// more than once.
+func (h alertHistory) RepeatRate() float64 {
+	if len(h.Collections) == 0 {
+		return 0
+	}
+	return float64(len(h.repeats())) / float64(len(h.Collections))
+}
+
+func sortCollections(list []*collectionHistory, by func(*collectionHistory) int) {
+	sort.Slice(list, func(i, j int) bool {
+		if by(list[i]) != by(list[j]) {
+			return by(list[i]) > by(list[j])
+		}
+		return list[i].Contract < list[j].Contract
+	})
+}
+
+// runHistory prints a report of the archived alerts. It returns the exit
+// code.
+func runHistory(ctx context.Context, args []string) int {
+	days := 30
+	top := 10
+	for i := 0; i+1 < len(args); i += 2 {
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			slog.Error("Invalid option value", "option", args[i], "value", args[i+1])
+			return 2
+		}
+		switch strings.TrimLeft(args[i], "-") {
+		case "days":
+			days = n
+		case "top":
+			top = n
+		default:
+			slog.Error("Unknown option, expected -days or -top", "option", args[i])
+			return 2
+		}
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		slog.Error("Unable to create a new session", "error", err)
+		return 1
+	}
+	archive, err := newAlertArchive(sess)
+	if err != nil {
+		slog.Error("Unable to open the alert archive", "error", err)
+		return 1
+	}
+	if archive == nil {
+		slog.Error("The alert archive is not enabled, set ARCHIVE_BACKEND")
+		return 1
+	}
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -(days - 1))
+	records, err := archive.read(ctx, from, to)
+	if err != nil {
+		slog.Error("Unable to read the alert archive", "error", err)
+		return 1
+	}
+	history := summarizeHistory(records)
+
+	fmt.Printf("Alerts from %v to %v: %v for %v collections\n", from.Format(archiveDay), to.Format(archiveDay), history.Alerts, len(history.Collections))
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if n := history.PerDay[day.Format(archiveDay)]; n > 0 {
+			fmt.Printf("  %v  %v\n", day.Format(archiveDay), n)
+		}
+	}
+	fmt.Println("\nChannel hit rates:")
+	for _, name := range sortedKeys(history.Channels) {
+		channel := history.Channels[name]
+		fmt.Printf("  %-12v %5.1f%%  %v sent, %v failed\n", name, channel.HitRate()*100, channel.Sent, channel.Failed)
+	}
+	repeats := history.repeats()
+	fmt.Printf("\nRepeat alerts: %v collections (%.1f%%)\n", len(repeats), history.RepeatRate()*100)
+	for _, collection := range repeats {
+		fmt.Printf("  %4v alerts  %v%v %v, %v to %v\n", collection.Alerts, collection.Name, chainTag(collection.Chain), collection.Contract,
+			collection.First.Format(archiveDay), collection.Last.Format(archiveDay))
+	}
+	fmt.Printf("\nTop collections by mints:\n")
+	for _, collection := range history.top(top) {
+		fmt.Printf("  %6v mints  %v%v %v\n", collection.Mints, collection.Name, chainTag(collection.Chain), collection.Contract)
+	}
+	return 0
+}
+
+func sortedKeys(channels map[string]*channelHistory) []string {
+	var names []string
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
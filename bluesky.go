@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	targetBluesky      = "bluesky"
+	defaultBlueskyHost = "https://bsky.social"
+	// blueskyMaxChars is the length limit of a post. Bluesky counts
+	// graphemes, characters are close enough for the alert text.
+	blueskyMaxChars = 300
+)
+
+func init() {
+	registerNotifier(targetBluesky, newBlueskyNotifier)
+}
+
+// blueskyNotifier posts the alerts to a Bluesky account over the AT Protocol
+// with the same text as the tweets, attaching the collection image. It logs
+// in with an app password on each post.
+type blueskyNotifier struct {
+	host     string
+	handle   string
+	password string
+	client   *http.Client
+	template *messageTemplate
+}
+
+type blueskySession struct {
+	AccessJwt string `json:"accessJwt"`
+	DID       string `json:"did"`
+}
+
+func newBlueskyNotifier() (Notifier, error) {
+	b := &blueskyNotifier{
+		host:     strings.TrimRight(os.Getenv("BLUESKY_PDS_URL"), "/"),
+		handle:   os.Getenv("BLUESKY_HANDLE"),
+		password: os.Getenv("BLUESKY_APP_PASSWORD"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if b.host == "" {
+		b.host = defaultBlueskyHost
+	}
+	if b.handle == "" || b.password == "" {
+		return nil, fmt.Errorf("BLUESKY_HANDLE and BLUESKY_APP_PASSWORD must be set")
+	}
+	template, err := loadMessageTemplate(targetBluesky)
+	if err != nil {
+		return nil, err
+	}
+	b.template = template
+	return b, nil
+}
+
+func (b *blueskyNotifier) Name() string { return targetBluesky }
+
+func (b *blueskyNotifier) render(alert Alert) (string, error) {
+	text, err := b.template.text(alert, tweetText)
+	if err != nil {
+		return "", err
+	}
+	return truncateChars(text, blueskyMaxChars), nil
+}
+
+func (b *blueskyNotifier) Notify(ctx context.Context, alert Alert) error {
+	text, err := b.render(alert)
+	if err != nil {
+		return err
+	}
+	var session blueskySession
+	login := map[string]string{"identifier": b.handle, "password": b.password}
+	if err := b.call(ctx, "com.atproto.server.createSession", "", login, &session); err != nil {
+		return err
+	}
+
+	post := map[string]interface{}{
+		"$type":     "app.bsky.feed.post",
+		"text":      text,
+		"createdAt": time.Now().UTC().Format(time.RFC3339),
+	}
+	if facets := linkFacets(text); len(facets) > 0 {
+		post["facets"] = facets
+	}
+	if image := alert.Collection.ImageURL; image != "" {
+		blob, err := b.uploadImage(ctx, session, image)
+		if err != nil {
+			// the post is still worth sending without the image
+			slog.Warn("Unable to attach the collection image", "channel", targetBluesky, "contract", alert.Contract, "error", err)
+		} else {
+			post["embed"] = map[string]interface{}{
+				"$type":  "app.bsky.embed.images",
+				"images": []interface{}{map[string]interface{}{"alt": alert.Collection.Name, "image": blob}},
+			}
+		}
+	}
+	record := map[string]interface{}{
+		"repo":       session.DID,
+		"collection": "app.bsky.feed.post",
+		"record":     post,
+	}
+	var created struct {
+		URI string `json:"uri"`
+	}
+	if err := b.call(ctx, "com.atproto.repo.createRecord", session.AccessJwt, record, &created); err != nil {
+		return err
+	}
+	slog.Info("Bluesky post created", "channel", targetBluesky, "contract", alert.Contract, "uri", created.URI)
+	return nil
+}
+
+// uploadImage uploads the image at url and returns the blob to embed.
+func (b *blueskyNotifier) uploadImage(ctx context.Context, session blueskySession, url string) (json.RawMessage, error) {
+	image, contentType, err := fetchImage(ctx, b.client, url)
+	if err != nil {
+		return nil, err
+	}
+	var uploaded struct {
+		Blob json.RawMessage `json:"blob"`
+	}
+	if err := b.post(ctx, "com.atproto.repo.uploadBlob", session.AccessJwt, contentType, bytes.NewReader(image), &uploaded); err != nil {
+		return nil, err
+	}
+	return uploaded.Blob, nil
+}
+
+// call posts params as JSON to the XRPC method and decodes the response
+// into v.
+func (b *blueskyNotifier) call(ctx context.Context, method string, token string, params interface{}, v interface{}) error {
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return b.post(ctx, method, token, "application/json", bytes.NewReader(buf), v)
+}
+
+func (b *blueskyNotifier) post(ctx context.Context, method string, token string, contentType string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.host+"/xrpc/"+method, body)
+	if err != nil {
+		return fmt.Errorf("bluesky %v: request: %w", method, err)
+	}
+	req.Header.Add("Content-Type", contentType)
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("bluesky %v response: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("bluesky %v response read: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(respBytes, &apiErr)
+		return fmt.Errorf("bluesky %v status %v: %v %v", method, resp.StatusCode, apiErr.Error, apiErr.Message)
+	}
+	return json.Unmarshal(respBytes, v)
+}
+
+var linkPattern = regexp.MustCompile(`https?://[^\s]+`)
+
+// linkFacets marks the links in the text so Bluesky shows them as links.
+// The facets are indexed by UTF-8 byte offsets.
+func linkFacets(text string) []interface{} {
+	var facets []interface{}
+	for _, loc := range linkPattern.FindAllStringIndex(text, -1) {
+		facets = append(facets, map[string]interface{}{
+			"index": map[string]int{"byteStart": loc[0], "byteEnd": loc[1]},
+			"features": []interface{}{map[string]string{
+				"$type": "app.bsky.richtext.facet#link",
+				"uri":   text[loc[0]:loc[1]],
+			}},
+		})
+	}
+	return facets
+}
+
+// truncateChars shortens the text to at most max characters, ending it with
+// an ellipsis when it is cut.
+func truncateChars(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const defaultTimeReserveSeconds = 15
+
+// timeBudget tracks the time left in the Lambda invocation so the run can
+// save its state before it is killed.
+type timeBudget struct {
+	deadline time.Time
+	reserve  time.Duration
+}
+
+// Continuation holds the collections that were not processed because the
+// run ran out of time. They are picked up first on the next run.
+type Continuation struct {
+	Block string   `json:"block"`
+	Mints PairList `json:"mints"`
+}
+
+func newTimeBudget(ctx context.Context) timeBudget {
+	budget := timeBudget{
+		reserve: time.Duration(envInt("TIME_BUDGET_RESERVE_SECONDS", defaultTimeReserveSeconds)) * time.Second,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		budget.deadline = deadline
+	}
+	return budget
+}
+
+func (b timeBudget) remaining() time.Duration {
+	if b.deadline.IsZero() {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Until(b.deadline)
+}
+
+// low reports whether the invocation is close enough to its deadline that
+// the run should stop starting new work.
+func (b timeBudget) low() bool {
+	return b.remaining() < b.reserve
+}
+
+// short reports whether the invocation is within twice the reserve of its
+// deadline. The alerts are posted without the enrichment from then on, so
+// the posts get out before the run has to stop.
+func (b timeBudget) short() bool {
+	return b.remaining() < 2*b.reserve
+}
+
+// allows reports whether a wait of d leaves the reserve.
+func (b timeBudget) allows(d time.Duration) bool {
+	return b.remaining()-d >= b.reserve
+}
+
+// mergeContinuation adds the collections deferred by the previous run to the
+// mint list, keeping the higher count when a contract appears in both.
+func mergeContinuation(mintlist PairList, continuation *Continuation) PairList {
+	if continuation == nil || len(continuation.Mints) == 0 {
+		return mintlist
+	}
+	slog.Info("Resuming deferred collections", "collections", len(continuation.Mints), "block", continuation.Block)
+	counts := make(map[string]int)
+	for _, mint := range mintlist {
+		counts[mint.Key] = mint.Value
+	}
+	for _, mint := range continuation.Mints {
+		if mint.Value > counts[mint.Key] {
+			counts[mint.Key] = mint.Value
+		}
+	}
+	return rankByWordCount(counts)
+}
@@ -1,2 +1,5 @@
-GOOS=linux GOARCH=amd64  go1.21.0 build
+VERSION=$(git describe --tags --always --dirty)
+COMMIT=$(git rev-parse --short HEAD)
+BUILD_TIME=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+GOOS=linux GOARCH=amd64  go1.21.0 build -ldflags "-X main.version=$VERSION -X main.commit=$COMMIT -X main.buildTime=$BUILD_TIME"
 zip nftmintalert.zip nftmintalert .env /Users/woodward/go/bin/darwin_arm64
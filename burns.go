@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	alertKindBurn        = "burn"
+	defaultBurnThreshold = 100
+	defaultBurnHeadline  = "🔥 Mass Burn Alert"
+
+	// burnModeNet subtracts the burns from the mint counts and burnModeAlert
+	// posts mass burn alerts
+	burnModeNet   = "net"
+	burnModeAlert = "alert"
+)
+
+// deadAddress is the other common burn address besides the null address.
+var deadAddress = common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+
+// burnMode reads BURN_MODE. Burns are counted but not used when it is not
+// set.
+func burnMode() string {
+	return envString("BURN_MODE", "")
+}
+
+// burnAlerts posts the collections with more than BURN_THRESHOLD burn
+// transactions.
+func burnAlerts() countedAlert {
+	return countedAlert{
+		kind:      alertKindBurn,
+		threshold: envInt("BURN_THRESHOLD", defaultBurnThreshold),
+		headline:  envString("BURN_HEADLINE", defaultBurnHeadline),
+	}
+}
+
+// burnOf reports whether the log is the burn of tokens from a contract that
+// is not excluded, and returns the transaction and contract of the burn.
+func burnOf(txLog types.Log, exclude map[common.Address]bool) (mintKey, bool) {
+	from, _, ok := nftTransferOf(txLog, exclude)
+	if !ok || from.Hex() == nullAddress {
+		return mintKey{}, false
+	}
+	to := mintRecipient(txLog)
+	if to.Hex() != nullAddress && to != deadAddress {
+		return mintKey{}, false
+	}
+	return mintKey{tx: txLog.TxHash, contract: txLog.Address}, true
+}
+
+// burnsRanked returns the contracts ordered from most to least burn
+// transactions.
+func (m *mintCounter) burnsRanked() PairList {
+	return rankByWordCount(m.burns)
+}
+
+// netMints subtracts the burn transactions from the mint counts, so a
+// migration that burns and mints the same tokens isn't alerted.
+func (m *mintCounter) netMints() {
+	for contract, burns := range m.burns {
+		if _, ok := m.counts[contract]; !ok {
+			continue
+		}
+		m.counts[contract] -= burns
+		if m.counts[contract] < 0 {
+			m.counts[contract] = 0
+		}
+	}
+}
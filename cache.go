@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+	"time"
+
+	"nftmintalert/opensea"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const defaultMetadataCacheTTLHours = 24
+
+// cachedCollection is a collection looked up on an earlier run along with
+// the call out decision made for it.
+type cachedCollection struct {
+	Collection *opensea.OpenSeaCollection `json:"collection"`
+	Stats      *opensea.Stats             `json:"stats,omitempty"`
+	CallOut    bool                       `json:"call_out"`
+	Fetched    time.Time                  `json:"fetched"`
+}
+
+// metadataCache keeps the OpenSea lookups between runs, keyed by contract
+// address, so collections that mint heavily on every run are not looked up
+// and evaluated again until the entry expires. A nil cache is disabled.
+type metadataCache struct {
+	Entries map[string]*cachedCollection `json:"entries"`
+	// Names are the ENS names of the minting wallets, keyed by address
+	Names map[string]*cachedName `json:"names,omitempty"`
+	ttl   time.Duration
+}
+
+// loadMetadataCache reads the cache from S3. A missing or unreadable cache
+// starts out empty.
+func loadMetadataCache(sess *session.Session, s3bucket string, s3key string, ttl time.Duration) *metadataCache {
+	cache := &metadataCache{Entries: make(map[string]*cachedCollection), ttl: ttl}
+	svc := s3.New(sess)
+	result, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s3bucket),
+		Key:    aws.String(s3key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != s3.ErrCodeNoSuchKey {
+			slog.Error("Error reading metadata cache", "error", err)
+		}
+		return cache
+	}
+	defer result.Body.Close()
+	body, err := ioutil.ReadAll(result.Body)
+	if err == nil {
+		err = json.Unmarshal(body, cache)
+	}
+	if err != nil {
+		slog.Error("Error reading metadata cache", "error", err)
+	}
+	if cache.Entries == nil {
+		cache.Entries = make(map[string]*cachedCollection)
+	}
+	return cache
+}
+
+// save drops the expired entries and writes the cache to S3.
+func (c *metadataCache) save(sess *session.Session, s3bucket string, s3key string) {
+	if c == nil {
+		return
+	}
+	for contract, entry := range c.Entries {
+		if time.Since(entry.Fetched) > c.ttl {
+			delete(c.Entries, contract)
+		}
+	}
+	for wallet, entry := range c.Names {
+		if time.Since(entry.Fetched) > c.ttl {
+			delete(c.Names, wallet)
+		}
+	}
+	buf, err := json.Marshal(c)
+	if err != nil {
+		slog.Error("Error writing metadata cache", "error", err)
+		return
+	}
+	svc := s3.New(sess)
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s3bucket),
+		Key:    aws.String(s3key),
+		Body:   bytes.NewReader(buf),
+	})
+	if err != nil {
+		slog.Error("Error writing metadata cache", "error", err)
+	}
+}
+
+// get returns the cached entry for the contract if it has not expired.
+func (c *metadataCache) get(contract string) *cachedCollection {
+	if c == nil {
+		return nil
+	}
+	entry, ok := c.Entries[strings.ToLower(contract)]
+	if !ok || time.Since(entry.Fetched) > c.ttl {
+		return nil
+	}
+	return entry
+}
+
+func (c *metadataCache) put(contract string, collection *opensea.OpenSeaCollection, stats *opensea.Stats, callOut bool) {
+	if c == nil {
+		return
+	}
+	c.Entries[strings.ToLower(contract)] = &cachedCollection{
+		Collection: collection,
+		Stats:      stats,
+		CallOut:    callOut,
+		Fetched:    time.Now(),
+	}
+}
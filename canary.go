@@ -0,0 +1,62 @@
+package main
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// canaryConfig diverts a share of the alerts to the canary channels for a
+// trial period, so a new configuration can be checked before its alerts go
+// to the public channels.
+type canaryConfig struct {
+	// Percent of the collections that are posted to the canary channels.
+	Percent int
+	// Until is the end of the trial. Zero means no end.
+	Until time.Time
+}
+
+func getCanaryConfig() canaryConfig {
+	var canary canaryConfig
+	if until := os.Getenv("CANARY_UNTIL"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			t, err = time.Parse(usageDateFormat, until)
+		}
+		if err != nil {
+			slog.Warn("Invalid CANARY_UNTIL value, use YYYY-MM-DD or RFC3339", "value", until, "error", err)
+		} else {
+			canary.Until = t
+			// a trial period on its own sends everything to the canary channels
+			canary.Percent = 100
+		}
+	}
+	if percent := os.Getenv("CANARY_PERCENT"); percent != "" {
+		p, err := strconv.Atoi(percent)
+		if err != nil || p < 0 || p > 100 {
+			slog.Warn("Invalid CANARY_PERCENT value, must be 0-100", "value", percent)
+		} else {
+			canary.Percent = p
+		}
+	}
+	return canary
+}
+
+func (c canaryConfig) active() bool {
+	return c.Percent > 0 && (c.Until.IsZero() || time.Now().Before(c.Until))
+}
+
+// selects reports whether the collection's alerts go to the canary channels.
+// The choice is made from the contract address so a collection always lands
+// on the same side.
+func (c canaryConfig) selects(contract string) bool {
+	if !c.active() {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(contract)))
+	return int(h.Sum32()%100) < c.Percent
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Chain is an EVM network that is scanned for mints.
+type Chain struct {
+	Name        string
+	DisplayName string
+	RPCURL      string
+	// OpenSea is the chain's identifier in the OpenSea v2 API
+	OpenSea string
+	// Currency is the symbol of the chain's native currency
+	Currency string
+	// BlockWindow is the number of blocks scanned on each run, roughly 10
+	// minutes worth of blocks
+	BlockWindow uint64
+	// MaxCatchup is the most blocks scanned in one run after the checkpoint.
+	// Anything older is skipped.
+	MaxCatchup uint64
+	// Exclude holds the contracts whose transfers are never counted
+	Exclude map[common.Address]bool
+}
+
+// defaultCatchupWindows is how many block windows a chain can fall behind
+// before the oldest blocks are skipped.
+const defaultCatchupWindows = 20
+
+// knownChains holds the defaults for the supported chains.
+var knownChains = map[string]Chain{
+	chainEthereum: {DisplayName: "Ethereum", OpenSea: "ethereum", Currency: "ETH", BlockWindow: newBlocks},
+	"polygon":     {DisplayName: "Polygon", OpenSea: "matic", Currency: "POL", BlockWindow: 300},
+	"arbitrum":    {DisplayName: "Arbitrum", OpenSea: "arbitrum", Currency: "ETH", BlockWindow: 2400},
+	"base":        {DisplayName: "Base", OpenSea: "base", Currency: "ETH", BlockWindow: 300},
+	"optimism":    {DisplayName: "Optimism", OpenSea: "optimism", Currency: "ETH", BlockWindow: 300},
+}
+
+// defaultExclusions are the contracts skipped on each chain out of the box.
+var defaultExclusions = map[string][]string{
+	chainEthereum: {contractAddressOpenSea, contractENS, contractENS2},
+}
+
+// loadChains reads the chains listed in CHAINS (ethereum by default). Each
+// chain is configured with <NAME>_RPC_URL, <NAME>_EXCLUDE, <NAME>_BLOCK_WINDOW
+// and <NAME>_MAX_CATCHUP_BLOCKS. Ethereum also accepts ETH_NETWORK_URL.
+func loadChains() ([]Chain, error) {
+	var chains []Chain
+	for _, name := range envList("CHAINS", chainEthereum) {
+		name = strings.ToLower(name)
+		chain, ok := knownChains[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown chain %q in CHAINS", name)
+		}
+		chain.Name = name
+		prefix := strings.ToUpper(name)
+
+		chain.RPCURL = os.Getenv(prefix + "_RPC_URL")
+		if chain.RPCURL == "" && name == chainEthereum {
+			chain.RPCURL = os.Getenv("ETH_NETWORK_URL")
+		}
+		if chain.RPCURL == "" {
+			return nil, fmt.Errorf("%v network URL environment variable (%v_RPC_URL) is not set", chain.DisplayName, prefix)
+		}
+
+		window := envInt(prefix+"_BLOCK_WINDOW", int(chain.BlockWindow))
+		if window < 1 {
+			return nil, fmt.Errorf("%v_BLOCK_WINDOW must be at least 1", prefix)
+		}
+		chain.BlockWindow = uint64(window)
+
+		catchup := envInt(prefix+"_MAX_CATCHUP_BLOCKS", window*defaultCatchupWindows)
+		if catchup < 1 {
+			return nil, fmt.Errorf("%v_MAX_CATCHUP_BLOCKS must be at least 1", prefix)
+		}
+		chain.MaxCatchup = uint64(catchup)
+
+		exclude, err := chainExclusions(name, os.Getenv(prefix+"_EXCLUDE"))
+		if err != nil {
+			return nil, fmt.Errorf("%v_EXCLUDE: %w", prefix, err)
+		}
+		chain.Exclude = exclude
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+// chainExclusions returns the default exclusions for the chain plus the
+// comma separated addresses in extra.
+func chainExclusions(name string, extra string) (map[common.Address]bool, error) {
+	addresses, err := parseAddresses(strings.Join(defaultExclusions[name], ",") + "," + extra)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make(map[common.Address]bool)
+	for _, address := range addresses {
+		exclude[address] = true
+	}
+	return exclude, nil
+}
+
+// chainDisplayName returns the name of the chain for alert messages.
+func chainDisplayName(name string) string {
+	if chain, ok := knownChains[name]; ok {
+		return chain.DisplayName
+	}
+	return name
+}
+
+// chainTag returns the suffix added to alert headlines, e.g. " on Polygon".
+// Ethereum alerts keep the original wording.
+func chainTag(chain string) string {
+	if chain == "" || chain == chainEthereum {
+		return ""
+	}
+	return " on " + chainDisplayName(chain)
+}
+
+// recentKey identifies a contract in the status file and metadata cache.
+// Ethereum contracts keep the bare address used before multi-chain support.
+func recentKey(chain string, contract string) string {
+	if chain == "" || chain == chainEthereum {
+		return contract
+	}
+	return chain + ":" + contract
+}
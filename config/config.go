@@ -0,0 +1,337 @@
+// Package config loads the settings from a YAML or TOML file. The settings
+// are applied as the environment variables the rest of the program reads,
+// and variables already set in the environment override the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration file. Every field is optional.
+type Config struct {
+	Chain      Chain      `yaml:"chain" toml:"chain"`
+	Thresholds Thresholds `yaml:"thresholds" toml:"thresholds"`
+	Channels   Channels   `yaml:"channels" toml:"channels"`
+	Exclusions Exclusions `yaml:"exclusions" toml:"exclusions"`
+	// Settings holds any other environment variable by name, e.g.
+	// OPENSEA_API_KEY or S3_BUCKET
+	Settings map[string]string `yaml:"settings" toml:"settings"`
+}
+
+// Chain selects the chains and how they are scanned.
+type Chain struct {
+	Chains   []string `yaml:"chains" toml:"chains"`
+	Profile  string   `yaml:"profile" toml:"profile"`
+	ScanMode string   `yaml:"scan_mode" toml:"scan_mode"`
+	// RPCURLs and BlockWindows are by chain name, e.g. ethereum
+	RPCURLs      map[string]string `yaml:"rpc_urls" toml:"rpc_urls"`
+	BlockWindows map[string]int    `yaml:"block_windows" toml:"block_windows"`
+}
+
+// Thresholds decide which collections are alerted.
+type Thresholds struct {
+	Mint             *int     `yaml:"mint" toml:"mint"`
+	WindowMinutes    *int     `yaml:"window_minutes" toml:"window_minutes"`
+	CooldownHours    *int     `yaml:"cooldown_hours" toml:"cooldown_hours"`
+	Tiers            []string `yaml:"tiers" toml:"tiers"`
+	Sales            *int     `yaml:"sales" toml:"sales"`
+	Burn             *int     `yaml:"burn" toml:"burn"`
+	MinFloorPrice    *float64 `yaml:"min_floor_price" toml:"min_floor_price"`
+	MinOneDayVolume  *float64 `yaml:"min_one_day_volume" toml:"min_one_day_volume"`
+	MinOwners        *int     `yaml:"min_owners" toml:"min_owners"`
+	MinUniqueMinters *int     `yaml:"min_unique_minters" toml:"min_unique_minters"`
+	MaxMinterShare   *float64 `yaml:"max_minter_share" toml:"max_minter_share"`
+}
+
+// Channels are the notifiers and their credentials.
+type Channels struct {
+	Notifiers       []string `yaml:"notifiers" toml:"notifiers"`
+	CanaryNotifiers []string `yaml:"canary_notifiers" toml:"canary_notifiers"`
+	Discord         struct {
+		WebhookID    string `yaml:"webhook_id" toml:"webhook_id"`
+		WebhookToken string `yaml:"webhook_token" toml:"webhook_token"`
+	} `yaml:"discord" toml:"discord"`
+	Twitter struct {
+		ConsumerKey    string `yaml:"consumer_key" toml:"consumer_key"`
+		ConsumerSecret string `yaml:"consumer_secret" toml:"consumer_secret"`
+		Token          string `yaml:"token" toml:"token"`
+		TokenSecret    string `yaml:"token_secret" toml:"token_secret"`
+	} `yaml:"twitter" toml:"twitter"`
+	Telegram struct {
+		BotToken string `yaml:"bot_token" toml:"bot_token"`
+		ChatID   string `yaml:"chat_id" toml:"chat_id"`
+	} `yaml:"telegram" toml:"telegram"`
+	Slack struct {
+		WebhookURL string `yaml:"webhook_url" toml:"webhook_url"`
+	} `yaml:"slack" toml:"slack"`
+}
+
+// Exclusions are the contract lists. Contracts holds the addresses whose
+// transfers are never counted, by chain name.
+type Exclusions struct {
+	Blocklist []string            `yaml:"blocklist" toml:"blocklist"`
+	Allowlist []string            `yaml:"allowlist" toml:"allowlist"`
+	Watchlist []string            `yaml:"watchlist" toml:"watchlist"`
+	Contracts map[string][]string `yaml:"contracts" toml:"contracts"`
+}
+
+// Load reads the configuration from a local file or an s3://bucket/key
+// location. The format follows the extension: .yaml, .yml or .toml. Unknown
+// fields are an error so that typos don't go unnoticed.
+func Load(location string) (*Config, error) {
+	buf, err := Read(location)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	switch strings.ToLower(path.Ext(location)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(buf))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil {
+			return nil, fmt.Errorf("%v: %w", location, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(buf), config)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", location, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%v: unknown fields %v", location, undecoded)
+		}
+	default:
+		return nil, fmt.Errorf("%v: unknown format, use a .yaml, .yml or .toml file", location)
+	}
+	return config, nil
+}
+
+// Read reads a file from a local path or an s3://bucket/key location.
+func Read(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return ioutil.ReadFile(location)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("%q is not an s3://bucket/key location", location)
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(parts[0]),
+		Key:    aws.String(parts[1]),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+	return ioutil.ReadAll(result.Body)
+}
+
+// Env returns the environment variables the configuration sets.
+func (c *Config) Env() map[string]string {
+	env := make(map[string]string)
+	set := func(name string, value string) {
+		if value != "" {
+			env[name] = value
+		}
+	}
+	setList := func(name string, values []string) {
+		set(name, strings.Join(values, ","))
+	}
+	setInt := func(name string, value *int) {
+		if value != nil {
+			env[name] = strconv.Itoa(*value)
+		}
+	}
+	setFloat := func(name string, value *float64) {
+		if value != nil {
+			env[name] = strconv.FormatFloat(*value, 'f', -1, 64)
+		}
+	}
+
+	setList("CHAINS", c.Chain.Chains)
+	set("PROFILE", c.Chain.Profile)
+	set("SCAN_MODE", c.Chain.ScanMode)
+	for chain, url := range c.Chain.RPCURLs {
+		set(strings.ToUpper(chain)+"_RPC_URL", url)
+	}
+	for chain, window := range c.Chain.BlockWindows {
+		window := window
+		setInt(strings.ToUpper(chain)+"_BLOCK_WINDOW", &window)
+	}
+
+	setInt("MINT_THRESHOLD", c.Thresholds.Mint)
+	setInt("WINDOW_MINUTES", c.Thresholds.WindowMinutes)
+	setInt("ALERT_COOLDOWN_HOURS", c.Thresholds.CooldownHours)
+	setList("ALERT_TIERS", c.Thresholds.Tiers)
+	setInt("SALES_THRESHOLD", c.Thresholds.Sales)
+	setInt("BURN_THRESHOLD", c.Thresholds.Burn)
+	setFloat("MIN_FLOOR_PRICE", c.Thresholds.MinFloorPrice)
+	setFloat("MIN_ONE_DAY_VOLUME", c.Thresholds.MinOneDayVolume)
+	setInt("MIN_OWNERS", c.Thresholds.MinOwners)
+	setInt("MIN_UNIQUE_MINTERS", c.Thresholds.MinUniqueMinters)
+	setFloat("MAX_MINTER_SHARE", c.Thresholds.MaxMinterShare)
+
+	setList("NOTIFIERS", c.Channels.Notifiers)
+	setList("CANARY_NOTIFIERS", c.Channels.CanaryNotifiers)
+	set("DISCORD_WEBHOOK_ID", c.Channels.Discord.WebhookID)
+	set("DISCORD_WEBHOOK_TOKEN", c.Channels.Discord.WebhookToken)
+	set("TWITTER_CONSUMER_KEY", c.Channels.Twitter.ConsumerKey)
+	set("TWITTER_CONSUMER_SECRET", c.Channels.Twitter.ConsumerSecret)
+	set("TWITTER_TOKEN", c.Channels.Twitter.Token)
+	set("TWITTER_TOKEN_SECRET", c.Channels.Twitter.TokenSecret)
+	set("TELEGRAM_BOT_TOKEN", c.Channels.Telegram.BotToken)
+	set("TELEGRAM_CHAT_ID", c.Channels.Telegram.ChatID)
+	set("SLACK_WEBHOOK_URL", c.Channels.Slack.WebhookURL)
+
+	setList("BLOCKLIST", c.Exclusions.Blocklist)
+	setList("ALLOWLIST", c.Exclusions.Allowlist)
+	setList("WATCHLIST", c.Exclusions.Watchlist)
+	for chain, contracts := range c.Exclusions.Contracts {
+		setList(strings.ToUpper(chain)+"_EXCLUDE", contracts)
+	}
+
+	for name, value := range c.Settings {
+		set(strings.ToUpper(name), value)
+	}
+	return env
+}
+
+// Apply sets the environment variables of the configuration that are not
+// already set, and returns how many it set.
+func (c *Config) Apply() int {
+	applied := 0
+	for name, value := range c.Env() {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		os.Setenv(name, value)
+		applied++
+	}
+	return applied
+}
+
+var (
+	required = []string{"S3_BUCKET", "S3_FILE_KEY", "OPENSEA_API_KEY"}
+	integers = []string{
+		"ALERT_COOLDOWN_HOURS", "ALLOWLIST_THRESHOLD", "ARCHIVE_RETENTION_DAYS", "BURN_THRESHOLD",
+		"DAEMON_INTERVAL_MINUTES", "DIGEST_TOP", "ENS_TOP_MINTERS", "LOCK_LEASE_SECONDS",
+		"LOG_CHUNK_BLOCKS", "LOG_QUERY_CONCURRENCY", "MAX_COLLECTION_AGE_DAYS", "MAX_SUPPLY",
+		"METADATA_CACHE_TTL_HOURS", "MINT_PRICE_SAMPLE", "MINT_THRESHOLD", "MIN_OWNERS", "MIN_SUPPLY",
+		"MIN_UNIQUE_MINTERS", "NOTABLE_MINTERS", "OPENSEA_CONCURRENCY", "OPENSEA_EVENT_PAGES",
+		"OPENSEA_MAX_RETRIES", "OPENSEA_TIMEOUT_SECONDS",
+		"OPS_PARTIAL_ERRORS", "OPS_SILENCE_HOURS", "SALES_THRESHOLD", "SCORE_MIN_MINTS", "SCORE_THRESHOLD",
+		"SECRETS_REFRESH_MINUTES", "SUBSCRIBE_EVAL_SECONDS", "SUBSCRIBE_WINDOW_MINUTES",
+		"TIME_BUDGET_RESERVE_SECONDS", "WEBHOOK_ATTEMPTS", "WINDOW_MINUTES",
+	}
+	floats = []string{
+		"MAX_MINTER_SHARE", "MIN_FLOOR_PRICE", "MIN_ONE_DAY_VOLUME", "OPENSEA_REQUESTS_PER_SECOND",
+		"SCORE_WEIGHT_GROWTH", "SCORE_WEIGHT_MINTERS", "SCORE_WEIGHT_MINTS", "SCORE_WEIGHT_SPENT",
+	}
+	booleans = []string{"DEBUG", "DRY_RUN", "ENS_MINTERS", "OPENSEA_EVENTS", "SALES_ALERTS", "STEALTH_MINTS", "TWITTER_IMAGE_CARDS"}
+	choices  = map[string][]string{
+		"PROFILE":         {"all", "watchlist"},
+		"SCAN_MODE":       {"chunks", "blocks"},
+		"BURN_MODE":       {"net", "alert"},
+		"STATE_BACKEND":   {"s3", "dynamodb", "redis"},
+		"ARCHIVE_BACKEND": {"s3", "dynamodb"},
+		"SAFELIST_MODE":   {"require", "tag"},
+		"SCORING":         {"count", "trending"},
+	}
+
+	// backendSettings are required by the state backends
+	backendSettings = map[string]string{"dynamodb": "DYNAMODB_TABLE", "redis": "REDIS_URL"}
+)
+
+// Validate checks the settings in the environment read with getenv and
+// returns every missing or invalid one together, or nil when they are all
+// valid.
+func Validate(getenv func(string) string) error {
+	var errs []error
+	for _, name := range required {
+		if getenv(name) == "" {
+			errs = append(errs, fmt.Errorf("%v is not set", name))
+		}
+	}
+	for backend, name := range backendSettings {
+		if getenv("STATE_BACKEND") == backend && getenv(name) == "" {
+			errs = append(errs, fmt.Errorf("%v is not set, STATE_BACKEND=%v needs it", name, backend))
+		}
+	}
+	ints := append([]string{}, integers...)
+	chains := getenv("CHAINS")
+	if chains == "" {
+		chains = "ethereum"
+	}
+	for _, chain := range strings.Split(chains, ",") {
+		chain = strings.TrimSpace(chain)
+		if chain == "" {
+			continue
+		}
+		name := strings.ToUpper(chain) + "_RPC_URL"
+		if getenv(name) == "" && !(strings.EqualFold(chain, "ethereum") && getenv("ETH_NETWORK_URL") != "") {
+			errs = append(errs, fmt.Errorf("%v is not set", name))
+		}
+		ints = append(ints, strings.ToUpper(chain)+"_BLOCK_WINDOW", strings.ToUpper(chain)+"_MAX_CATCHUP_BLOCKS")
+	}
+	for _, name := range ints {
+		if value := getenv(name); value != "" {
+			if _, err := strconv.Atoi(value); err != nil {
+				errs = append(errs, fmt.Errorf("%v must be a whole number, not %q", name, value))
+			}
+		}
+	}
+	for _, name := range floats {
+		if value := getenv(name); value != "" {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				errs = append(errs, fmt.Errorf("%v must be a number, not %q", name, value))
+			}
+		}
+	}
+	for _, name := range booleans {
+		switch strings.ToLower(getenv(name)) {
+		case "", "1", "0", "true", "false", "yes", "no":
+		default:
+			errs = append(errs, fmt.Errorf("%v must be true or false, not %q", name, getenv(name)))
+		}
+	}
+	var names []string
+	for name := range choices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := choices[name]
+		if value := getenv(name); value != "" && !contains(values, value) {
+			errs = append(errs, fmt.Errorf("%v must be one of %v, not %q", name, strings.Join(values, ", "), value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
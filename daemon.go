@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const defaultDaemonIntervalMinutes = 10
+
+// daemonInterval is how often the daemon scans, from
+// DAEMON_INTERVAL_MINUTES.
+func daemonInterval() time.Duration {
+	return time.Duration(envInt("DAEMON_INTERVAL_MINUTES", defaultDaemonIntervalMinutes)) * time.Minute
+}
+
+// runDaemon runs the scan every interval without Lambda, for a server or a
+// container. A SIGTERM or interrupt lets the current run finish and save
+// its status before exiting. It returns the exit code.
+func runDaemon(ctx context.Context, interval time.Duration) int {
+	if interval <= 0 {
+		slog.Error("The daemon interval must be at least a minute")
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// scans are asked for with the admin API
+	scans := make(chan struct{}, 1)
+	daemonRuns.interval = interval
+	serveMetrics()
+	serveAdmin(scans)
+	slog.Info("Running on a schedule", "interval", interval.String())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// The run isn't cancelled by the signal, but it has to finish
+		// before the next one is due. The time budget stops it starting
+		// new work as the deadline nears.
+		runCtx, cancel := context.WithTimeout(context.Background(), interval)
+		loadSecrets()
+		daemonRuns.begin()
+		runScan(runCtx, Event{})
+		daemonRuns.end()
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Shutting down")
+			return 0
+		case <-ticker.C:
+		case <-scans:
+			slog.Info("Scan requested")
+			ticker.Reset(interval)
+		}
+	}
+}
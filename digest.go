@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/nickname32/discordhook"
+)
+
+const (
+	eventDailySummary  = "daily_summary"
+	eventWeeklySummary = "weekly_summary"
+
+	defaultDigestTop = 5
+)
+
+// digestPeriods are the days covered by each summary event.
+var digestPeriods = map[string]int{
+	eventDailySummary:  1,
+	eventWeeklySummary: 7,
+}
+
+// digest is a ranked summary of the mint alerts over a period.
+type digest struct {
+	Days        int
+	From        time.Time
+	To          time.Time
+	Alerts      int
+	Collections []*collectionHistory
+}
+
+// digestNotifier is implemented by the notifiers that can post a digest.
+type digestNotifier interface {
+	NotifyDigest(ctx context.Context, d digest) error
+}
+
+func (d digest) title() string {
+	if d.Days == 1 {
+		return "NFT Mint Alert daily summary"
+	}
+	return fmt.Sprintf("NFT Mint Alert %v day summary", d.Days)
+}
+
+// entry is the line of the collection ranked rank.
+func (d digest) entry(rank int, collection *collectionHistory) string {
+	name := collection.Name
+	if name == "" {
+		name = collection.Contract
+	}
+	text := fmt.Sprintf("%v. %v%v: %v minted", rank, name, chainTag(collection.Chain), collection.Mints)
+	if collection.FloorPrice != nil {
+		token := collection.FloorToken
+		if token == "" {
+			token = "ETH"
+		}
+		text += fmt.Sprintf(", floor %v %v", *collection.FloorPrice, token)
+	}
+	return text
+}
+
+// link is the collection's OpenSea page, or empty when its slug is unknown.
+func (collection *collectionHistory) link() string {
+	if collection.Slug == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://opensea.io/collection/%v", collection.Slug)
+}
+
+// buildDigest ranks the collections by the tokens minted across their mint
+// alerts in the last days days. Sales and burn alerts are left out.
+func buildDigest(ctx context.Context, archive alertArchive, days int) (digest, error) {
+	to := time.Now().UTC()
+	from := to.Add(-time.Duration(days) * 24 * time.Hour)
+	records, err := archive.read(ctx, from, to)
+	if err != nil {
+		return digest{}, err
+	}
+	var mints []archiveRecord
+	for _, record := range records {
+		if record.Kind == "" && record.Time.After(from) {
+			mints = append(mints, record)
+		}
+	}
+	history := summarizeHistory(mints)
+	return digest{
+		Days:        days,
+		From:        from,
+		To:          to,
+		Alerts:      history.Alerts,
+		Collections: history.top(envInt("DIGEST_TOP", defaultDigestTop)),
+	}, nil
+}
+
+// sendDigest posts the summary of the last days days to the notifiers in
+// DIGEST_NOTIFIERS that can post one. It needs the alert archive.
+func sendDigest(ctx context.Context, days int, dryRun bool) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		slog.Error("Unable to create a new session", "error", err)
+		return
+	}
+	archive, err := newAlertArchive(sess)
+	if err != nil {
+		slog.Error("Unable to read the alert archive", "error", err)
+		return
+	}
+	if archive == nil {
+		slog.Error("The alert archive is not enabled, set ARCHIVE_BACKEND")
+		return
+	}
+	d, err := buildDigest(ctx, archive, days)
+	if err != nil {
+		slog.Error("Unable to read the alert archive", "error", err)
+		return
+	}
+	if len(d.Collections) == 0 {
+		slog.Info("No alerts to summarize", "days", days)
+		return
+	}
+	slog.Info("Summary", "days", days, "alerts", d.Alerts, "text", d.text())
+	if dryRun {
+		return
+	}
+	for _, notifier := range buildNotifiers(envList("DIGEST_NOTIFIERS", defaultNotifiers)) {
+		poster, ok := notifier.(digestNotifier)
+		if !ok {
+			slog.Warn("Notifier can't post summaries", "channel", notifier.Name())
+			continue
+		}
+		if err := poster.NotifyDigest(ctx, d); err != nil {
+			slog.Error("Error posting summary", "channel", notifier.Name(), "error", err)
+		}
+	}
+}
+
+// text is the digest as plain text, logged on every run.
+func (d digest) text() string {
+	lines := []string{d.title()}
+	for i, collection := range d.Collections {
+		lines = append(lines, d.entry(i+1, collection))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NotifyDigest tweets the digest as a thread: the title, then a reply for
+// each collection with its OpenSea link.
+func (t *twitterNotifier) NotifyDigest(ctx context.Context, d digest) error {
+	client := twitterClient(t.keys)
+	head := fmt.Sprintf("%v: the top %v of %v mint alerts 🧵\n\n#nft #nfts #nftminting", d.title(), len(d.Collections), d.Alerts)
+	id, err := postTweet(ctx, client, head, "")
+	if err != nil {
+		return err
+	}
+	for i, collection := range d.Collections {
+		if id == "" {
+			return fmt.Errorf("tweet %v of the thread has no ID to reply to", i+1)
+		}
+		text := d.entry(i+1, collection)
+		if link := collection.link(); link != "" {
+			text += "\n" + link
+		}
+		if id, err = postTweet(ctx, client, text, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotifyDigest posts the digest as an embed with a field for each
+// collection.
+func (d *discordNotifier) NotifyDigest(ctx context.Context, dg digest) error {
+	now := time.Now()
+	embed := &discordhook.Embed{
+		Title:       dg.title(),
+		Description: fmt.Sprintf("Top %v of %v mint alerts from %v", len(dg.Collections), dg.Alerts, dg.From.Format("Jan 2 15:04 MST")),
+		Color:       discordColorNormal,
+		Timestamp:   &now,
+	}
+	for i, collection := range dg.Collections {
+		value := fmt.Sprintf("`%v`", collection.Contract)
+		if link := collection.link(); link != "" {
+			value = fmt.Sprintf("[OpenSea](%v) · %v", link, value)
+		}
+		embed.Fields = append(embed.Fields, &discordhook.EmbedField{Name: dg.entry(i+1, collection), Value: value})
+	}
+	id, err := d.execute(ctx, dg.title(), embed)
+	if err != nil {
+		return err
+	}
+	slog.Info("Discord summary sent", "channel", d.name, "message_id", id)
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nickname32/discordhook"
+)
+
+const (
+	// discordColorNormal is Discord's blurple, discordColorTier the orange
+	// of the tiers above normal without a color in DISCORD_TIER_COLORS
+	discordColorNormal = 0x5865F2
+	discordColorTier   = 0xF0B232
+)
+
+// loadDiscordColors reads the embed colors of the alert tiers from
+// DISCORD_TIER_COLORS, a comma separated list of tier:hex color, e.g.
+// "normal:5865F2,hot:ED4245".
+func loadDiscordColors() map[string]int {
+	colors := map[string]int{tierNormal: discordColorNormal}
+	for _, entry := range envList("DISCORD_TIER_COLORS", "") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			slog.Warn("Invalid DISCORD_TIER_COLORS entry, use tier:color", "entry", entry)
+			continue
+		}
+		color, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(parts[1]), "#"), 16, 32)
+		if err != nil || color > 0xFFFFFF {
+			slog.Warn("Invalid DISCORD_TIER_COLORS color", "entry", entry)
+			continue
+		}
+		colors[strings.TrimSpace(parts[0])] = int(color)
+	}
+	return colors
+}
+
+func discordColor(colors map[string]int, tier string) int {
+	if tier == "" {
+		tier = tierNormal
+	}
+	if color, ok := colors[tier]; ok {
+		return color
+	}
+	return discordColorTier
+}
+
+// discordHeadline is the message content above the embed, shown in
+// notifications.
+func discordHeadline(alert Alert) string {
+	return fmt.Sprintf("%v%v!", alert.headline(), chainTag(alert.Chain))
+}
+
+// discordText is the built in description of the alert embed. Templates
+// replace this text.
+func discordText(mint Alert) string {
+	collection := mint.Collection
+	text := fmt.Sprintf("**%v %v**%v%v in **%v minutes**", mint.Count, mint.action(), mint.mintersText(), mint.priceText(), mint.minutes())
+	var links []string
+	if link := collection.Collection.ExternalURL; link != "" {
+		links = append(links, fmt.Sprintf("[Website](%v)", link))
+	}
+	if twitter := collection.Collection.TwitterUsername; twitter != "" {
+		links = append(links, fmt.Sprintf("[Twitter](https://twitter.com/%v)", twitter))
+	}
+	if discord := collection.Collection.DiscordURL; discord != "" {
+		links = append(links, fmt.Sprintf("[Discord](%v)", discord))
+	}
+	if len(links) > 0 {
+		text += "\n" + strings.Join(links, " · ")
+	}
+	return text
+}
+
+// discordEmbed lays out the alert as a rich embed: the collection name
+// linking to OpenSea, its image as the thumbnail, the description and a
+// field for each detail that is known, colored by the alert tier.
+func discordEmbed(alert Alert, description string, color int) *discordhook.Embed {
+	collection := alert.Collection
+	now := time.Now()
+	embed := &discordhook.Embed{
+		Title:       collection.Name,
+		Description: description,
+		Color:       color,
+		Timestamp:   &now,
+		Footer:      &discordhook.EmbedFooter{Text: chainDisplayName(alert.messageData().Chain)},
+	}
+	if embed.Title == "" {
+		embed.Title = alert.Contract
+	}
+	if collection.Collection.Slug != "" {
+		embed.URL = openseaLink(collection)
+	} else {
+		embed.URL = collection.Collection.ExternalURL
+	}
+	if collection.ImageURL != "" {
+		embed.Thumbnail = &discordhook.EmbedThumbnail{URL: collection.ImageURL}
+	}
+
+	field := func(name string, value string, inline bool) {
+		embed.Fields = append(embed.Fields, &discordhook.EmbedField{Name: name, Value: value, Inline: inline})
+	}
+	counted := "Minted"
+	switch alert.Kind {
+	case alertKindSales:
+		counted = "Sold"
+	case alertKindBurn:
+		counted = "Burned"
+	}
+	field(counted, fmt.Sprintf("%v in %v min", alert.Count, alert.minutes()), true)
+	if alert.Previous > 0 {
+		field("Previous window", fmt.Sprintf("%v (x%.1f)", alert.Previous, float64(alert.Count)/float64(alert.Previous)), true)
+	}
+	if alert.Score > 0 {
+		field("Trending score", strconv.Itoa(alert.Score), true)
+	}
+	if alert.Minters != nil {
+		field("Unique minters", strconv.Itoa(alert.Minters.Unique), true)
+		if notable := alert.Minters.Notable; len(notable) > 0 {
+			field("Notable minters", strings.Join(notable, ", "), false)
+		}
+	}
+	if activity := alert.Activity; activity != nil {
+		field("On OpenSea", fmt.Sprintf("%v mints, %v sales", activity.Mints, activity.Sales), true)
+	}
+	if alert.Stats != nil {
+		data := alert.messageData()
+		field("Floor price", fmt.Sprintf("%v %v", data.FloorPrice, data.StatsCurrency), true)
+	}
+	if supply := collection.TotalSupply; supply != "" && supply != "0" {
+		field("Total supply", supply, true)
+	}
+	if schema := collection.SchemaName; schema != "" {
+		field("Standard", strings.ToUpper(schema), true)
+	}
+	field("Contract", fmt.Sprintf("`%v`", alert.Contract), false)
+	return embed
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andersfylling/snowflake"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/g8rswimmer/go-twitter/v2"
+	"github.com/nickname32/discordhook"
+)
+
+const doctorTimeout = 20 * time.Second
+
+// contractDoctor is a well known contract used to check the OpenSea API key.
+const contractDoctor = "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D" // BAYC
+
+// errSkipped marks a check for a dependency that is not configured.
+var errSkipped = errors.New("not configured")
+
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// runDoctor performs live, low impact checks against every configured
+// dependency and prints a pass/fail report. It returns the exit code.
+func runDoctor(ctx context.Context) int {
+	checks := []doctorCheck{
+		{"Configuration", func(ctx context.Context) (string, error) {
+			return "valid", validateConfig()
+		}},
+		{"Ethereum RPC", checkRPC},
+		{"S3 read", checkS3Read},
+		{"S3 write", checkS3Write},
+		{"Redis", checkRedis},
+		{"OpenSea API", checkOpenSea},
+		{"Twitter auth", checkTwitter},
+		{"Discord webhook", func(ctx context.Context) (string, error) {
+			return checkDiscord(os.Getenv("DISCORD_WEBHOOK_ID"), os.Getenv("DISCORD_WEBHOOK_TOKEN"))
+		}},
+		{"Ops Discord webhook", func(ctx context.Context) (string, error) {
+			return checkDiscord(os.Getenv("OPS_DISCORD_WEBHOOK_ID"), os.Getenv("OPS_DISCORD_WEBHOOK_TOKEN"))
+		}},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, doctorTimeout)
+		detail, err := check.run(checkCtx)
+		cancel()
+		result := "PASS"
+		switch {
+		case errors.Is(err, errSkipped):
+			result = "SKIP"
+			detail = err.Error()
+		case err != nil:
+			result = "FAIL"
+			detail = err.Error()
+			failed++
+		}
+		fmt.Printf("%-4v  %-20v %v\n", result, check.name, detail)
+	}
+	if failed > 0 {
+		fmt.Printf("\n%v check(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+func checkRPC(ctx context.Context) (string, error) {
+	chains, err := loadChains()
+	if err != nil {
+		return "", err
+	}
+	var heads []string
+	for _, chain := range chains {
+		head, err := checkChainRPC(ctx, chain)
+		if err != nil {
+			return "", fmt.Errorf("%v: %w", chain.DisplayName, err)
+		}
+		heads = append(heads, chain.DisplayName+" "+head)
+	}
+	return strings.Join(heads, ", "), nil
+}
+
+func checkChainRPC(ctx context.Context, chain Chain) (string, error) {
+	client, err := ethclient.Dial(chain.RPCURL)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	age := time.Since(time.Unix(int64(header.Time), 0)).Round(time.Second)
+	return fmt.Sprintf("head block %v (%v old)", header.Number, age), nil
+}
+
+func doctorS3() (*s3.S3, string, string, error) {
+	s3bucket := os.Getenv("S3_BUCKET")
+	s3key := os.Getenv("S3_FILE_KEY")
+	if s3bucket == "" || s3key == "" {
+		return nil, "", "", fmt.Errorf("S3_BUCKET/S3_FILE_KEY %w", errSkipped)
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	return s3.New(sess), s3bucket, s3key, nil
+}
+
+func checkS3Read(ctx context.Context) (string, error) {
+	svc, s3bucket, s3key, err := doctorS3()
+	if err != nil {
+		return "", err
+	}
+	result, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s3bucket),
+		Key:    aws.String(s3key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return fmt.Sprintf("s3://%v/%v does not exist yet, it will be created", s3bucket, s3key), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	result.Body.Close()
+	return fmt.Sprintf("read s3://%v/%v (%v bytes)", s3bucket, s3key, aws.Int64Value(result.ContentLength)), nil
+}
+
+func checkS3Write(ctx context.Context) (string, error) {
+	svc, s3bucket, s3key, err := doctorS3()
+	if err != nil {
+		return "", err
+	}
+	// Write and remove a probe object next to the status file
+	probe := s3key + ".doctor"
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s3bucket),
+		Key:    aws.String(probe),
+		Body:   bytes.NewReader([]byte(time.Now().UTC().Format(time.RFC3339))),
+	})
+	if err != nil {
+		return "", err
+	}
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s3bucket),
+		Key:    aws.String(probe),
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote and deleted s3://%v/%v", s3bucket, probe), nil
+}
+
+func checkOpenSea(ctx context.Context) (string, error) {
+	openseaKey := os.Getenv("OPENSEA_API_KEY")
+	if openseaKey == "" {
+		return "", fmt.Errorf("OPENSEA_API_KEY %w", errSkipped)
+	}
+	osclient := newOpenSeaClient(openseaKey)
+	collection, err := osclient.AssetContract(ctx, contractDoctor)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("looked up %v", collection.Name), nil
+}
+
+func checkTwitter(ctx context.Context) (string, error) {
+	notifier, err := newTwitterNotifier()
+	if err != nil {
+		return "", fmt.Errorf("TWITTER_* keys %w", errSkipped)
+	}
+	twitKey := notifier.(*twitterNotifier).keys
+	resp, err := twitterClient(twitKey).AuthUserLookup(ctx, twitter.UserLookupOpts{})
+	if err != nil {
+		return "", err
+	}
+	if resp.Raw == nil || len(resp.Raw.Users) == 0 {
+		return "", errors.New("no user returned")
+	}
+	return fmt.Sprintf("authenticated as @%v", resp.Raw.Users[0].UserName), nil
+}
+
+func checkDiscord(webhookId string, webhookToken string) (string, error) {
+	if webhookId == "" || webhookToken == "" {
+		return "", fmt.Errorf("webhook ID/token %w", errSkipped)
+	}
+	keyInt, err := strconv.ParseInt(webhookId, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook ID: %w", err)
+	}
+	wa, err := discordhook.NewWebhookAPI(snowflake.Snowflake(keyInt), webhookToken, true, nil)
+	if err != nil {
+		return "", err
+	}
+	wh, err := wa.Get(nil)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("webhook %q", wh.Name), nil
+}
+
+func checkRedis(ctx context.Context) (string, error) {
+	if os.Getenv("STATE_BACKEND") != stateBackendRedis {
+		return "", fmt.Errorf("STATE_BACKEND=redis %w", errSkipped)
+	}
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		return "", errors.New("REDIS_URL is not set")
+	}
+	store, err := newRedisStore(url, envString("REDIS_PREFIX", defaultRedisPrefix))
+	if err != nil {
+		return "", err
+	}
+	if err := store.client.Ping(ctx).Err(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pinged %v", store.client.Options().Addr), nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// The table has a string partition key "pk" and sort key "sk", with TTL
+// enabled on the "expires" attribute.
+const (
+	dynamoStatusKey = "status"
+	dynamoRecentKey = "recent"
+	dynamoSentKey   = "sent"
+	dynamoRecentTTL = 90 * 24 * time.Hour
+	dynamoTimeout   = 10 * time.Second
+)
+
+// dynamoStore keeps the Status in DynamoDB. Each posted contract and each
+// idempotency key is its own item with a TTL, so overlapping invocations can
+// not overwrite each other's posts. Idempotency keys are claimed with a
+// conditional write, and the rest of the status is written only if no other
+// run saved it since it was loaded.
+type dynamoStore struct {
+	svc   *dynamodb.DynamoDB
+	table string
+	// version of the status item when it was loaded or last saved
+	version int
+	// posted collections as last loaded or saved
+	posted map[string]time.Time
+}
+
+func newDynamoStore(sess *session.Session, table string) *dynamoStore {
+	return &dynamoStore{svc: dynamodb.New(sess), table: table}
+}
+
+func dynamoKey(pk string, sk string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"pk": {S: aws.String(pk)},
+		"sk": {S: aws.String(sk)},
+	}
+}
+
+func dynamoNumber(n int64) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(n, 10))}
+}
+
+func (d *dynamoStore) load() Status {
+	ctx, cancel := context.WithTimeout(context.Background(), dynamoTimeout)
+	defer cancel()
+	var status Status
+	result, err := d.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            dynamoKey(dynamoStatusKey, dynamoStatusKey),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		slog.Error("Error reading status from DynamoDB", "error", err)
+	} else if item := result.Item; item != nil {
+		if data := item["data"]; data != nil && data.S != nil {
+			if err := json.Unmarshal([]byte(*data.S), &status); err != nil {
+				slog.Error("Error reading status from DynamoDB", "error", err)
+			}
+		}
+		if version := item["version"]; version != nil && version.N != nil {
+			d.version, _ = strconv.Atoi(*version.N)
+		}
+	}
+
+	d.posted = make(map[string]time.Time)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	err = d.svc.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		// expired items are kept until DynamoDB gets round to deleting them
+		FilterExpression: aws.String("expires > :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk":  {S: aws.String(dynamoRecentKey)},
+			":now": {N: aws.String(now)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}, func(page *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range page.Items {
+			sk, posted := item["sk"], item["posted"]
+			if sk == nil || sk.S == nil || posted == nil || posted.N == nil {
+				continue
+			}
+			seconds, err := strconv.ParseInt(*posted.N, 10, 64)
+			if err != nil {
+				continue
+			}
+			if status.Posted == nil {
+				status.Posted = make(map[string]time.Time)
+			}
+			status.Posted[*sk.S] = time.Unix(seconds, 0)
+			d.posted[*sk.S] = time.Unix(seconds, 0)
+		}
+		return true
+	})
+	if err != nil {
+		slog.Error("Error reading recent alerts from DynamoDB", "error", err)
+	}
+	status.migrateRecents()
+	status.claimer = d.claim
+	return status
+}
+
+func (d *dynamoStore) save(status Status) {
+	ctx, cancel := context.WithTimeout(context.Background(), dynamoTimeout)
+	defer cancel()
+
+	for recent, posted := range status.Posted {
+		// times are stored to the second
+		posted = time.Unix(posted.Unix(), 0)
+		if last, ok := d.posted[recent]; ok && last.Equal(posted) {
+			continue
+		}
+		item := dynamoKey(dynamoRecentKey, recent)
+		item["posted"] = dynamoNumber(posted.Unix())
+		item["expires"] = dynamoNumber(posted.Add(dynamoRecentTTL).Unix())
+		_, err := d.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(d.table),
+			Item:      item,
+		})
+		if err != nil {
+			slog.Error("Error saving recent alert to DynamoDB", "contract", recent, "error", err)
+			continue
+		}
+		d.posted[recent] = posted
+	}
+	for recent := range d.posted {
+		if _, ok := status.Posted[recent]; ok {
+			continue
+		}
+		// the cool-down is over
+		_, err := d.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(d.table),
+			Key:       dynamoKey(dynamoRecentKey, recent),
+		})
+		if err != nil {
+			slog.Error("Error removing recent alert from DynamoDB", "contract", recent, "error", err)
+			continue
+		}
+		delete(d.posted, recent)
+	}
+
+	// the posted collections and idempotency keys are items of their own
+	status.Posted = nil
+	status.Sent = nil
+	buf, err := json.Marshal(status)
+	if err != nil {
+		slog.Error("Error saving status to DynamoDB", "error", err)
+		return
+	}
+	item := dynamoKey(dynamoStatusKey, dynamoStatusKey)
+	item["data"] = &dynamodb.AttributeValue{S: aws.String(string(buf))}
+	item["version"] = dynamoNumber(int64(d.version + 1))
+	_, err = d.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR version = :version"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":version": dynamoNumber(int64(d.version)),
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			slog.Warn("Status not saved, another run saved it first", "version", d.version)
+			return
+		}
+		slog.Error("Error saving status to DynamoDB", "error", err)
+		return
+	}
+	d.version++
+}
+
+// claim records the idempotency key unless another run already has. The
+// key expires after sentKeyRetention.
+func (d *dynamoStore) claim(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dynamoTimeout)
+	defer cancel()
+	now := time.Now()
+	item := dynamoKey(dynamoSentKey, key)
+	item["expires"] = dynamoNumber(now.Add(sentKeyRetention).Unix())
+	_, err := d.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expires < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": dynamoNumber(now.Unix()),
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
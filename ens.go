@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	defaultTopMinters     = 5
+	defaultNotableMinters = 3
+)
+
+var (
+	// ensRegistry is the ENS registry on Ethereum
+	ensRegistry = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+	// resolverSelector calls the registry's resolver(bytes32), and
+	// ensNameSelector and ensAddrSelector the resolver's name(bytes32) and
+	// addr(bytes32)
+	resolverSelector = common.FromHex("0x0178b8bf")
+	ensNameSelector  = common.FromHex("0x691f3431")
+	ensAddrSelector  = common.FromHex("0x3b3b57de")
+)
+
+// nameSource finds the names of the minting wallets.
+type nameSource interface {
+	// reverseName returns the wallet's primary name, or "" when it has
+	// none.
+	reverseName(ctx context.Context, wallet common.Address) (string, error)
+}
+
+// ensResolver reverse resolves wallets with ENS through the chain's RPC.
+type ensResolver struct {
+	client chainClient
+	usage  *UsageCounts
+	// resolved keeps the names looked up this run for when the metadata
+	// cache is off
+	resolved map[common.Address]string
+}
+
+// newENSResolver returns the resolver for the chain, or nil unless the
+// notable minters are turned on with ENS_MINTERS. ENS only lives on
+// Ethereum.
+func newENSResolver(client chainClient, chain Chain, usage *UsageCounts) nameSource {
+	if !envBool("ENS_MINTERS") || chain.Name != chainEthereum {
+		return nil
+	}
+	return &ensResolver{client: client, usage: usage, resolved: make(map[common.Address]string)}
+}
+
+// namehash is the ENS node of the name.
+func namehash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// call calls the function of the contract with the node as the argument.
+func (e *ensResolver) call(ctx context.Context, contract common.Address, selector []byte, node common.Hash) ([]byte, error) {
+	e.usage.RPC++
+	data := append(append([]byte{}, selector...), node.Bytes()...)
+	return e.client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+}
+
+// resolver returns the resolver of the node, or the zero address.
+func (e *ensResolver) resolver(ctx context.Context, node common.Hash) (common.Address, error) {
+	result, err := e.call(ctx, ensRegistry, resolverSelector, node)
+	if err != nil || len(result) < 32 {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(result[:32]), nil
+}
+
+// reverseName returns the name set for the wallet's reverse record and only
+// keeps it when the name resolves back to the wallet, as anyone can claim
+// any name in their reverse record.
+func (e *ensResolver) reverseName(ctx context.Context, wallet common.Address) (string, error) {
+	if name, ok := e.resolved[wallet]; ok {
+		return name, nil
+	}
+	name, err := e.lookup(ctx, wallet)
+	if err == nil {
+		e.resolved[wallet] = name
+	}
+	return name, err
+}
+
+func (e *ensResolver) lookup(ctx context.Context, wallet common.Address) (string, error) {
+	node := namehash(hex.EncodeToString(wallet.Bytes()) + ".addr.reverse")
+	resolver, err := e.resolver(ctx, node)
+	if err != nil || resolver == (common.Address{}) {
+		return "", err
+	}
+	result, err := e.call(ctx, resolver, ensNameSelector, node)
+	if err != nil {
+		return "", err
+	}
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		return "", err
+	}
+	values, err := abi.Arguments{abi.Argument{Type: stringType}}.Unpack(result)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	name, _ := values[0].(string)
+	if name == "" {
+		return "", nil
+	}
+
+	forward := namehash(name)
+	resolver, err = e.resolver(ctx, forward)
+	if err != nil || resolver == (common.Address{}) {
+		return "", err
+	}
+	result, err = e.call(ctx, resolver, ensAddrSelector, forward)
+	if err != nil || len(result) < 32 {
+		return "", err
+	}
+	if common.BytesToAddress(result[:32]) != wallet {
+		slog.Debug("ENS name does not resolve back to the wallet", "wallet", wallet.Hex(), "name", name)
+		return "", nil
+	}
+	return name, nil
+}
+
+// topWallets returns up to n of the wallets with the most mints.
+func topWallets(wallets map[common.Address]int, n int) []common.Address {
+	var list []common.Address
+	for wallet := range wallets {
+		list = append(list, wallet)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if wallets[list[i]] != wallets[list[j]] {
+			return wallets[list[i]] > wallets[list[j]]
+		}
+		return list[i].Hex() < list[j].Hex()
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// notableMinters returns the stats with the ENS names of the contract's top
+// ENS_TOP_MINTERS wallets, up to NOTABLE_MINTERS of them. The names, and the
+// wallets without one, are kept in the metadata cache.
+func (a *alerter) notableMinters(ctx context.Context, stats *MinterStats) *MinterStats {
+	if a.names == nil || stats == nil || len(stats.top) == 0 || !a.enrich() {
+		return stats
+	}
+	notable := *stats
+	notable.Notable = nil
+	limit := envInt("NOTABLE_MINTERS", defaultNotableMinters)
+	for _, wallet := range stats.top {
+		if len(notable.Notable) >= limit {
+			break
+		}
+		name, ok := a.cache.name(wallet)
+		if !ok {
+			var err error
+			name, err = a.names.reverseName(ctx, wallet)
+			if err != nil {
+				// try again on the next alert
+				slog.Warn("Unable to resolve the ENS name", "wallet", wallet.Hex(), "error", err)
+				continue
+			}
+			a.cache.putName(wallet, name)
+		}
+		if name != "" {
+			notable.Notable = append(notable.Notable, name)
+		}
+	}
+	return &notable
+}
+
+// cachedName is a wallet's ENS name, empty when it has none.
+type cachedName struct {
+	Name    string    `json:"name,omitempty"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// name returns the cached name of the wallet and whether it was cached.
+func (c *metadataCache) name(wallet common.Address) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	entry, ok := c.Names[strings.ToLower(wallet.Hex())]
+	if !ok || time.Since(entry.Fetched) > c.ttl {
+		return "", false
+	}
+	return entry.Name, true
+}
+
+func (c *metadataCache) putName(wallet common.Address, name string) {
+	if c == nil {
+		return
+	}
+	if c.Names == nil {
+		c.Names = make(map[string]*cachedName)
+	}
+	c.Names[strings.ToLower(wallet.Hex())] = &cachedName{Name: name, Fetched: time.Now()}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"nftmintalert/config"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// envString reads an environment variable, returning def when it is not
+// set.
+func envString(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// envInt reads an integer environment variable, returning def when it is not
+// set or is invalid.
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid setting", "name", name, "value", value, "error", err)
+		return def
+	}
+	return i
+}
+
+// envBool reads a true/false environment variable. 1, true and yes enable
+// it.
+func envBool(name string) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// envFloat reads a decimal environment variable, returning def when it is
+// not set or is invalid.
+func envFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("Invalid setting", "name", name, "value", value, "error", err)
+		return def
+	}
+	return f
+}
+
+// envList reads a comma separated environment variable, using def when it is
+// not set.
+func envList(name string, def string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		value = def
+	}
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// readConfigFile reads a configuration file from a local path or an
+// s3://bucket/key location.
+func readConfigFile(file string) ([]byte, error) {
+	return config.Read(file)
+}
+
+// writeConfigFile writes a local file or s3://bucket/key location read by
+// readConfigFile.
+func writeConfigFile(file string, buf []byte) error {
+	if !strings.HasPrefix(file, "s3://") {
+		return ioutil.WriteFile(file, buf, 0644)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(file, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("%q is not an s3://bucket/key location", file)
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s3.New(sess).PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(parts[0]),
+		Key:    aws.String(parts[1]),
+		Body:   bytes.NewReader(buf),
+	})
+	return err
+}
+
+// loadConfig applies the YAML or TOML configuration file in CONFIG_FILE, a
+// local path or s3://bucket/key. Variables set in the environment override
+// the file.
+func loadConfig() error {
+	file := os.Getenv("CONFIG_FILE")
+	if file == "" {
+		return nil
+	}
+	cfg, err := config.Load(file)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	cfg.Apply()
+	return nil
+}
+
+// validateConfig reports every missing or invalid setting at once.
+func validateConfig() error {
+	if err := config.Validate(os.Getenv); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
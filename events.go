@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	targetSNS         = "sns"
+	targetSQS         = "sqs"
+	targetEventBridge = "eventbridge"
+
+	// alertEventVersion is bumped when a field of alertEvent changes meaning
+	alertEventVersion = 1
+	alertEventSource  = "nftmintalert"
+	alertEventType    = "Mint Alert"
+	// fifoGroup orders the alerts on FIFO topics and queues
+	fifoGroup = "mint-alerts"
+)
+
+func init() {
+	registerNotifier(targetSNS, newSNSNotifier)
+	registerNotifier(targetSQS, newSQSNotifier)
+	registerNotifier(targetEventBridge, newEventBridgeNotifier)
+}
+
+// alertEvent is the JSON published for programmatic consumers of the alerts.
+type alertEvent struct {
+	Version       int            `json:"version"`
+	Key           string         `json:"key"`
+	Time          time.Time      `json:"time"`
+	Chain         string         `json:"chain"`
+	Kind          string         `json:"kind,omitempty"`
+	Contract      string         `json:"contract"`
+	Count         int            `json:"count"`
+	WindowMinutes int            `json:"window_minutes"`
+	Tier          string         `json:"tier,omitempty"`
+	Headline      string         `json:"headline"`
+	Canary        bool           `json:"canary,omitempty"`
+	Stealth       bool           `json:"stealth,omitempty"`
+	DYOR          bool           `json:"dyor,omitempty"`
+	Safelist      string         `json:"safelist_status,omitempty"`
+	Name          string         `json:"name"`
+	Slug          string         `json:"slug,omitempty"`
+	OpenSeaURL    string         `json:"opensea_url"`
+	ExternalURL   string         `json:"external_url,omitempty"`
+	ImageURL      string         `json:"image_url,omitempty"`
+	Twitter       string         `json:"twitter,omitempty"`
+	Price         *MintStatus    `json:"price,omitempty"`
+	FloorPrice    *float64       `json:"floor_price,omitempty"`
+	OneDayVolume  *float64       `json:"one_day_volume,omitempty"`
+	StatsCurrency string         `json:"stats_currency,omitempty"`
+	Score         int            `json:"score,omitempty"`
+	Previous      int            `json:"previous_count,omitempty"`
+	Minters       *MinterStats   `json:"minters,omitempty"`
+	Activity      *EventActivity `json:"activity,omitempty"`
+}
+
+func newAlertEvent(alert Alert) alertEvent {
+	data := alert.messageData()
+	event := alertEvent{
+		Version:       alertEventVersion,
+		Key:           alert.Key,
+		Time:          time.Now().UTC(),
+		Chain:         alert.Chain,
+		Kind:          alert.Kind,
+		Contract:      alert.Contract,
+		Count:         alert.Count,
+		WindowMinutes: data.WindowMinutes,
+		Tier:          alert.Tier,
+		Headline:      data.Headline,
+		Canary:        alert.Canary,
+		Stealth:       alert.Stealth,
+		DYOR:          alert.DYOR,
+		Safelist:      alert.Collection.Collection.SafelistRequestStatus,
+		Name:          alert.Collection.Name,
+		Slug:          alert.Collection.Collection.Slug,
+		OpenSeaURL:    data.Link,
+		ExternalURL:   data.ExternalURL,
+		ImageURL:      alert.Collection.ImageURL,
+		Twitter:       alert.Collection.Collection.TwitterUsername,
+		Price:         alert.Price,
+		Score:         alert.Score,
+		Previous:      alert.Previous,
+		Minters:       alert.Minters,
+		Activity:      alert.Activity,
+	}
+	if event.Chain == "" {
+		event.Chain = chainEthereum
+	}
+	if data.HasStats {
+		event.FloorPrice = &data.FloorPrice
+		event.OneDayVolume = &data.OneDayVolume
+		event.StatsCurrency = data.StatsCurrency
+	}
+	return event
+}
+
+func (e alertEvent) json() (string, error) {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func newEventSession() (*session.Session, error) {
+	return session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+}
+
+// snsNotifier publishes the alerts as JSON to ALERT_SNS_TOPIC_ARN.
+type snsNotifier struct {
+	topicArn string
+	svc      *sns.SNS
+}
+
+func newSNSNotifier() (Notifier, error) {
+	topicArn := os.Getenv("ALERT_SNS_TOPIC_ARN")
+	if topicArn == "" {
+		return nil, fmt.Errorf("ALERT_SNS_TOPIC_ARN must be set")
+	}
+	sess, err := newEventSession()
+	if err != nil {
+		return nil, err
+	}
+	return &snsNotifier{topicArn: topicArn, svc: sns.New(sess)}, nil
+}
+
+func (s *snsNotifier) Name() string { return targetSNS }
+
+func (s *snsNotifier) render(alert Alert) (string, error) {
+	return newAlertEvent(alert).json()
+}
+
+func (s *snsNotifier) Notify(ctx context.Context, alert Alert) error {
+	message, err := s.render(alert)
+	if err != nil {
+		return err
+	}
+	chain := alert.Chain
+	if chain == "" {
+		chain = chainEthereum
+	}
+	input := &sns.PublishInput{
+		TopicArn: aws.String(s.topicArn),
+		Message:  aws.String(message),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			// lets subscriptions filter on the chain
+			"chain": {DataType: aws.String("String"), StringValue: aws.String(chain)},
+		},
+	}
+	if strings.HasSuffix(s.topicArn, ".fifo") {
+		input.MessageGroupId = aws.String(fifoGroup)
+		input.MessageDeduplicationId = aws.String(dedupID(alert.Key))
+	}
+	if _, err := s.svc.PublishWithContext(ctx, input); err != nil {
+		return fmt.Errorf("sns publish: %w", err)
+	}
+	return nil
+}
+
+// sqsNotifier sends the alerts as JSON to ALERT_SQS_QUEUE_URL.
+type sqsNotifier struct {
+	queueURL string
+	svc      *sqs.SQS
+}
+
+func newSQSNotifier() (Notifier, error) {
+	queueURL := os.Getenv("ALERT_SQS_QUEUE_URL")
+	if queueURL == "" {
+		return nil, fmt.Errorf("ALERT_SQS_QUEUE_URL must be set")
+	}
+	sess, err := newEventSession()
+	if err != nil {
+		return nil, err
+	}
+	return &sqsNotifier{queueURL: queueURL, svc: sqs.New(sess)}, nil
+}
+
+func (s *sqsNotifier) Name() string { return targetSQS }
+
+func (s *sqsNotifier) render(alert Alert) (string, error) {
+	return newAlertEvent(alert).json()
+}
+
+func (s *sqsNotifier) Notify(ctx context.Context, alert Alert) error {
+	message, err := s.render(alert)
+	if err != nil {
+		return err
+	}
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.queueURL),
+		MessageBody: aws.String(message),
+	}
+	if strings.HasSuffix(s.queueURL, ".fifo") {
+		input.MessageGroupId = aws.String(fifoGroup)
+		input.MessageDeduplicationId = aws.String(dedupID(alert.Key))
+	}
+	if _, err := s.svc.SendMessageWithContext(ctx, input); err != nil {
+		return fmt.Errorf("sqs send: %w", err)
+	}
+	return nil
+}
+
+// eventBridgeNotifier puts the alerts on ALERT_EVENT_BUS with the source
+// nftmintalert and detail type "Mint Alert", for rules to route.
+type eventBridgeNotifier struct {
+	bus string
+	svc *eventbridge.EventBridge
+}
+
+func newEventBridgeNotifier() (Notifier, error) {
+	bus := os.Getenv("ALERT_EVENT_BUS")
+	if bus == "" {
+		return nil, fmt.Errorf("ALERT_EVENT_BUS must be set")
+	}
+	sess, err := newEventSession()
+	if err != nil {
+		return nil, err
+	}
+	return &eventBridgeNotifier{bus: bus, svc: eventbridge.New(sess)}, nil
+}
+
+func (e *eventBridgeNotifier) Name() string { return targetEventBridge }
+
+func (e *eventBridgeNotifier) render(alert Alert) (string, error) {
+	return newAlertEvent(alert).json()
+}
+
+func (e *eventBridgeNotifier) Notify(ctx context.Context, alert Alert) error {
+	detail, err := e.render(alert)
+	if err != nil {
+		return err
+	}
+	result, err := e.svc.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{{
+			EventBusName: aws.String(e.bus),
+			Source:       aws.String(alertEventSource),
+			DetailType:   aws.String(alertEventType),
+			Detail:       aws.String(detail),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("eventbridge put: %w", err)
+	}
+	if aws.Int64Value(result.FailedEntryCount) > 0 && len(result.Entries) > 0 {
+		entry := result.Entries[0]
+		return fmt.Errorf("eventbridge put: %v: %v", aws.StringValue(entry.ErrorCode), aws.StringValue(entry.ErrorMessage))
+	}
+	return nil
+}
+
+// dedupID fits the alert key into the 128 characters allowed for a FIFO
+// deduplication id.
+func dedupID(key string) string {
+	if len(key) > 128 {
+		return key[len(key)-128:]
+	}
+	return key
+}
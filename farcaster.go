@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	targetFarcaster = "farcaster"
+	neynarHost      = "https://api.neynar.com"
+	// farcasterMaxBytes is the length limit of a cast's text
+	farcasterMaxBytes = 320
+)
+
+func init() {
+	registerNotifier(targetFarcaster, newFarcasterNotifier)
+}
+
+// farcasterNotifier casts the alerts through the Neynar API, as the account
+// whose managed signer is NEYNAR_SIGNER_UUID. The OpenSea page is embedded
+// so clients show it as a card under the cast.
+type farcasterNotifier struct {
+	apiKey     string
+	signerUUID string
+	channel    string
+	client     *http.Client
+	template   *messageTemplate
+}
+
+type neynarCastRequest struct {
+	SignerUUID string        `json:"signer_uuid"`
+	Text       string        `json:"text"`
+	Embeds     []neynarEmbed `json:"embeds,omitempty"`
+	ChannelID  string        `json:"channel_id,omitempty"`
+}
+
+type neynarEmbed struct {
+	URL string `json:"url"`
+}
+
+type neynarCastResponse struct {
+	Success bool `json:"success"`
+	Cast    struct {
+		Hash string `json:"hash"`
+	} `json:"cast"`
+	Message string `json:"message"`
+}
+
+func newFarcasterNotifier() (Notifier, error) {
+	f := &farcasterNotifier{
+		apiKey:     os.Getenv("NEYNAR_API_KEY"),
+		signerUUID: os.Getenv("NEYNAR_SIGNER_UUID"),
+		channel:    os.Getenv("FARCASTER_CHANNEL"),
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+	if f.apiKey == "" || f.signerUUID == "" {
+		return nil, fmt.Errorf("NEYNAR_API_KEY and NEYNAR_SIGNER_UUID must be set")
+	}
+	template, err := loadMessageTemplate(targetFarcaster)
+	if err != nil {
+		return nil, err
+	}
+	f.template = template
+	return f, nil
+}
+
+func (f *farcasterNotifier) Name() string { return targetFarcaster }
+
+// castText is the built in cast for the alert. The link is embedded rather
+// than written out to leave room in the cast.
+func castText(alert Alert) string {
+	return fmt.Sprintf("%v%v: %v %v%v%v in %v minutes\n\n%v", alert.headline(), chainTag(alert.Chain), alert.Count, alert.action(), alert.mintersText(), alert.priceText(), alert.minutes(), alert.Collection.Name)
+}
+
+func (f *farcasterNotifier) render(alert Alert) (string, error) {
+	return f.template.text(alert, castText)
+}
+
+func (f *farcasterNotifier) Notify(ctx context.Context, alert Alert) error {
+	text, err := f.render(alert)
+	if err != nil {
+		return err
+	}
+	cast := neynarCastRequest{
+		SignerUUID: f.signerUUID,
+		Text:       truncateBytes(text, farcasterMaxBytes),
+		Embeds:     []neynarEmbed{{URL: openseaLink(alert.Collection)}},
+		ChannelID:  f.channel,
+	}
+	buf, err := json.Marshal(cast)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, neynarHost+"/v2/farcaster/cast", bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("farcaster cast: request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("x-api-key", f.apiKey)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("farcaster cast response: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("farcaster cast response read: %w", err)
+	}
+	result := &neynarCastResponse{}
+	if err := json.Unmarshal(respBytes, result); err != nil {
+		return fmt.Errorf("farcaster cast status %v", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || !result.Success {
+		return fmt.Errorf("farcaster cast status %v: %v", resp.StatusCode, result.Message)
+	}
+	slog.Info("Cast sent", "channel", targetFarcaster, "contract", alert.Contract, "cast_hash", result.Cast.Hash)
+	return nil
+}
+
+// truncateBytes shortens the text to at most max bytes without splitting a
+// character, ending it with an ellipsis when it is cut.
+func truncateBytes(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(text[:cut]) + ellipsis
+}
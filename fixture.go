@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"nftmintalert/opensea"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	fixtureLogs  = "logs.json"
+	fixtureChain = "chain"
+	// fixtureCooling lists the collections in their cool-down when the run
+	// was recorded and fixtureAlerts the alerts it posted
+	fixtureCooling = "cooling.json"
+	fixtureAlerts  = "alerts.json"
+)
+
+// fixtureAlert is an alert a recorded run is expected to replay.
+type fixtureAlert struct {
+	Kind     string `json:"kind,omitempty"`
+	Contract string `json:"contract"`
+	Count    int    `json:"count"`
+	Tier     string `json:"tier,omitempty"`
+}
+
+func (f fixtureAlert) String() string {
+	kind := f.Kind
+	if kind == "" {
+		kind = alertKindMint
+	}
+	return fmt.Sprintf("%v %v x%v (%v)", kind, f.Contract, f.Count, f.Tier)
+}
+
+// fixtureStore reads and writes the raw inputs of a run (the transfer logs
+// and the OpenSea responses) so the run can be replayed. The location is
+// either s3://bucket/prefix or a local directory.
+type fixtureStore struct {
+	sess   *session.Session
+	bucket string
+	dir    string
+}
+
+// newFixtureStore returns a store for recording the run into a sub folder of
+// location.
+func newFixtureStore(sess *session.Session, location string, run string) *fixtureStore {
+	store := openFixtureStore(sess, location)
+	store.dir = path.Join(store.dir, run)
+	slog.Info("Recording run", "location", store.String())
+	return store
+}
+
+// openFixtureStore returns a store for a recorded run.
+func openFixtureStore(sess *session.Session, location string) *fixtureStore {
+	if strings.HasPrefix(location, "s3://") {
+		parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+		store := &fixtureStore{sess: sess, bucket: parts[0]}
+		if len(parts) > 1 {
+			store.dir = strings.Trim(parts[1], "/")
+		}
+		return store
+	}
+	return &fixtureStore{dir: location}
+}
+
+func (f *fixtureStore) String() string {
+	if f.bucket != "" {
+		return fmt.Sprintf("s3://%v/%v", f.bucket, f.dir)
+	}
+	return f.dir
+}
+
+func (f *fixtureStore) write(name string, data []byte) error {
+	if f.bucket == "" {
+		file := filepath.Join(f.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, data, 0644)
+	}
+	svc := s3.New(f.sess)
+	_, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(path.Join(f.dir, name)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (f *fixtureStore) read(name string) ([]byte, error) {
+	if f.bucket == "" {
+		return ioutil.ReadFile(filepath.Join(f.dir, filepath.FromSlash(name)))
+	}
+	svc := s3.New(f.sess)
+	result, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(path.Join(f.dir, name)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+	return ioutil.ReadAll(result.Body)
+}
+
+func (f *fixtureStore) writeLogs(logs []types.Log) {
+	buf, err := json.Marshal(logs)
+	if err == nil {
+		err = f.write(fixtureLogs, buf)
+	}
+	if err != nil {
+		slog.Error("Error recording logs", "error", err)
+	}
+}
+
+// writeChain records the chain the logs were read from.
+func (f *fixtureStore) writeChain(chain string) {
+	if err := f.write(fixtureChain, []byte(chain)); err != nil {
+		slog.Error("Error recording chain", "error", err)
+	}
+}
+
+// readChain returns the chain of a recorded run. Runs recorded before
+// multi-chain support are Ethereum.
+func (f *fixtureStore) readChain() string {
+	buf, err := f.read(fixtureChain)
+	if err != nil || len(bytes.TrimSpace(buf)) == 0 {
+		return chainEthereum
+	}
+	return string(bytes.TrimSpace(buf))
+}
+
+func (f *fixtureStore) writeJSON(name string, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err == nil {
+		err = f.write(name, buf)
+	}
+	if err != nil {
+		slog.Error("Error recording run", "name", name, "error", err)
+	}
+}
+
+// writeAlerts records the alerts of the chain archived by the run.
+func (f *fixtureStore) writeAlerts(chain string, records []archiveRecord) {
+	alerts := []fixtureAlert{}
+	for _, record := range records {
+		if record.Chain == chain {
+			alerts = append(alerts, fixtureAlert{Kind: record.Kind, Contract: record.Contract, Count: record.Count, Tier: record.Tier})
+		}
+	}
+	f.writeJSON(fixtureAlerts, alerts)
+}
+
+// readAlerts returns the expected alerts, or nil when the run was recorded
+// without them.
+func (f *fixtureStore) readAlerts() []fixtureAlert {
+	buf, err := f.read(fixtureAlerts)
+	if err != nil {
+		return nil
+	}
+	alerts := []fixtureAlert{}
+	if err := json.Unmarshal(buf, &alerts); err != nil {
+		slog.Error("Error reading recorded alerts", "error", err)
+		return nil
+	}
+	return alerts
+}
+
+// writeCooling records the collections in their cool-down, which the replay
+// has to skip like the run did.
+func (f *fixtureStore) writeCooling(status *Status, cooldown time.Duration) {
+	cooling := []string{}
+	for recent := range status.Posted {
+		if status.recentlyPosted(recent, cooldown) {
+			cooling = append(cooling, recent)
+		}
+	}
+	sort.Strings(cooling)
+	f.writeJSON(fixtureCooling, cooling)
+}
+
+// readCooling returns the collections in their cool-down at the recording.
+func (f *fixtureStore) readCooling() []string {
+	var cooling []string
+	if buf, err := f.read(fixtureCooling); err == nil {
+		json.Unmarshal(buf, &cooling)
+	}
+	return cooling
+}
+
+func (f *fixtureStore) readLogs() ([]types.Log, error) {
+	buf, err := f.read(fixtureLogs)
+	if err != nil {
+		return nil, err
+	}
+	var logs []types.Log
+	err = json.Unmarshal(buf, &logs)
+	return logs, err
+}
+
+// recordingSource records the OpenSea responses, including errors, as they
+// are looked up.
+type recordingSource struct {
+	next  collectionSource
+	store *fixtureStore
+}
+
+func (r *recordingSource) ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error) {
+	collection, err := r.next.ChainAssetContract(ctx, chain, id)
+	r.record("opensea/"+id, collection, err)
+	return collection, err
+}
+
+func (r *recordingSource) Stats(ctx context.Context, slug string) (*opensea.Stats, error) {
+	stats, err := r.next.Stats(ctx, slug)
+	r.record("opensea/stats/"+slug, stats, err)
+	return stats, err
+}
+
+func (r *recordingSource) Events(ctx context.Context, slug string, query opensea.EventsQuery) (*opensea.Events, error) {
+	events, err := r.next.Events(ctx, slug, query)
+	r.record(eventsFixture(slug, query), events, err)
+	return events, err
+}
+
+// eventsFixture names a page of recorded events. The pages are told apart
+// by their cursor, as the time range moves with the replay.
+func eventsFixture(slug string, query opensea.EventsQuery) string {
+	name := "opensea/events/" + slug
+	if query.Next != "" {
+		sum := sha256.Sum256([]byte(query.Next))
+		name += "-" + hex.EncodeToString(sum[:8])
+	}
+	return name
+}
+
+// record writes the response to name.json or the error to name.error.
+func (r *recordingSource) record(name string, v interface{}, err error) {
+	if err != nil {
+		if werr := r.store.write(name+".error", []byte(err.Error())); werr != nil {
+			slog.Error("Error recording OpenSea error", "name", name, "error", werr)
+		}
+		return
+	}
+	buf, err := json.Marshal(v)
+	if err == nil {
+		err = r.store.write(name+".json", buf)
+	}
+	if err != nil {
+		slog.Error("Error recording OpenSea response", "name", name, "error", err)
+	}
+}
+
+// replaySource returns the recorded OpenSea responses.
+type replaySource struct {
+	store *fixtureStore
+}
+
+func (r *replaySource) ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error) {
+	collection := &opensea.OpenSeaCollection{}
+	if err := r.replay("opensea/"+id, collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func (r *replaySource) Stats(ctx context.Context, slug string) (*opensea.Stats, error) {
+	stats := &opensea.Stats{}
+	if err := r.replay("opensea/stats/"+slug, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (r *replaySource) Events(ctx context.Context, slug string, query opensea.EventsQuery) (*opensea.Events, error) {
+	events := &opensea.Events{}
+	if err := r.replay(eventsFixture(slug, query), events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// replay decodes the response recorded under name into v, or returns the
+// recorded error.
+func (r *replaySource) replay(name string, v interface{}) error {
+	buf, err := r.store.read(name + ".json")
+	if err != nil {
+		if msg, rerr := r.store.read(name + ".error"); rerr == nil {
+			return errors.New(string(msg))
+		}
+		return fmt.Errorf("no recorded OpenSea response for %v: %w", name, err)
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// replayFixture runs a recorded run through the pipeline on the in-memory
+// chain, state store and notifier. The alerts are logged and compared with
+// the recorded ones, nothing is posted and the status file is not touched.
+// It reports whether the replay matched.
+func replayFixture(ctx context.Context, location string) bool {
+	summary := newRunSummary()
+	defer summary.log()
+
+	var sess *session.Session
+	if strings.HasPrefix(location, "s3://") {
+		var err error
+		sess, err = session.NewSession(&aws.Config{
+			Region: aws.String("us-east-1"),
+		})
+		if err != nil {
+			summary.fail("Unable to create a new session %v", err)
+			return false
+		}
+	}
+	store := openFixtureStore(sess, location)
+	slog.Info("Replaying run", "location", store.String())
+	name := store.readChain()
+	chain, ok := knownChains[name]
+	if !ok {
+		summary.fail("Unknown chain %q in the recorded run", name)
+		return false
+	}
+	chain.Name = name
+	exclude, err := chainExclusions(name, "")
+	if err != nil {
+		summary.fail("%v", err)
+		return false
+	}
+	chain.Exclude = exclude
+	logs, err := store.readLogs()
+	if err != nil {
+		summary.fail("Unable to read recorded logs: %v", err)
+		return false
+	}
+	// scan from the first recorded block, however far behind the run was
+	checkpoint := uint64(0)
+	for _, txLog := range logs {
+		if checkpoint == 0 || txLog.BlockNumber-1 < checkpoint {
+			checkpoint = txLog.BlockNumber - 1
+		}
+	}
+	chain.MaxCatchup = math.MaxUint64
+	tiers, err := loadTiers()
+	if err != nil {
+		summary.fail("%v", err)
+		return false
+	}
+	lists, err := loadContractLists()
+	if err != nil {
+		summary.fail("%v", err)
+		return false
+	}
+	lists.exclude([]Chain{chain})
+	client := newMemoryChain(logs)
+	counter, toBlock, err := scanChain(ctx, client, chain, checkpoint, nil, summary, nil)
+	if err != nil {
+		summary.fail("Unable to scan the recorded logs: %v", err)
+		return false
+	}
+	summary.Blocks = append(summary.Blocks, fmt.Sprintf("%v ..%v", chain.Name, toBlock))
+
+	notifier := &memoryNotifier{}
+	state := &memoryStore{}
+	status := state.load()
+	for _, recent := range store.readCooling() {
+		status.markPosted(recent)
+	}
+	alerts := &alerter{
+		osclient: &replaySource{store: store},
+		targets: &notifiers{
+			public: []Notifier{notifier},
+			canary: []Notifier{notifier},
+			usage:  &summary.Usage,
+			routes: map[string]route{},
+		},
+		summary:      summary,
+		budget:       newTimeBudget(ctx),
+		canary:       getCanaryConfig(),
+		tiers:        tiers,
+		minutes:      windowMinutes(),
+		cooldown:     alertCooldown(),
+		filter:       getStatsFilter(),
+		safelist:     getSafelistFilter(),
+		lists:        lists,
+		minterFilter: getMinterFilter(),
+		events:       newEventReader(),
+		scorer:       newScorer(),
+		tokens:       getTokenFilter(),
+	}
+	// the lookups run one at a time so the replay posts in a fixed order
+	alerts.postChain(ctx, &status, client, chain, counter, toBlock, func() { state.save(status) })
+
+	var replayed []fixtureAlert
+	for _, alert := range notifier.posted() {
+		slog.Info("Replayed alert", "chain", alert.Chain, "contract", alert.Contract, "count", alert.Count, "tier", alert.Tier, "text", logText(alert))
+		replayed = append(replayed, fixtureAlert{Kind: alert.Kind, Contract: alert.Contract, Count: alert.Count, Tier: alert.Tier})
+	}
+	if expected := store.readAlerts(); expected != nil {
+		for _, diff := range diffAlerts(expected, replayed) {
+			summary.addError("Replay differs from the recording: %v", diff)
+		}
+	}
+	return !summary.Failed && len(summary.Errors) == 0
+}
+
+// diffAlerts lists the differences between the recorded and the replayed
+// alerts.
+func diffAlerts(expected []fixtureAlert, replayed []fixtureAlert) []string {
+	key := func(a fixtureAlert) string { return a.Kind + ":" + strings.ToLower(a.Contract) }
+	got := make(map[string]fixtureAlert)
+	for _, alert := range replayed {
+		got[key(alert)] = alert
+	}
+	var diffs []string
+	for _, want := range expected {
+		alert, ok := got[key(want)]
+		delete(got, key(want))
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("missing %v", want))
+		case alert != want:
+			diffs = append(diffs, fmt.Sprintf("expected %v, got %v", want, alert))
+		}
+	}
+	for _, alert := range replayed {
+		if _, ok := got[key(alert)]; ok {
+			diffs = append(diffs, fmt.Sprintf("unexpected %v", alert))
+		}
+	}
+	return diffs
+}
+
+// runReplay replays the recorded runs given on the command line and exits
+// with 1 if any of them no longer posts the recorded alerts, so a set of
+// recordings can be kept as a regression suite.
+func runReplay(ctx context.Context, locations []string) int {
+	if len(locations) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: nftmintalert replay <recording>...")
+		return 2
+	}
+	code := 0
+	for _, location := range locations {
+		if !replayFixture(ctx, location) {
+			code = 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const chainEthereum = "ethereum"
+const sentKeyRetention = 48 * time.Hour
+const defaultAlertCooldownHours = 24
+
+// alertKey identifies an alert for a contract in a block window. Every run
+// over the same window produces the same key, so it can be used to make
+// posting idempotent.
+func alertKey(chain string, contract string, toBlock uint64, blockWindow uint64) string {
+	if blockWindow == 0 {
+		blockWindow = newBlocks
+	}
+	window := toBlock / blockWindow
+	return fmt.Sprintf("%v:%v:%v", chain, strings.ToLower(contract), window)
+}
+
+// claimKey records the idempotency key for a post. It returns false if the
+// key was already recorded by an earlier run.
+func (s *Status) claimKey(key string) bool {
+	if s.claimer != nil {
+		claimed, err := s.claimer(key)
+		if err == nil {
+			return claimed
+		}
+		slog.Error("Error claiming the alert key, falling back to the status file", "key", key, "error", err)
+	}
+	if s.Sent == nil {
+		s.Sent = make(map[string]time.Time)
+	}
+	if _, ok := s.Sent[key]; ok {
+		return false
+	}
+	s.Sent[key] = time.Now()
+	return true
+}
+
+// trimSent removes idempotency keys that are too old to be repeated.
+func (s *Status) trimSent() {
+	for key, sent := range s.Sent {
+		if time.Since(sent) > sentKeyRetention {
+			delete(s.Sent, key)
+		}
+	}
+}
+
+// alertCooldown is how long a collection is not alerted again after it is
+// posted, from ALERT_COOLDOWN_HOURS.
+func alertCooldown() time.Duration {
+	hours := envInt("ALERT_COOLDOWN_HOURS", defaultAlertCooldownHours)
+	if hours < 1 {
+		slog.Warn("ALERT_COOLDOWN_HOURS must be at least 1", "using", defaultAlertCooldownHours)
+		hours = defaultAlertCooldownHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// recentlyPosted reports whether the collection was alerted within the
+// cool-down.
+func (s *Status) recentlyPosted(key string, cooldown time.Duration) bool {
+	posted, ok := s.Posted[key]
+	return ok && time.Since(posted) < cooldown
+}
+
+func (s *Status) markPosted(key string) {
+	if s.Posted == nil {
+		s.Posted = make(map[string]time.Time)
+	}
+	s.Posted[key] = time.Now()
+}
+
+// trimPosted removes the collections whose cool-down is over.
+func (s *Status) trimPosted(cooldown time.Duration) {
+	for key, posted := range s.Posted {
+		if time.Since(posted) >= cooldown {
+			delete(s.Posted, key)
+		}
+	}
+}
+
+// migrateRecents moves the collections in the old Recents list into Posted.
+// Their post times were not kept, so their cool-down starts now.
+func (s *Status) migrateRecents() {
+	for _, recent := range s.Recents {
+		if recent == "" {
+			continue
+		}
+		if _, ok := s.Posted[recent]; !ok {
+			s.markPosted(recent)
+		}
+	}
+	s.Recents = nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// contractLists are the operator managed blocklist and allowlist. Blocked
+// contracts are never counted or alerted. Allowed contracts are alerted
+// once they have more than ALLOWLIST_THRESHOLD mints, even below the lowest
+// tier and without the usual call out criteria and stats filters.
+type contractLists struct {
+	block          map[common.Address]bool
+	allow          map[common.Address]bool
+	allowThreshold int
+}
+
+// loadContractLists reads the lists from BLOCKLIST and ALLOWLIST, plus the
+// local files or s3://bucket/key locations in BLOCKLIST_FILE and
+// ALLOWLIST_FILE.
+func loadContractLists() (contractLists, error) {
+	lists := contractLists{allowThreshold: envInt("ALLOWLIST_THRESHOLD", 0)}
+	var err error
+	if lists.block, err = loadContractList("BLOCKLIST"); err != nil {
+		return lists, err
+	}
+	if lists.allow, err = loadContractList("ALLOWLIST"); err != nil {
+		return lists, err
+	}
+	return lists, nil
+}
+
+// loadContractList reads the addresses in the name variable and the
+// name_FILE file. The file lists the addresses separated by commas or new
+// lines, and # starts a comment.
+func loadContractList(name string) (map[common.Address]bool, error) {
+	entries := []string{os.Getenv(name)}
+	if file := os.Getenv(name + "_FILE"); file != "" {
+		buf, err := readConfigFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%v_FILE: %w", name, err)
+		}
+		for _, line := range strings.Split(string(buf), "\n") {
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			entries = append(entries, line)
+		}
+	}
+	addresses, err := parseAddresses(strings.Join(entries, ","))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+	list := make(map[common.Address]bool)
+	for _, address := range addresses {
+		list[address] = true
+	}
+	return list, nil
+}
+
+// exclude adds the blocklist to the contracts each chain never counts.
+func (l contractLists) exclude(chains []Chain) {
+	for _, chain := range chains {
+		for address := range l.block {
+			chain.Exclude[address] = true
+		}
+	}
+}
+
+func (l contractLists) blocked(contract string) bool {
+	return l.block[common.HexToAddress(contract)]
+}
+
+func (l contractLists) allowed(contract string) bool {
+	return l.allow[common.HexToAddress(contract)]
+}
+
+// callOut applies the lists to the call out decision for the contract.
+func (l contractLists) callOut(contract string, result bool) bool {
+	if l.blocked(contract) {
+		return false
+	}
+	return result || l.allowed(contract)
+}
+
+// tierFor returns the tier the count qualifies for. Allowed contracts get the
+// lowest tier once they pass ALLOWLIST_THRESHOLD.
+func (l contractLists) tierFor(tiers []alertTier, contract string, count int) *alertTier {
+	if l.blocked(contract) {
+		return nil
+	}
+	if tier := tierFor(tiers, count); tier != nil {
+		return tier
+	}
+	if l.allowed(contract) && count > l.allowThreshold && len(tiers) > 0 {
+		return &tiers[len(tiers)-1]
+	}
+	return nil
+}
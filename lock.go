@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultLockLeaseSeconds outlasts the longest Lambda invocation
+	defaultLockLeaseSeconds = 900
+	dynamoLockKey           = "lock"
+	lockTimeout             = 10 * time.Second
+)
+
+// errLocked is returned when another run holds the lock.
+var errLocked = errors.New("another run holds the lock")
+
+// runLock is an advisory lock that keeps overlapping runs from reading the
+// same status and posting the same alerts. The lease ends on its own when a
+// run dies without releasing it.
+type runLock interface {
+	// acquire takes the lock for the lease or returns errLocked
+	acquire(ctx context.Context) error
+	release(ctx context.Context) error
+}
+
+// newRunLock returns the lock kept next to the status by STATE_BACKEND, or
+// nil when LOCK_LEASE_SECONDS is 0.
+func newRunLock(sess *session.Session, s3bucket string, s3key string) (runLock, error) {
+	lease := time.Duration(envInt("LOCK_LEASE_SECONDS", defaultLockLeaseSeconds)) * time.Second
+	if lease <= 0 {
+		return nil, nil
+	}
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, err
+	}
+	switch backend := os.Getenv("STATE_BACKEND"); backend {
+	case "", stateBackendS3:
+		return &s3Lock{svc: s3.New(sess), bucket: s3bucket, key: s3key + ".lock", owner: owner, lease: lease}, nil
+	case stateBackendDynamoDB:
+		return &dynamoLock{svc: dynamodb.New(sess), table: os.Getenv("DYNAMODB_TABLE"), owner: owner, lease: lease}, nil
+	case stateBackendRedis:
+		store, err := newRedisStore(os.Getenv("REDIS_URL"), envString("REDIS_PREFIX", defaultRedisPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return &redisLock{client: store.client, key: store.key("lock"), owner: owner, lease: lease}, nil
+	default:
+		return nil, fmt.Errorf("unknown STATE_BACKEND %q", backend)
+	}
+}
+
+// lockOwner identifies the run holding the lock, so a run only releases its
+// own lock.
+func lockOwner() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// lease is the content of the S3 lock object.
+type lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// s3Lock is an object next to the status file, created only if it does not
+// exist. An expired lock is overwritten on the condition that it is still
+// the one read, so of two runs taking it over only one succeeds.
+type s3Lock struct {
+	svc    *s3.S3
+	bucket string
+	key    string
+	owner  string
+	lease  time.Duration
+}
+
+// read returns the current lease and the ETag of the lock object, or nil
+// when there is no lock.
+func (l *s3Lock) read(ctx context.Context) (*lease, *string, error) {
+	result, err := l.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(l.key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer result.Body.Close()
+	body, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var current lease
+	if err := json.Unmarshal(body, &current); err != nil {
+		return nil, nil, fmt.Errorf("s3 lock %v: %w", l.key, err)
+	}
+	return &current, result.ETag, nil
+}
+
+func (l *s3Lock) acquire(ctx context.Context) error {
+	current, etag, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(lease{Owner: l.owner, Expires: time.Now().Add(l.lease)})
+	if err != nil {
+		return err
+	}
+	// PutObjectInput has no fields for the conditional write headers in
+	// this SDK, they are set on the request
+	condition := map[string]string{"If-None-Match": "*"}
+	if current != nil {
+		if time.Now().Before(current.Expires) {
+			return fmt.Errorf("%w until %v", errLocked, current.Expires.Format(time.RFC3339))
+		}
+		// the run holding it died, take over the lease unless another run
+		// already has
+		condition = map[string]string{"If-Match": aws.StringValue(etag)}
+	}
+	_, err = l.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(l.key),
+		Body:   bytes.NewReader(buf),
+	}, request.WithSetRequestHeaders(condition))
+	if conditionFailed(err) {
+		return errLocked
+	}
+	return err
+}
+
+// conditionFailed reports whether a conditional write lost to another run.
+func conditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && (aerr.Code() == "PreconditionFailed" || aerr.Code() == "ConditionalRequestConflict")
+}
+
+func (l *s3Lock) release(ctx context.Context) error {
+	current, etag, err := l.read(ctx)
+	if err != nil || current == nil || current.Owner != l.owner {
+		// taken over after the lease ran out
+		return err
+	}
+	// the lease can run out and be taken over after the read, only delete
+	// the lock that was read
+	_, err = l.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(l.key),
+	}, request.WithSetRequestHeaders(map[string]string{"If-Match": aws.StringValue(etag)}))
+	if conditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// dynamoLock is an item of the state table written on the condition that
+// no unexpired lock exists.
+type dynamoLock struct {
+	svc   *dynamodb.DynamoDB
+	table string
+	owner string
+	lease time.Duration
+}
+
+func (l *dynamoLock) acquire(ctx context.Context) error {
+	now := time.Now()
+	item := dynamoKey(dynamoLockKey, dynamoLockKey)
+	item["owner"] = &dynamodb.AttributeValue{S: aws.String(l.owner)}
+	item["expires"] = dynamoNumber(now.Add(l.lease).Unix())
+	_, err := l.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(l.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expires < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": dynamoNumber(now.Unix()),
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errLocked
+	}
+	return err
+}
+
+func (l *dynamoLock) release(ctx context.Context) error {
+	_, err := l.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(l.table),
+		Key:                 dynamoKey(dynamoLockKey, dynamoLockKey),
+		ConditionExpression: aws.String("#owner = :owner"),
+		// owner is a reserved word
+		ExpressionAttributeNames: map[string]*string{"#owner": aws.String("owner")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(l.owner)},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
+
+// redisReleaseScript deletes the lock only while the run still owns it.
+var redisReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// redisLock is a key set with NX that expires with the lease.
+type redisLock struct {
+	client *redis.Client
+	key    string
+	owner  string
+	lease  time.Duration
+}
+
+func (l *redisLock) acquire(ctx context.Context) error {
+	acquired, err := l.client.SetNX(ctx, l.key, l.owner, l.lease).Result()
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return errLocked
+	}
+	return nil
+}
+
+func (l *redisLock) release(ctx context.Context) error {
+	return redisReleaseScript.Run(ctx, l.client, []string{l.key}, l.owner).Err()
+}
+
+// lockRun takes the run lock. It returns the function releasing it, or an
+// error when the lock is held or can't be taken.
+func lockRun(sess *session.Session, s3bucket string, s3key string) (func(), error) {
+	lock, err := newRunLock(sess, s3bucket, s3key)
+	if err != nil || lock == nil {
+		return func() {}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	if err := lock.acquire(ctx); err != nil {
+		return func() {}, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+		defer cancel()
+		if err := lock.release(ctx); err != nil {
+			// the lease runs out on its own
+			slog.Warn("Unable to release the run lock", "error", err)
+		}
+	}, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Object is a bucket holding one object, with the conditional writes and
+// deletes of S3.
+type s3Object struct {
+	mu      sync.Mutex
+	body    []byte
+	version int
+	// beforeDelete runs as a delete comes in
+	beforeDelete func()
+}
+
+func (o *s3Object) etag() string { return fmt.Sprintf(`"%v"`, o.version) }
+
+func (o *s3Object) put(body []byte) {
+	o.body = body
+	o.version++
+}
+
+func (o *s3Object) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if r.Method == http.MethodDelete && o.beforeDelete != nil {
+		o.beforeDelete()
+	}
+	if match := r.Header.Get("If-Match"); match != "" && (o.body == nil || match != o.etag()) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		fmt.Fprint(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if o.body == nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		w.Header().Set("ETag", o.etag())
+		w.Write(o.body)
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && o.body != nil {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		o.put(body)
+		w.Header().Set("ETag", o.etag())
+	case http.MethodDelete:
+		o.body = nil
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testS3Lock(t *testing.T, object *s3Object, owner string) *s3Lock {
+	srv := httptest.NewServer(object)
+	t.Cleanup(srv.Close)
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	}))
+	return &s3Lock{svc: s3.New(sess), bucket: "bucket", key: "status.json.lock", owner: owner, lease: time.Minute}
+}
+
+func TestS3Lock(t *testing.T) {
+	ctx := context.Background()
+	object := &s3Object{}
+	first := testS3Lock(t, object, "first")
+	second := testS3Lock(t, object, "second")
+
+	if err := first.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.acquire(ctx); err == nil {
+		t.Error("a second run took the lock")
+	}
+	if err := first.release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if object.body != nil {
+		t.Error("the lock was not released")
+	}
+	if err := second.acquire(ctx); err != nil {
+		t.Errorf("the released lock was not taken: %v", err)
+	}
+}
+
+func TestS3LockReleaseTakenOver(t *testing.T) {
+	ctx := context.Background()
+	object := &s3Object{}
+	first := testS3Lock(t, object, "first")
+	if err := first.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the lease runs out and another run takes the lock over between the
+	// read and the delete of the release
+	object.beforeDelete = func() {
+		taken, _ := json.Marshal(lease{Owner: "second", Expires: time.Now().Add(time.Minute)})
+		object.put(taken)
+	}
+
+	if err := first.release(ctx); err != nil {
+		t.Errorf("release of a lock taken over: %v", err)
+	}
+	if object.body == nil {
+		t.Error("the release deleted the lock of the run that took it over")
+	}
+}
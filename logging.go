@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// configureLogging sets up the default slog logger. LOG_LEVEL is debug,
+// info, warn or error (DEBUG=true still turns on debug), and LOG_FORMAT is
+// text or json. JSON is the default in Lambda so the fields can be queried
+// in CloudWatch Logs Insights. The log package is routed through the same
+// logger at the info level.
+func configureLogging() {
+	level := slog.LevelInfo
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	if envBool("DEBUG") {
+		level = slog.LevelDebug
+	}
+	format := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	if format == "" && os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		format = "json"
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	slog.Debug("Debug logging enabled")
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	filterLogsAttempts   = 5
+	filterLogsBackoff    = time.Second
+	filterLogsMaxBackoff = 16 * time.Second
+
+	defaultLogChunkBlocks = 10
+	defaultLogConcurrency = 4
+
+	// scanModeBlocks scans block by block, using the bloom filters to skip
+	// the blocks without transfers
+	scanModeBlocks = "blocks"
+)
+
+// rateLimitCodes are the JSON-RPC error codes the providers throttle with:
+// -32005 is the EIP-1474 limit exceeded, and Alchemy answers 429.
+var rateLimitCodes = map[int]bool{-32005: true, http.StatusTooManyRequests: true}
+
+// tooManyResultsMessages are how the providers say a query has to cover fewer
+// blocks, e.g. Infura's -32005 "query returned more than 10000 results" and
+// Alchemy's "Log response size exceeded".
+var tooManyResultsMessages = []string{"query returned more than", "response size exceeded", "block range", "range too large", "too many results"}
+
+// isRateLimited reports whether an RPC error is the provider throttling us,
+// from the HTTP status or the JSON-RPC error code, or failing those the
+// message. The message is only matched on words, as the numbers in it can be
+// block numbers or hashes.
+func isRateLimited(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rateLimitCodes[rpcErr.ErrorCode()] && !hasTooManyResultsMessage(err) {
+		// -32005 is also how Infura says the query returned too many logs
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"rate limit", "too many requests", "capacity exceeded", "compute units"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTooManyResults reports whether an RPC error means the query range has to
+// be made smaller. Infura and Alchemy both cap the number of logs returned.
+// Splitting a throttled query only makes more requests, so a rate limit is
+// never too many results.
+func isTooManyResults(err error) bool {
+	return !isRateLimited(err) && hasTooManyResultsMessage(err)
+}
+
+func hasTooManyResultsMessage(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range tooManyResultsMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLogs runs the query, backing off when rate limited and splitting the
+// block range in half when the provider says the result is too large.
+func filterLogs(ctx context.Context, client chainClient, query ethereum.FilterQuery, usage *UsageCounts) ([]types.Log, error) {
+	logs, err := filterLogsWithBackoff(ctx, client, query, usage)
+	if err == nil || !isTooManyResults(err) {
+		return logs, err
+	}
+	from := query.FromBlock.Uint64()
+	to := query.ToBlock.Uint64()
+	if to <= from {
+		// a single block can't be split any further
+		return nil, err
+	}
+	mid := from + (to-from)/2
+	slog.Info("Too many results, splitting the blocks", "from_block", from, "to_block", to, "split_block", mid)
+
+	first := query
+	first.ToBlock = new(big.Int).SetUint64(mid)
+	logs, err = filterLogs(ctx, client, first, usage)
+	if err != nil {
+		return nil, err
+	}
+	second := query
+	second.FromBlock = new(big.Int).SetUint64(mid + 1)
+	more, err := filterLogs(ctx, client, second, usage)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, more...), nil
+}
+
+func filterLogsWithBackoff(ctx context.Context, client chainClient, query ethereum.FilterQuery, usage *UsageCounts) ([]types.Log, error) {
+	backoff := filterLogsBackoff
+	for attempt := 1; ; attempt++ {
+		usage.RPC++
+		logs, err := client.FilterLogs(ctx, query)
+		if err == nil || !isRateLimited(err) || attempt == filterLogsAttempts {
+			return logs, err
+		}
+		slog.Warn("Rate limited querying blocks", "from_block", query.FromBlock.Uint64(), "to_block", query.ToBlock.Uint64(),
+			"attempt", attempt, "attempts", filterLogsAttempts, "wait", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("rate limited: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > filterLogsMaxBackoff {
+			backoff = filterLogsMaxBackoff
+		}
+	}
+}
+
+// chunkResult is the outcome of querying a chunk of blocks.
+type chunkResult struct {
+	index int
+	logs  []types.Log
+	err   error
+	usage UsageCounts
+}
+
+// filterLogsChunked splits the query's block range into chunks of
+// LOG_CHUNK_BLOCKS and queries them on LOG_QUERY_CONCURRENCY workers. The
+// chunks' logs are passed to handle in block order, one chunk at a time, as
+// soon as the chunks before them are in; the few that arrive early are held
+// until then. A chunk that fails is tried once more on its own. If it still
+// fails it is reported and the scan stops there: the chunks after it are not
+// handled, so they are counted once, on the next run. It returns the last
+// block handled, and fails when no chunk could be read or ctx is done.
+func filterLogsChunked(ctx context.Context, client chainClient, query ethereum.FilterQuery, summary *RunSummary, handle func([]types.Log)) (uint64, error) {
+	chunkBlocks := uint64(envInt("LOG_CHUNK_BLOCKS", defaultLogChunkBlocks))
+	concurrency := envInt("LOG_QUERY_CONCURRENCY", defaultLogConcurrency)
+	if chunkBlocks < 1 {
+		chunkBlocks = 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var chunks []ethereum.FilterQuery
+	for from := query.FromBlock.Uint64(); from <= query.ToBlock.Uint64(); from += chunkBlocks {
+		to := from + chunkBlocks - 1
+		if to > query.ToBlock.Uint64() {
+			to = query.ToBlock.Uint64()
+		}
+		chunk := query
+		chunk.FromBlock = new(big.Int).SetUint64(from)
+		chunk.ToBlock = new(big.Int).SetUint64(to)
+		chunks = append(chunks, chunk)
+	}
+	slog.Info("Querying logs", "chunks", len(chunks), "chunk_blocks", chunkBlocks, "concurrency", concurrency)
+
+	// At most window chunks are queried or waiting to be handled at once,
+	// which bounds the logs held and keeps both channels from filling up.
+	window := 2 * concurrency
+	jobs := make(chan int, window)
+	results := make(chan chunkResult, window)
+	scanCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := chunkResult{index: i}
+				if result.err = scanCtx.Err(); result.err == nil {
+					result.logs, result.err = filterLogs(scanCtx, client, chunks[i], &result.usage)
+				}
+				results <- result
+			}
+		}()
+	}
+
+	pending := make(map[int]chunkResult)
+	next, sent := 0, 0
+	var gap error
+scan:
+	for next < len(chunks) {
+		for sent < len(chunks) && sent < next+window {
+			jobs <- sent
+			sent++
+		}
+		result := <-results
+		summary.Usage.add(result.usage)
+		pending[result.index] = result
+		for ; next < len(chunks); next++ {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if result.err != nil && ctx.Err() == nil {
+				slog.Info("Retrying blocks", "from_block", chunks[next].FromBlock.Uint64(), "to_block", chunks[next].ToBlock.Uint64(), "error", result.err)
+				result.logs, result.err = filterLogs(ctx, client, chunks[next], &summary.Usage)
+			}
+			if result.err != nil {
+				gap = result.err
+				break scan
+			}
+			handle(result.logs)
+		}
+	}
+	// stop the queries past a gap, they are made again on the next run
+	close(jobs)
+	cancel()
+	wg.Wait()
+	close(results)
+	for result := range results {
+		summary.Usage.add(result.usage)
+	}
+
+	if next == len(chunks) {
+		return query.ToBlock.Uint64(), nil
+	}
+	chunk := chunks[next]
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("blocks %v-%v: %w", chunk.FromBlock, chunk.ToBlock, ctx.Err())
+	}
+	if next == 0 {
+		return 0, fmt.Errorf("blocks %v-%v: %w", chunk.FromBlock, chunk.ToBlock, gap)
+	}
+	summary.addError("Blocks %v-%v could not be read, scanning again from block %v on the next run: %v", chunk.FromBlock, chunk.ToBlock, chunk.FromBlock, gap)
+	return chunk.FromBlock.Uint64() - 1, nil
+}
+
+// filterLogsByBlock walks the query's block range one block at a time. Each
+// header's logs bloom is checked for the queried topics and addresses first,
+// and the logs are only requested for the blocks that may contain a match.
+func filterLogsByBlock(ctx context.Context, client chainClient, query ethereum.FilterQuery, summary *RunSummary, handle func([]types.Log)) error {
+	skipped := 0
+	for number := query.FromBlock.Uint64(); number <= query.ToBlock.Uint64(); number++ {
+		summary.Usage.RPC++
+		header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return fmt.Errorf("block %v: %w", number, err)
+		}
+		if !bloomMatches(header.Bloom, query) {
+			skipped++
+			continue
+		}
+		hash := header.Hash()
+		blockQuery := ethereum.FilterQuery{
+			BlockHash: &hash,
+			Addresses: query.Addresses,
+			Topics:    query.Topics,
+		}
+		logs, err := filterLogsWithBackoff(ctx, client, blockQuery, &summary.Usage)
+		if err != nil {
+			return fmt.Errorf("block %v: %w", number, err)
+		}
+		handle(logs)
+	}
+	slog.Info("Skipped the blocks with no matching logs in the bloom filter", "blocks", skipped)
+	return nil
+}
+
+// bloomMatches reports whether the bloom may contain logs for the query. A
+// bloom filter has false positives but never false negatives.
+func bloomMatches(bloom types.Bloom, query ethereum.FilterQuery) bool {
+	if len(query.Addresses) > 0 {
+		found := false
+		for _, address := range query.Addresses {
+			if types.BloomLookup(bloom, address) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, topics := range query.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range topics {
+			if types.BloomLookup(bloom, topic) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
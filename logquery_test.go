@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// codeError is a JSON-RPC error with a code, as the providers return.
+type codeError struct {
+	code int
+	msg  string
+}
+
+func (e codeError) Error() string  { return e.msg }
+func (e codeError) ErrorCode() int { return e.code }
+
+func TestRPCErrors(t *testing.T) {
+	for _, test := range []struct {
+		err         error
+		rateLimited bool
+		tooMany     bool
+	}{
+		{codeError{-32005, "query returned more than 10000 results"}, false, true},
+		{codeError{-32005, "daily request count exceeded, request rate limited"}, true, false},
+		{codeError{-32005, "limit exceeded"}, true, false},
+		{codeError{-32000, "rate limit exceeded"}, true, false},
+		{codeError{-32602, "Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range"}, false, true},
+		{fmt.Errorf("unable to query: %w", codeError{-32005, "Your app has exceeded its compute units per second capacity"}), true, false},
+		{rpc.HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"}, true, false},
+		{errors.New("block range is too large"), false, true},
+		{errors.New("rate limit exceeded for this block range"), true, false},
+		{errors.New("connection reset by peer"), false, false},
+	} {
+		if got := isRateLimited(test.err); got != test.rateLimited {
+			t.Errorf("isRateLimited(%q) = %v", test.err, got)
+		}
+		if got := isTooManyResults(test.err); got != test.tooMany {
+			t.Errorf("isTooManyResults(%q) = %v", test.err, got)
+		}
+	}
+}
+
+// failingChain fails the log queries that include one of the failing blocks.
+type failingChain struct {
+	*memoryChain
+	failing map[uint64]bool
+}
+
+func (c *failingChain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	for block := query.FromBlock.Uint64(); block <= query.ToBlock.Uint64(); block++ {
+		if c.failing[block] {
+			return nil, fmt.Errorf("header not found")
+		}
+	}
+	return c.memoryChain.FilterLogs(ctx, query)
+}
+
+// blockLogs is a log in each block from 1 to blocks.
+func blockLogs(blocks uint64) []types.Log {
+	var logs []types.Log
+	for block := uint64(1); block <= blocks; block++ {
+		logs = append(logs, types.Log{BlockNumber: block})
+	}
+	return logs
+}
+
+func blockQuery(from uint64, to uint64) ethereum.FilterQuery {
+	return ethereum.FilterQuery{FromBlock: new(big.Int).SetUint64(from), ToBlock: new(big.Int).SetUint64(to)}
+}
+
+// handledBlocks returns a handle that keeps the blocks of the logs and fails
+// the test if they come out of order.
+func handledBlocks(t *testing.T, blocks *[]uint64) func([]types.Log) {
+	return func(logs []types.Log) {
+		for _, txLog := range logs {
+			if n := len(*blocks); n > 0 && (*blocks)[n-1] >= txLog.BlockNumber {
+				t.Errorf("block %v handled after block %v", txLog.BlockNumber, (*blocks)[n-1])
+			}
+			*blocks = append(*blocks, txLog.BlockNumber)
+		}
+	}
+}
+
+func TestFilterLogsChunked(t *testing.T) {
+	t.Setenv("LOG_CHUNK_BLOCKS", "5")
+	t.Setenv("LOG_QUERY_CONCURRENCY", "3")
+	summary := newRunSummary()
+	var blocks []uint64
+
+	last, err := filterLogsChunked(context.Background(), newMemoryChain(blockLogs(30)), blockQuery(1, 30), summary, handledBlocks(t, &blocks))
+	if err != nil || last != 30 {
+		t.Errorf("last %v, %v, want 30", last, err)
+	}
+	if len(blocks) != 30 {
+		t.Errorf("%v blocks handled, want 30", len(blocks))
+	}
+	if summary.Usage.RPC != 6 {
+		t.Errorf("%v queries, want 6", summary.Usage.RPC)
+	}
+}
+
+func TestFilterLogsChunkedGap(t *testing.T) {
+	t.Setenv("LOG_CHUNK_BLOCKS", "5")
+	t.Setenv("LOG_QUERY_CONCURRENCY", "3")
+	summary := newRunSummary()
+	client := &failingChain{memoryChain: newMemoryChain(blockLogs(30)), failing: map[uint64]bool{12: true, 23: true}}
+	var blocks []uint64
+
+	last, err := filterLogsChunked(context.Background(), client, blockQuery(1, 30), summary, handledBlocks(t, &blocks))
+	if err != nil || last != 10 {
+		t.Errorf("last %v, %v, want the block before the gap", last, err)
+	}
+	// the chunks after the gap are counted on the next run
+	if len(blocks) != 10 || blocks[9] != 10 {
+		t.Errorf("handled blocks %v, want 1-10", blocks)
+	}
+	if len(summary.Errors) != 1 {
+		t.Errorf("errors %v, want the gap", summary.Errors)
+	}
+}
+
+func TestFilterLogsChunkedFails(t *testing.T) {
+	t.Setenv("LOG_CHUNK_BLOCKS", "5")
+	client := &failingChain{memoryChain: newMemoryChain(blockLogs(30)), failing: map[uint64]bool{3: true}}
+
+	last, err := filterLogsChunked(context.Background(), client, blockQuery(1, 30), newRunSummary(), func([]types.Log) {
+		t.Error("logs handled past the gap")
+	})
+	if err == nil {
+		t.Errorf("last %v without an error when no chunk was read", last)
+	}
+}
+
+func TestFilterLogsChunkedCancelled(t *testing.T) {
+	t.Setenv("LOG_CHUNK_BLOCKS", "5")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	last, err := filterLogsChunked(ctx, newMemoryChain(blockLogs(30)), blockQuery(1, 30), newRunSummary(), func([]types.Log) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("last %v, %v, want the cancellation", last, err)
+	}
+}
+
+func TestFilterLogsChunkedCancelledAfterRead(t *testing.T) {
+	t.Setenv("LOG_CHUNK_BLOCKS", "5")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var blocks []uint64
+	handle := handledBlocks(t, &blocks)
+
+	// every chunk is in before the context is done
+	last, err := filterLogsChunked(ctx, newMemoryChain(blockLogs(30)), blockQuery(1, 30), newRunSummary(), func(logs []types.Log) {
+		handle(logs)
+		if len(blocks) == 30 {
+			cancel()
+		}
+	})
+	if err != nil || last != 30 {
+		t.Errorf("last %v, %v, want 30", last, err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	targetMastodon = "mastodon"
+	// maxImageBytes is the largest collection image attached to a post
+	maxImageBytes = 1000000
+)
+
+func init() {
+	registerNotifier(targetMastodon, newMastodonNotifier)
+}
+
+// mastodonNotifier posts the alerts to a Mastodon account with the same text
+// as the tweets, attaching the collection image.
+type mastodonNotifier struct {
+	instance string
+	token    string
+	client   *http.Client
+	template *messageTemplate
+}
+
+func newMastodonNotifier() (Notifier, error) {
+	m := &mastodonNotifier{
+		instance: strings.TrimRight(os.Getenv("MASTODON_URL"), "/"),
+		token:    os.Getenv("MASTODON_ACCESS_TOKEN"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if m.instance == "" || m.token == "" {
+		return nil, fmt.Errorf("MASTODON_URL and MASTODON_ACCESS_TOKEN must be set")
+	}
+	template, err := loadMessageTemplate(targetMastodon)
+	if err != nil {
+		return nil, err
+	}
+	m.template = template
+	return m, nil
+}
+
+func (m *mastodonNotifier) Name() string { return targetMastodon }
+
+func (m *mastodonNotifier) render(alert Alert) (string, error) {
+	return m.template.text(alert, tweetText)
+}
+
+func (m *mastodonNotifier) Notify(ctx context.Context, alert Alert) error {
+	text, err := m.render(alert)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"status": text,
+	}
+	if image := alert.Collection.ImageURL; image != "" {
+		mediaID, err := m.uploadImage(ctx, image, alert.Collection.Name)
+		if err != nil {
+			// the post is still worth sending without the image
+			slog.Warn("Unable to attach the collection image", "channel", targetMastodon, "contract", alert.Contract, "error", err)
+		} else {
+			params["media_ids"] = []string{mediaID}
+		}
+	}
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		ID string `json:"id"`
+	}
+	if err := m.call(ctx, "/api/v1/statuses", "application/json", bytes.NewReader(buf), alert.Key, &status); err != nil {
+		return err
+	}
+	slog.Info("Mastodon status posted", "channel", targetMastodon, "contract", alert.Contract, "status_id", status.ID)
+	return nil
+}
+
+// uploadImage uploads the image at url as a media attachment and returns its
+// id.
+func (m *mastodonNotifier) uploadImage(ctx context.Context, url string, description string) (string, error) {
+	image, contentType, err := fetchImage(ctx, m.client, url)
+	if err != nil {
+		return "", err
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("description", description)
+	part, err := form.CreatePart(map[string][]string{
+		"Content-Disposition": {`form-data; name="file"; filename="image"`},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		return "", err
+	}
+	part.Write(image)
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+	var media struct {
+		ID string `json:"id"`
+	}
+	if err := m.call(ctx, "/api/v2/media", form.FormDataContentType(), &body, "", &media); err != nil {
+		return "", err
+	}
+	return media.ID, nil
+}
+
+// call posts the body to the API path and decodes the response into v. The
+// instance only acts once on requests with the same idempotency key, so a
+// retried post isn't duplicated.
+func (m *mastodonNotifier) call(ctx context.Context, path string, contentType string, body io.Reader, idempotencyKey string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.instance+path, body)
+	if err != nil {
+		return fmt.Errorf("mastodon %v: request: %w", path, err)
+	}
+	req.Header.Add("Content-Type", contentType)
+	req.Header.Add("Authorization", "Bearer "+m.token)
+	if idempotencyKey != "" {
+		req.Header.Add("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("mastodon %v response: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("mastodon %v response read: %w", path, err)
+	}
+	// media uploads that are still processing return 202
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(respBytes, &apiErr)
+		return fmt.Errorf("mastodon %v status %v: %v", path, resp.StatusCode, apiErr.Error)
+	}
+	return json.Unmarshal(respBytes, v)
+}
+
+// fetchImage downloads an image to attach to a post and returns it with its
+// content type. Images over maxImageBytes are refused.
+func fetchImage(ctx context.Context, client *http.Client, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("image status %v", resp.Status)
+	}
+	image, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(image) > maxImageBytes {
+		return nil, "", fmt.Errorf("image is over %v bytes", maxImageBytes)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(image)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("%v is not an image", contentType)
+	}
+	return image, contentType, nil
+}
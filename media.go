@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// the share card is 16:9, the size Twitter shows in full
+	cardWidth  = 1200
+	cardHeight = 675
+	cardMargin = 48
+	cardAvatar = 180
+
+	// maxCardImageBytes caps the collection images downloaded for a card
+	maxCardImageBytes = 10 << 20
+	mediaUploadURL    = "https://upload.twitter.com/1.1/media/upload.json"
+)
+
+var (
+	cardBackground = color.RGBA{0x14, 0x15, 0x1a, 0xff}
+	cardText       = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	cardSubtle     = color.RGBA{0xb8, 0xbc, 0xc8, 0xff}
+)
+
+// cardRenderer composes the share cards of the alerts.
+type cardRenderer struct {
+	client  *http.Client
+	title   font.Face
+	heading font.Face
+	body    font.Face
+}
+
+func newCardRenderer() (*cardRenderer, error) {
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face := func(f *opentype.Font, size float64) (font.Face, error) {
+		return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	}
+	c := &cardRenderer{client: &http.Client{Timeout: 15 * time.Second}}
+	if c.title, err = face(bold, 60); err != nil {
+		return nil, err
+	}
+	if c.heading, err = face(bold, 40); err != nil {
+		return nil, err
+	}
+	if c.body, err = face(regular, 32); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// fetchImage downloads and decodes a PNG, JPEG or GIF image.
+func (c *cardRenderer) fetchImage(ctx context.Context, url string) (image.Image, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image status %v", resp.StatusCode)
+	}
+	img, _, err := image.Decode(io.LimitReader(resp.Body, maxCardImageBytes))
+	return img, err
+}
+
+// drawCover scales the image to cover the rectangle, cropping the overflow
+// around its center.
+func drawCover(dst draw.Image, r image.Rectangle, src image.Image) {
+	b := src.Bounds()
+	if b.Empty() {
+		return
+	}
+	// the part of the source with the rectangle's aspect ratio
+	crop := b
+	if b.Dx()*r.Dy() > b.Dy()*r.Dx() {
+		w := b.Dy() * r.Dx() / r.Dy()
+		crop.Min.X = b.Min.X + (b.Dx()-w)/2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := b.Dx() * r.Dy() / r.Dx()
+		crop.Min.Y = b.Min.Y + (b.Dy()-h)/2
+		crop.Max.Y = crop.Min.Y + h
+	}
+	draw.CatmullRom.Scale(dst, r, src, crop, draw.Over, nil)
+}
+
+// shade darkens the rectangle from clear at the top to mostly black at the
+// bottom, so the text over the banner stays readable.
+func shade(dst draw.Image, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		alpha := uint8(40 + 200*(y-r.Min.Y)/r.Dy())
+		line := image.Rect(r.Min.X, y, r.Max.X, y+1)
+		draw.Draw(dst, line, image.NewUniform(color.RGBA{0, 0, 0, alpha}), image.Point{}, draw.Over)
+	}
+}
+
+// drawText writes the text with its baseline at y, shortened with an
+// ellipsis to fit maxWidth.
+func drawText(dst draw.Image, face font.Face, x int, y int, maxWidth int, text string, c color.Color) {
+	d := &font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: face}
+	limit := fixed.I(maxWidth)
+	if d.MeasureString(text) > limit {
+		runes := []rune(text)
+		for len(runes) > 0 && d.MeasureString(string(runes)+"…") > limit {
+			runes = runes[:len(runes)-1]
+		}
+		text = strings.TrimSpace(string(runes)) + "…"
+	}
+	d.Dot = fixed.P(x, y)
+	d.DrawString(text)
+}
+
+// render composes the card: the collection banner, or its image, as the
+// background, the collection image, its name, what was counted in the time
+// window and the floor price.
+func (c *cardRenderer) render(ctx context.Context, alert Alert) ([]byte, error) {
+	collection := alert.Collection
+	card := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(card, card.Bounds(), image.NewUniform(cardBackground), image.Point{}, draw.Src)
+
+	var avatar image.Image
+	if collection.ImageURL != "" {
+		img, err := c.fetchImage(ctx, collection.ImageURL)
+		if err != nil {
+			return nil, fmt.Errorf("collection image: %w", err)
+		}
+		avatar = img
+	}
+	background := avatar
+	if banner := collection.Collection.BannerImageURL; banner != "" {
+		if img, err := c.fetchImage(ctx, banner); err == nil {
+			background = img
+		}
+	}
+	if background != nil {
+		drawCover(card, card.Bounds(), background)
+	}
+	shade(card, card.Bounds())
+
+	textX := cardMargin
+	if avatar != nil {
+		frame := image.Rect(cardMargin-4, cardHeight-cardMargin-cardAvatar-4, cardMargin+cardAvatar+4, cardHeight-cardMargin+4)
+		draw.Draw(card, frame, image.NewUniform(cardText), image.Point{}, draw.Src)
+		drawCover(card, frame.Inset(4), avatar)
+		textX += cardAvatar + cardMargin
+	}
+	width := cardWidth - textX - cardMargin
+	data := alert.messageData()
+
+	name := collection.Name
+	if name == "" {
+		name = alert.Contract
+	}
+	drawText(card, c.heading, cardMargin, cardMargin+40, cardWidth-2*cardMargin, data.Headline+chainTag(alert.Chain), cardText)
+	drawText(card, c.title, textX, cardHeight-cardMargin-124, width, name, cardText)
+	drawText(card, c.heading, textX, cardHeight-cardMargin-64, width,
+		fmt.Sprintf("%v %v in %v minutes", alert.Count, alert.action(), alert.minutes()), cardText)
+	if data.HasStats {
+		drawText(card, c.body, textX, cardHeight-cardMargin-12, width,
+			fmt.Sprintf("Floor %v %v", data.FloorPrice, data.StatsCurrency), cardSubtle)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, card); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// uploadMedia uploads the image with the v1.1 media endpoint, which the v2
+// API has no replacement for, and returns the media ID to tweet it with.
+func uploadMedia(ctx context.Context, client *http.Client, name string, media []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("media", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(media); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mediaUploadURL, &body)
+	if err != nil {
+		return "", fmt.Errorf("media upload: request: %w", err)
+	}
+	req.Header.Add("Content-Type", form.FormDataContentType())
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("media upload response: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("media upload response read: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("media upload status %v: %v", resp.StatusCode, strings.TrimSpace(string(respBytes)))
+	}
+	var result struct {
+		MediaID string `json:"media_id_string"`
+	}
+	if err := json.Unmarshal(respBytes, &result); err != nil {
+		return "", fmt.Errorf("media upload response: %w", err)
+	}
+	return result.MediaID, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// The in-memory stand-ins for the chain, the state store and the notifiers
+// run the pipeline without any network, along with the recorded OpenSea
+// responses of replaySource, for replays and for trying changes against a
+// known set of logs.
+
+// memoryChain serves a fixed set of logs. The head is the last block of the
+// logs. Transactions are free mints and every contract is established, as a
+// recording has neither.
+type memoryChain struct {
+	logs []types.Log
+	head uint64
+	mu   sync.Mutex
+	// blocks are the numbers of the headers handed out, by hash
+	blocks map[common.Hash]uint64
+}
+
+func newMemoryChain(logs []types.Log) *memoryChain {
+	c := &memoryChain{logs: logs, blocks: make(map[common.Hash]uint64)}
+	for _, txLog := range logs {
+		if txLog.BlockNumber > c.head {
+			c.head = txLog.BlockNumber
+		}
+	}
+	return c
+}
+
+func (c *memoryChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		number = new(big.Int).SetUint64(c.head)
+	}
+	header := &types.Header{Number: number}
+	// a full bloom makes the block scan read every block
+	for i := range header.Bloom {
+		header.Bloom[i] = 0xff
+	}
+	c.mu.Lock()
+	c.blocks[header.Hash()] = number.Uint64()
+	c.mu.Unlock()
+	return header, nil
+}
+
+// FilterLogs returns the logs in the block range from the addresses with the
+// topics of the query.
+func (c *memoryChain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, txLog := range c.logs {
+		if query.FromBlock != nil && txLog.BlockNumber < query.FromBlock.Uint64() {
+			continue
+		}
+		if query.ToBlock != nil && txLog.BlockNumber > query.ToBlock.Uint64() {
+			continue
+		}
+		if query.BlockHash != nil && txLog.BlockNumber != c.block(*query.BlockHash) {
+			continue
+		}
+		if len(query.Addresses) > 0 && !containsAddress(query.Addresses, txLog.Address) {
+			continue
+		}
+		if !matchesTopics(query.Topics, txLog.Topics) {
+			continue
+		}
+		logs = append(logs, txLog)
+	}
+	return logs, nil
+}
+
+func (c *memoryChain) block(hash common.Hash) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blocks[hash]
+}
+
+func containsAddress(addresses []common.Address, address common.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesTopics reports whether the topics match the query's, where each
+// position lists the accepted topics and an empty position accepts any.
+func matchesTopics(query [][]common.Hash, topics []common.Hash) bool {
+	if len(query) > len(topics) {
+		return false
+	}
+	for i, accepted := range query {
+		if len(accepted) == 0 {
+			continue
+		}
+		match := false
+		for _, topic := range accepted {
+			if topic == topics[i] {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *memoryChain) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	return types.NewTx(&types.LegacyTx{Value: new(big.Int)}), false, nil
+}
+
+func (c *memoryChain) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{0}, nil
+}
+
+func (c *memoryChain) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, fmt.Errorf("no contract calls in memory")
+}
+
+func (c *memoryChain) Close() {}
+
+// memoryStore keeps the status in memory. Each load gets its own copy, like
+// reading the status file.
+type memoryStore struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (m *memoryStore) load() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var status Status
+	if m.data != nil {
+		json.Unmarshal(m.data, &status)
+	}
+	status.migrateRecents()
+	return status
+}
+
+func (m *memoryStore) save(status Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if buf, err := json.Marshal(status); err == nil {
+		m.data = buf
+	}
+}
+
+// memoryNotifier keeps the alerts posted to it.
+type memoryNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (m *memoryNotifier) Name() string { return "memory" }
+
+func (m *memoryNotifier) Notify(ctx context.Context, alert Alert) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alerts = append(m.alerts, alert)
+	return nil
+}
+
+// posted returns the alerts posted so far.
+func (m *memoryNotifier) posted() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Alert{}, m.alerts...)
+}
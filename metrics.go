@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMetricsNamespace = "NFTMintAlert"
+
+// metric is a value recorded for a run. Channel is set for the per notifier
+// metrics.
+type metric struct {
+	Name    string
+	Unit    string
+	Value   float64
+	Channel string
+}
+
+// runMetrics returns the metrics for a finished run.
+func runMetrics(summary *RunSummary) []metric {
+	failed := 0.0
+	if summary.Failed {
+		failed = 1
+	}
+	metrics := []metric{
+		{Name: "BlocksScanned", Unit: "Count", Value: float64(summary.BlocksScanned)},
+		{Name: "LogsProcessed", Unit: "Count", Value: float64(summary.Logs)},
+		{Name: "MintContracts", Unit: "Count", Value: float64(summary.Mints)},
+		{Name: "Alerts", Unit: "Count", Value: float64(summary.Alerts)},
+		{Name: "OpenSeaErrors", Unit: "Count", Value: float64(summary.OpenSeaErrors)},
+		{Name: "Errors", Unit: "Count", Value: float64(len(summary.Errors))},
+		{Name: "RunFailed", Unit: "Count", Value: failed},
+		{Name: "RunDuration", Unit: "Milliseconds", Value: float64(time.Since(summary.Start).Milliseconds())},
+	}
+	var channels []string
+	for name := range summary.Sent {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+	for _, name := range channels {
+		metrics = append(metrics, metric{Name: "AlertsSent", Unit: "Count", Value: float64(summary.Sent[name]), Channel: name})
+	}
+	return metrics
+}
+
+// recordMetrics publishes the metrics of a run: to CloudWatch in the
+// embedded metric format when running in Lambda, and to the /metrics
+// endpoint when it is being served.
+func recordMetrics(summary *RunSummary) {
+	metrics := runMetrics(summary)
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		writeEMF(metrics)
+	}
+	promMetrics.add(metrics)
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// writeEMF logs the metrics in the CloudWatch embedded metric format. Lambda
+// forwards stdout to CloudWatch Logs, which extracts the metrics, so no API
+// calls are made. The per channel metrics are a separate document with a
+// Channel dimension.
+func writeEMF(metrics []metric) {
+	namespace := os.Getenv("METRICS_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultMetricsNamespace
+	}
+	byChannel := make(map[string][]metric)
+	var channels []string
+	for _, m := range metrics {
+		if _, ok := byChannel[m.Channel]; !ok {
+			channels = append(channels, m.Channel)
+		}
+		byChannel[m.Channel] = append(byChannel[m.Channel], m)
+	}
+	for _, channel := range channels {
+		directive := emfDirective{Namespace: namespace, Dimensions: [][]string{{}}}
+		doc := make(map[string]interface{})
+		if channel != "" {
+			directive.Dimensions = [][]string{{"Channel"}}
+			doc["Channel"] = channel
+		}
+		for _, m := range byChannel[channel] {
+			directive.Metrics = append(directive.Metrics, emfMetric{Name: m.Name, Unit: m.Unit})
+			doc[m.Name] = m.Value
+		}
+		doc["_aws"] = emfMetadata{
+			Timestamp:         time.Now().UnixNano() / int64(time.Millisecond),
+			CloudWatchMetrics: []emfDirective{directive},
+		}
+		buf, err := json.Marshal(doc)
+		if err != nil {
+			slog.Error("Error writing metrics", "error", err)
+			continue
+		}
+		// written without the log prefix so CloudWatch sees the JSON
+		fmt.Println(string(buf))
+	}
+}
+
+// promRegistry accumulates the run metrics for the Prometheus /metrics
+// endpoint in daemon and subscribe mode.
+type promRegistry struct {
+	mu     sync.Mutex
+	totals map[string]float64
+	last   map[string]float64
+	runs   int
+}
+
+var promMetrics = &promRegistry{totals: make(map[string]float64), last: make(map[string]float64)}
+
+func (p *promRegistry) add(metrics []metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.runs++
+	for _, m := range metrics {
+		if m.Name == "RunDuration" {
+			p.last["nftmintalert_run_duration_seconds"] = m.Value / 1000
+			continue
+		}
+		name := "nftmintalert_" + snakeCase(m.Name) + "_total"
+		if m.Channel != "" {
+			name += fmt.Sprintf("{channel=%q}", m.Channel)
+		}
+		p.totals[name] += m.Value
+	}
+	p.last["nftmintalert_last_run_timestamp_seconds"] = float64(time.Now().Unix())
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (p *promRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE nftmintalert_runs_total counter\nnftmintalert_runs_total %v\n", p.runs)
+	writePromGroup(w, "counter", p.totals)
+	writePromGroup(w, "gauge", p.last)
+}
+
+func writePromGroup(w io.Writer, kind string, values map[string]float64) {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	typed := make(map[string]bool)
+	for _, name := range names {
+		family := strings.SplitN(name, "{", 2)[0]
+		if !typed[family] {
+			fmt.Fprintf(w, "# TYPE %v %v\n", family, kind)
+			typed[family] = true
+		}
+		fmt.Fprintf(w, "%v %v\n", name, values[name])
+	}
+}
+
+// snakeCase turns a metric name like OpenSeaErrors into open_sea_errors.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// serveMetrics serves /metrics on METRICS_ADDR, e.g. ":9090", if it is set.
+func serveMetrics() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" || addr == os.Getenv("ADMIN_ADDR") {
+		// served by the admin API
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promMetrics)
+	slog.Info("Serving metrics", "addr", addr, "path", "/metrics")
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MinterStats describes who minted a collection in the window.
+type MinterStats struct {
+	// Unique is the number of distinct wallets minted to
+	Unique int `json:"unique"`
+	// TopShare is the fraction of the mints made by the busiest wallet
+	TopShare float64 `json:"top_share"`
+	// Notable are the ENS names of the top wallets, see ENS_MINTERS
+	Notable []string `json:"notable,omitempty"`
+	// top are the wallets with the most mints, only kept with ENS_MINTERS
+	top []common.Address
+}
+
+// minterStats summarises the mint transactions per wallet of each contract.
+func minterStats(minters map[string]map[common.Address]int) map[string]*MinterStats {
+	stats := make(map[string]*MinterStats, len(minters))
+	keepTop := 0
+	if envBool("ENS_MINTERS") {
+		keepTop = envInt("ENS_TOP_MINTERS", defaultTopMinters)
+	}
+	for contract, wallets := range minters {
+		total, top := 0, 0
+		for _, count := range wallets {
+			total += count
+			if count > top {
+				top = count
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		stats[contract] = &MinterStats{Unique: len(wallets), TopShare: float64(top) / float64(total)}
+		if keepTop > 0 {
+			stats[contract].top = topWallets(wallets, keepTop)
+		}
+	}
+	return stats
+}
+
+// minterFilter suppresses collections minted by a handful of wallets, which
+// are usually bots. Zero values do not filter.
+type minterFilter struct {
+	MinUnique   int
+	MaxTopShare float64
+}
+
+func getMinterFilter() minterFilter {
+	return minterFilter{
+		MinUnique:   envInt("MIN_UNIQUE_MINTERS", 0),
+		MaxTopShare: envFloat("MAX_MINTER_SHARE", 0),
+	}
+}
+
+// passes reports whether the minters meet the filter. Collections without
+// minter stats, such as the ones carried over from the previous run, pass.
+func (f minterFilter) passes(contract string, stats *MinterStats) bool {
+	if stats == nil {
+		return true
+	}
+	if stats.Unique < f.MinUnique {
+		slog.Info("Too few unique minters", "contract", contract, "unique_minters", stats.Unique, "min", f.MinUnique)
+		return false
+	}
+	if f.MaxTopShare > 0 && stats.TopShare > f.MaxTopShare {
+		slog.Info("Mints concentrated in one wallet", "contract", contract, "top_share", stats.TopShare, "max", f.MaxTopShare)
+		return false
+	}
+	return true
+}
+
+// mintersText describes the minters for the alert text, e.g. " by 412
+// wallets". It is empty when the minters are not known.
+func (a Alert) mintersText() string {
+	if a.Minters == nil {
+		return ""
+	}
+	if a.Minters.Unique == 1 {
+		return " by 1 wallet"
+	}
+	return fmt.Sprintf(" by %v wallets", a.Minters.Unique)
+}
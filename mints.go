@@ -0,0 +1,223 @@
+package main
+
+import (
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// mintKey identifies a mint of a contract in a transaction. A transaction
+// minting several tokens of the same contract counts once.
+type mintKey struct {
+	tx       common.Hash
+	contract common.Address
+}
+
+// mintCounter counts the mint transactions per contract in a single pass as
+// the logs arrive.
+type mintCounter struct {
+	counts    map[string]int
+	seen      map[mintKey]struct{}
+	exclude   map[common.Address]bool
+	logs      int
+	lastBlock uint64
+	// tokens is the number of tokens minted, ERC-1155 mints can be many
+	// tokens in one transfer
+	tokens uint64
+	// txs holds the mint transactions of each contract
+	txs map[string][]common.Hash
+	// minters counts the mint transactions of each contract per wallet
+	minters map[string]map[common.Address]int
+	// sales counts the marketplace sales. Nil skips them.
+	sales *saleCounter
+	// burns counts the burn transactions per contract, see BURN_MODE
+	burns    map[string]int
+	burnSeen map[mintKey]struct{}
+}
+
+// newMintCounter returns a counter that skips the transfers of the excluded
+// contracts.
+func newMintCounter(exclude map[common.Address]bool) *mintCounter {
+	return &mintCounter{
+		counts:   make(map[string]int),
+		seen:     make(map[mintKey]struct{}),
+		exclude:  exclude,
+		txs:      make(map[string][]common.Hash),
+		minters:  make(map[string]map[common.Address]int),
+		burns:    make(map[string]int),
+		burnSeen: make(map[mintKey]struct{}),
+	}
+}
+
+func (m *mintCounter) add(txLog types.Log) {
+	if m.logs == 0 || txLog.BlockNumber != m.lastBlock {
+		m.lastBlock = txLog.BlockNumber
+		slog.Debug("Block", "block", txLog.BlockNumber, "logs", m.logs, "block_hash", txLog.BlockHash.String())
+	}
+	m.logs++
+	if m.sales != nil {
+		m.sales.add(txLog)
+	}
+
+	if key, ok := burnOf(txLog, m.exclude); ok {
+		// a transaction burning several tokens counts once, as mints do
+		if _, ok := m.burnSeen[key]; !ok {
+			m.burnSeen[key] = struct{}{}
+			m.burns[key.contract.Hex()]++
+		}
+		return
+	}
+	key, tokens, ok := mintOf(txLog, m.exclude)
+	if !ok {
+		return
+	}
+	m.tokens += tokens
+	// count the mint transactions
+	if _, ok := m.seen[key]; ok {
+		return
+	}
+	m.seen[key] = struct{}{}
+	address := key.contract.Hex()
+	slog.Debug("Mint", "tx_hash", txLog.TxHash.Hex(), "contract", address)
+	m.counts[address]++
+	m.txs[address] = append(m.txs[address], key.tx)
+	if m.minters[address] == nil {
+		m.minters[address] = make(map[common.Address]int)
+	}
+	m.minters[address][mintRecipient(txLog)]++
+}
+
+// mintOf reports whether the log is the mint of tokens from a contract that
+// is not excluded, and returns the transaction and contract of the mint and
+// the number of tokens minted.
+func mintOf(txLog types.Log, exclude map[common.Address]bool) (mintKey, uint64, bool) {
+	from, tokens, ok := nftTransferOf(txLog, exclude)
+	if !ok || from.Hex() != nullAddress {
+		return mintKey{}, 0, false
+	}
+	return mintKey{tx: txLog.TxHash, contract: txLog.Address}, tokens, true
+}
+
+// nftTransferOf reports whether the log is a transfer of tokens from a
+// contract that is not excluded, and returns the sender and the number of
+// tokens transferred. ERC-721 Transfer, ERC-1155 TransferSingle and ERC-1155
+// TransferBatch events are recognised.
+func nftTransferOf(txLog types.Log, exclude map[common.Address]bool) (common.Address, uint64, bool) {
+	if len(txLog.Topics) == 0 {
+		return common.Address{}, 0, false
+	}
+	var from common.Hash
+	var tokens uint64
+	switch txLog.Topics[0].Hex() {
+	case topicTransfer:
+		if len(txLog.Topics) < 4 {
+			// ERC20 transfers have 3 topics. Skip
+			return common.Address{}, 0, false
+		}
+		from = txLog.Topics[1]
+		tokens = 1
+	case topicTransferSingle, topicTransferBatch:
+		// operator, from and to are indexed
+		if len(txLog.Topics) < 4 {
+			return common.Address{}, 0, false
+		}
+		from = txLog.Topics[2]
+		var ok bool
+		if txLog.Topics[0].Hex() == topicTransferSingle {
+			tokens, ok = decodeTransferSingle(txLog.Data)
+		} else {
+			tokens, ok = decodeTransferBatch(txLog.Data)
+		}
+		if !ok || tokens == 0 {
+			slog.Debug("Skipping malformed ERC-1155 transfer", "tx_hash", txLog.TxHash.Hex())
+			return common.Address{}, 0, false
+		}
+	default:
+		// skip everything not a transfer
+		return common.Address{}, 0, false
+	}
+	if exclude[txLog.Address] {
+		// skip marketplace and naming service transfers.
+		return common.Address{}, 0, false
+	}
+	return common.BytesToAddress(from[:]), tokens, true
+}
+
+// mintRecipient returns the wallet a mint log, or any transfer log already
+// checked by nftTransferOf, transfers to. ERC-1155 events have the operator indexed first.
+func mintRecipient(txLog types.Log) common.Address {
+	to := txLog.Topics[2]
+	if txLog.Topics[0].Hex() != topicTransfer {
+		to = txLog.Topics[3]
+	}
+	return common.BytesToAddress(to[:])
+}
+
+// transferTopics are the event signatures queried for mints.
+func transferTopics() []common.Hash {
+	return []common.Hash{
+		common.HexToHash(topicTransfer),
+		common.HexToHash(topicTransferSingle),
+		common.HexToHash(topicTransferBatch),
+	}
+}
+
+// decodeTransferSingle returns the value of a TransferSingle event. The data
+// holds the token id and the value.
+func decodeTransferSingle(data []byte) (uint64, bool) {
+	if len(data) < 64 {
+		return 0, false
+	}
+	return abiUint64(data[32:64])
+}
+
+// decodeTransferBatch returns the sum of the values of a TransferBatch event.
+// The data holds the offsets of the ids and values arrays followed by the
+// arrays, each a length and then the elements.
+func decodeTransferBatch(data []byte) (uint64, bool) {
+	if len(data) < 64 {
+		return 0, false
+	}
+	offset, ok := abiUint64(data[32:64])
+	if !ok || offset > uint64(len(data))-32 {
+		return 0, false
+	}
+	count, ok := abiUint64(data[offset : offset+32])
+	if !ok || count > (uint64(len(data))-offset-32)/32 {
+		return 0, false
+	}
+	var total uint64
+	for i := uint64(0); i < count; i++ {
+		start := offset + 32 + i*32
+		value, ok := abiUint64(data[start : start+32])
+		if !ok || total+value < total {
+			return 0, false
+		}
+		total += value
+	}
+	return total, true
+}
+
+// abiUint64 decodes a 32 byte ABI word that must fit in a uint64.
+func abiUint64(word []byte) (uint64, bool) {
+	value := new(big.Int).SetBytes(word)
+	if !value.IsUint64() {
+		return 0, false
+	}
+	return value.Uint64(), true
+}
+
+// ranked returns the contracts ordered from most to least mints and adds
+// the counts to the summary.
+func (m *mintCounter) ranked(summary *RunSummary) PairList {
+	slog.Info("Counted mints", "logs", m.logs, "mint_txs", len(m.seen), "tokens", m.tokens, "burn_txs", len(m.burnSeen))
+	summary.Logs += m.logs
+	if burnMode() == burnModeNet {
+		m.netMints()
+	}
+	mintlist := rankByWordCount(m.counts)
+	summary.Mints += len(mintlist)
+	return mintlist
+}
@@ -4,17 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"math/big"
 	"net/http"
+	"net/url"
 	"nftmintalert/opensea"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/andersfylling/snowflake"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -23,12 +27,9 @@ import (
 	"github.com/g8rswimmer/go-twitter/v2"
 	"github.com/joho/godotenv"
 
-	twitterV1 "github.com/dghubble/go-twitter/twitter"
-
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/nickname32/discordhook"
 )
 
@@ -38,18 +39,57 @@ const contractENS string = "0x283Af0B28c62C092C9727F1Ee09c02CA627EB7F5"
 const contractENS2 string = "0x57f1887a8BF19b14fC0dF6Fd9B2acc9Af147eA85"           // ENS
 const nullAddress string = "0x0000000000000000000000000000000000000000"
 const topicTransfer string = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+const topicTransferSingle string = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62" // ERC-1155
+const topicTransferBatch string = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"  // ERC-1155
 
 type Event struct {
-	Name string `json:"name"`
+	Name string    `json:"name"`
+	Test *TestMint `json:"test,omitempty"`
+	// Replay is the location of a recorded run to replay, see RECORD_PATH.
+	Replay string `json:"replay,omitempty"`
+	// DryRun scans and renders the alerts without posting them or saving
+	// the status, the same as DRY_RUN.
+	DryRun bool `json:"dry_run,omitempty"`
 }
 
 type Status struct {
-	Recents []string `json:"recents"`
+	// Posted holds when each collection was last alerted
+	Posted map[string]time.Time `json:"posted"`
+	// Recents is the list of posted collections kept before the cool-down.
+	// It is moved into Posted when the status is loaded.
+	Recents          []string                 `json:"recents,omitempty"`
+	LastAlert        time.Time                `json:"last_alert"`
+	LastSilenceAlert time.Time                `json:"last_silence_alert"`
+	Pending          []PendingNotification    `json:"pending"`
+	Continuations    map[string]*Continuation `json:"continuations,omitempty"`
+	// Checkpoints holds the last block scanned on each chain
+	Checkpoints map[string]uint64 `json:"checkpoints,omitempty"`
+	// Windows holds the mint counts of the last window scanned on each
+	// chain, for the trending score
+	Windows map[string]*WindowCounts `json:"windows,omitempty"`
+	Sent    map[string]time.Time     `json:"sent"`
+	Usage   map[string]*UsageCounts  `json:"usage"`
+
+	// claimer records idempotency keys in a store shared by overlapping
+	// runs. Without one the keys are kept in Sent.
+	claimer func(key string) (bool, error)
 }
 
+// MintStatus is the amount spent minting a collection. Value is the total in
+// the chain's native currency.
 type MintStatus struct {
-	Count int
-	Value float64
+	Count    int     `json:"count"`
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+	// Sampled is set when the value is estimated from a sample of the mints
+	Sampled bool `json:"sampled,omitempty"`
+}
+
+func (m MintStatus) average() float64 {
+	if m.Count == 0 {
+		return 0
+	}
+	return m.Value / float64(m.Count)
 }
 
 type TwitterKeys struct {
@@ -99,7 +139,7 @@ func SetStatus(sess *session.Session, status Status, s3bucket string, s3key stri
 	}
 	_, err = svc.PutObject(request)
 	if err != nil {
-		log.Print(err)
+		slog.Error("Error saving status to S3", "error", err)
 	}
 }
 
@@ -114,14 +154,14 @@ func GetStatus(sess *session.Session, s3bucket string, s3key string) Status {
 
 	result, err := svc.GetObject(requestInput)
 	if err != nil {
-		log.Print(err)
+		slog.Error("Error reading status from S3", "error", err)
 		return status
 	}
 
 	defer result.Body.Close()
 	body, err := ioutil.ReadAll(result.Body)
 	if err != nil {
-		log.Print(err)
+		slog.Error("Error reading status from S3", "error", err)
 	}
 
 	bodyString := fmt.Sprintf("%s", body)
@@ -136,342 +176,522 @@ func callOut(collection *opensea.OpenSeaCollection, address string, count int) b
 	case contractENS2: //ens domains
 		return false
 	}
-	log.Printf("Checking for callout %v (count %v)\n", address, count)
 	if len(collection.ExternalLink) == 0 && len(collection.Collection.TwitterUsername) == 0 {
+		slog.Info("No external link or Twitter account, not calling out", "contract", address, "count", count)
 		return false
 	}
-	fmt.Println("Call out")
+	slog.Info("Call out", "contract", address, "count", count)
 	return true
 }
 
-func sendDiscordWebhook(collection *opensea.OpenSeaCollection, count int, webhookId string, webhookToken string) {
-	if webhookId == "" || webhookToken == "" {
-		log.Println("Discord webhook Id and/or webhook token not configured.")
-		return
+// discordWebhooksURL is where the webhooks are executed.
+const discordWebhooksURL = "https://discord.com/api/webhooks"
+
+// execute posts the content and embed, if any, to the webhook and returns
+// the message ID.
+func (d *discordNotifier) execute(ctx context.Context, content string, embed *discordhook.Embed) (string, error) {
+	if _, err := strconv.ParseUint(d.webhookId, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid webhook ID: %w", err)
+	}
+	params := &discordhook.WebhookExecuteParams{Content: content}
+	if embed != nil {
+		params.Embeds = []*discordhook.Embed{embed}
 	}
-	keyInt, err := strconv.ParseInt(webhookId, 10, 64)
+	body, err := json.Marshal(params)
 	if err != nil {
-		log.Printf("Invalid webhook ID: %v\n", err)
-		return
+		return "", fmt.Errorf("discord webhook error: %w", err)
 	}
-	wa, err := discordhook.NewWebhookAPI(snowflake.Snowflake(keyInt), webhookToken, true, nil)
+	// wait returns the message, with its ID
+	webhookURL := fmt.Sprintf("%v/%v/%v?wait=true", d.host, d.webhookId, url.PathEscape(d.webhookToken))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
 	if err != nil {
-		log.Printf("Discord webhook error: %v\n", err)
-		return
+		return "", fmt.Errorf("discord webhook request: invalid URL")
 	}
-
-	wh, err := wa.Get(nil)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
 	if err != nil {
-		log.Printf("Discord webhook error: %v\n", err)
-		return
+		// the URL holds the token, keep it out of the error
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return "", fmt.Errorf("discord webhook execute error: %w", err)
 	}
-	_ = wh
+	defer resp.Body.Close()
 
-	//log.Printf("Discord webhook name: %v\n", wh.Name)
-	alert := fmt.Sprintf("Mint Alert!\n\n**[%v](%v)**\n\n**%v minted** in **%v minutes**\n", collection.Name, collection.Collection.ExternalURL, count, 10)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("discord webhook response read: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("discord webhook status %v: %v", resp.StatusCode, strings.TrimSpace(string(respBytes)))
+	}
+	var msg struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBytes, &msg); err != nil {
+		return "", fmt.Errorf("discord webhook response: %w", err)
+	}
+	return msg.ID, nil
+}
 
-	msg, err := wa.Execute(nil, &discordhook.WebhookExecuteParams{Content: alert,
-		Embeds: []*discordhook.Embed{
-			{
-				Image: &discordhook.EmbedImage{URL: collection.ImageURL},
-			},
+// twitterClient returns a Twitter v2 API client using the OAuth1 user
+// context of the alert account.
+func twitterClient(twitKey TwitterKeys) *twitter.Client {
+	return &twitter.Client{
+		Authorizer: authorize{
+			Token: "",
 		},
-	}, nil, "")
-
-	if err != nil {
-		panic(err)
+		Client: twitterHTTPClient(twitKey),
+		Host:   "https://api.twitter.com",
 	}
+}
+
+// twitterHTTPClient signs the requests with the OAuth1 user context of the
+// alert account, for the v1.1 endpoints the v2 client doesn't cover.
+func twitterHTTPClient(twitKey TwitterKeys) *http.Client {
+	config := oauth1.NewConfig(twitKey.ConsumerKey, twitKey.ConsumerSecret)
+	token := oauth1.NewToken(twitKey.Token, twitKey.TokenSecret)
+	return config.Client(oauth1.NoContext, token)
+}
 
-	log.Printf("Discord message sent. Message ID: %v\n", msg.ID)
+// tweetText is the built in tweet for the alert.
+func tweetText(alert Alert) string {
+	link := openseaLink(alert.Collection)
+	return fmt.Sprintf("NFTs %v%v: %v sold%v%v in %v minutes.%v \nHead on over and have a look\n %v \n\n #nft #nfts #nftcollection #nftcollectibles #nftminting #niftyscoops #NFTsales", alert.headline(), chainTag(alert.Chain), alert.Count, alert.mintersText(), alert.priceText(), alert.minutes(), alert.statsText(), link)
 }
 
-func sendTweet(collection *opensea.OpenSeaCollection, count int, twitKey TwitterKeys) {
+func sendTweetV2(ctx context.Context, status string, twitKey TwitterKeys, mediaIDs ...string) error {
 	if twitKey.ConsumerKey == "" {
-		log.Printf("Twitter Consumer Key environment variable (TWITTER_CONSUMER_KEY) is not set.\n")
-		return
+		slog.Warn("Twitter environment variable is not set", "variable", "TWITTER_CONSUMER_KEY")
+		return nil
 	}
 	if twitKey.ConsumerSecret == "" {
-		log.Printf("Twitter Consumer Secret environment variable (TWITTER_CONSUMER_SECRET) is not set.\n")
-		return
+		slog.Warn("Twitter environment variable is not set", "variable", "TWITTER_CONSUMER_SECRET")
+		return nil
 	}
 	if twitKey.Token == "" {
-		log.Printf("Twitter Token environment variable (TWITTER_TOKEN) is not set.\n")
-		return
+		slog.Warn("Twitter environment variable is not set", "variable", "TWITTER_TOKEN")
+		return nil
 	}
 	if twitKey.TokenSecret == "" {
-		log.Printf("Twitter Token Secret environment variable (TWITTER_TOKEN_SECRET) is not set.\n")
-		return
-	}
-	config := oauth1.NewConfig(twitKey.ConsumerKey, twitKey.ConsumerSecret)
-	token := oauth1.NewToken(twitKey.Token, twitKey.TokenSecret)
-	httpClient := config.Client(oauth1.NoContext, token)
-	// Twitter client
-	client := twitterV1.NewClient(httpClient)
-
-	replyTo := ""
-	if collection.Collection.TwitterUsername != "" {
-		// Twitter complaint 07-16-2022 - automated @mentions
-		//replyTo = "@" + collection.Collection.TwitterUsername
-	}
-	link := fmt.Sprintf("https://opensea.io/collection/%v", collection.Collection.Slug)
-	//link := collection.ExternalLink
-	status := fmt.Sprintf("NFTs Mint Alert: %v sold in 10 minutes.\n %v \nHead on over and have a look\n %v \n\n #nft #nfts #nftcollection #nftcollectibles #nftminting #niftyscoops #NFTsales", count, replyTo, link)
-	sup := twitterV1.StatusUpdateParams{
-		Status: status,
-	}
-	tweet, resp, err := client.Statuses.Update(status, &sup)
-	if err != nil {
-		log.Printf("Error sending tweet: (%v) %v\n", resp.StatusCode, err)
-		return
+		slog.Warn("Twitter environment variable is not set", "variable", "TWITTER_TOKEN_SECRET")
+		return nil
 	}
-	log.Printf("Tweet sent. Tweet ID: %v\n", tweet.ID)
+	_, err := postTweet(ctx, twitterClient(twitKey), status, "", mediaIDs...)
+	return err
 }
 
-func sendTweetV2(collection *opensea.OpenSeaCollection, count int, twitKey TwitterKeys) {
-	if twitKey.ConsumerKey == "" {
-		log.Printf("Twitter Consumer Key environment variable (TWITTER_CONSUMER_KEY) is not set.\n")
-		return
+// postTweet tweets the text with the uploaded media, in reply to the tweet
+// replyTo when it is set, and returns the new tweet's ID.
+func postTweet(ctx context.Context, client *twitter.Client, text string, replyTo string, mediaIDs ...string) (string, error) {
+	req := twitter.CreateTweetRequest{
+		Text: text,
 	}
-	if twitKey.ConsumerSecret == "" {
-		log.Printf("Twitter Consumer Secret environment variable (TWITTER_CONSUMER_SECRET) is not set.\n")
-		return
+	if replyTo != "" {
+		req.Reply = &twitter.CreateTweetReply{InReplyToTweetID: replyTo}
 	}
-	if twitKey.Token == "" {
-		log.Printf("Twitter Token environment variable (TWITTER_TOKEN) is not set.\n")
-		return
+	if len(mediaIDs) > 0 {
+		req.Media = &twitter.CreateTweetMedia{IDs: mediaIDs}
 	}
-	if twitKey.TokenSecret == "" {
-		log.Printf("Twitter Token Secret environment variable (TWITTER_TOKEN_SECRET) is not set.\n")
-		return
+	tweetResponse, err := client.CreateTweet(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("error sending tweet: %w", err)
 	}
-	config := oauth1.NewConfig(twitKey.ConsumerKey, twitKey.ConsumerSecret)
-	token := oauth1.NewToken(twitKey.Token, twitKey.TokenSecret)
-	httpClient := config.Client(oauth1.NoContext, token)
+	if tweetResponse.Tweet == nil {
+		return "", nil
+	}
+	slog.Info("Tweet sent", "channel", targetTwitter, "tweet_id", tweetResponse.Tweet.ID)
+	return tweetResponse.Tweet.ID, nil
+}
 
-	link := fmt.Sprintf("https://opensea.io/collection/%v", collection.Collection.Slug)
-	status := fmt.Sprintf("NFTs Mint Alert: %v sold in 10 minutes. \nHead on over and have a look\n %v \n\n #nft #nfts #nftcollection #nftcollectibles #nftminting #niftyscoops #NFTsales", count, link)
+// dryRun reports whether the run only logs the alerts, see DRY_RUN.
+func (e Event) dryRun() bool {
+	return e.DryRun || envBool("DRY_RUN")
+}
 
-	client := &twitter.Client{
-		Authorizer: authorize{
-			Token: "",
-		},
-		Client: httpClient,
-		Host:   "https://api.twitter.com",
-	}
+// runDeps are the services a run reads from and posts to. newRunDeps
+// connects them from the settings, the tests use the in-memory ones.
+type runDeps struct {
+	store stateStore
+	// lock takes the run lock and returns the function releasing it. Nil
+	// runs without a lock.
+	lock      func() (func(), error)
+	source    collectionSource
+	notifiers func(usage *UsageCounts) *notifiers
+	dial      func(chain Chain) (chainClient, error)
+	// loadCache and saveCache read and write the metadata cache. Nil runs
+	// without the cache.
+	loadCache func() *metadataCache
+	saveCache func(cache *metadataCache)
+	// recorder returns the store a chain's scan is recorded to. Nil when
+	// RECORD_PATH is not set.
+	recorder func(run string) *fixtureStore
+}
 
-	req := twitter.CreateTweetRequest{
-		Text: status,
+// newRunDeps checks the settings and connects the state store, run lock,
+// OpenSea, notifiers, chains and metadata cache they name.
+func newRunDeps() (*runDeps, error) {
+	if err := validateConfig(); err != nil {
+		return nil, err
 	}
-	fmt.Println("Callout to create tweet callout")
+	s3bucket := os.Getenv("S3_BUCKET")
+	s3key := os.Getenv("S3_FILE_KEY")
 
-	tweetResponse, err := client.CreateTweet(context.Background(), req)
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
 	if err != nil {
-		log.Printf("Error sending tweet: %v\n", err)
+		return nil, fmt.Errorf("unable to create a new session: %w", err)
 	}
-
-	enc, err := json.MarshalIndent(tweetResponse, "", "    ")
+	store, err := newStateStore(sess, s3bucket, s3key)
 	if err != nil {
-		log.Printf("Error unmarshaling tweet: %v\n", err)
+		return nil, err
 	}
-	fmt.Println(string(enc))
-}
-
-func processLogs(event Event) {
-	networkUrl := os.Getenv("ETH_NETWORK_URL")
-	if networkUrl == "" {
-		log.Printf("Ethereum network URL environment variable (ETH_NETWORK_URL) is not set.\n")
-		return
+	deps := &runDeps{
+		store:     store,
+		lock:      func() (func(), error) { return lockRun(sess, s3bucket, s3key) },
+		source:    newCollectionSource(os.Getenv("OPENSEA_API_KEY")),
+		notifiers: loadNotifiers,
+		dial:      dialChain,
 	}
-	s3bucket := os.Getenv("S3_BUCKET")
-	if s3bucket == "" {
-		log.Printf("S3 Bucket environment variable (S3_BUCKET) is not set.\n")
-		return
+	cacheKey := os.Getenv("METADATA_CACHE_KEY")
+	if cacheKey == "" {
+		cacheKey = s3key + ".cache"
 	}
-	s3key := os.Getenv("S3_FILE_KEY")
-	if s3key == "" {
-		log.Printf("S3 Key environment variable (S3_FILE_KEY) is not set.\n")
-		return
+	if cacheTTL := time.Duration(envInt("METADATA_CACHE_TTL_HOURS", defaultMetadataCacheTTLHours)) * time.Hour; cacheTTL > 0 {
+		deps.loadCache = func() *metadataCache { return loadMetadataCache(sess, s3bucket, cacheKey, cacheTTL) }
+		deps.saveCache = func(cache *metadataCache) { cache.save(sess, s3bucket, cacheKey) }
 	}
-	openseaKey := os.Getenv("OPENSEA_API_KEY")
-	if s3key == "" {
-		log.Printf("Opensea Key environment variable (OPENSEA_API_KEY) is not set.\n")
+	if recordPath := os.Getenv("RECORD_PATH"); recordPath != "" {
+		deps.recorder = func(run string) *fixtureStore { return newFixtureStore(sess, recordPath, run) }
+	}
+	return deps, nil
+}
+
+// runScan runs processLogs with the services named by the settings.
+func runScan(ctx context.Context, event Event) {
+	deps, err := newRunDeps()
+	if err != nil {
+		summary := newRunSummary()
+		summary.fail("%v", err)
+		if event.dryRun() {
+			summary.log()
+		} else {
+			reportRun(summary, getOpsConfig())
+		}
 		return
 	}
+	processLogs(ctx, event, deps)
+}
 
-	transHashList := make(map[string]string)
-	var transList []types.Log
-	addressList := make(map[string]int)
+func processLogs(ctx context.Context, event Event, deps *runDeps) {
+	budget := newTimeBudget(ctx)
+	summary := newRunSummary()
+	ops := getOpsConfig()
+	dryRun := event.dryRun()
+	if dryRun {
+		slog.Info("Dry run: alerts are logged, nothing is posted or saved")
+		defer summary.log()
+	} else {
+		defer reportRun(summary, ops)
+	}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1"),
-	})
+	chains, err := loadChains()
 	if err != nil {
-		log.Printf("Unable to create a new session %v\n", err)
+		summary.fail("%v", err)
 		return
 	}
-	status := GetStatus(sess, s3bucket, s3key)
-
-	client, err := ethclient.Dial(networkUrl)
+	lists, err := loadContractLists()
 	if err != nil {
-		log.Println(err)
+		summary.fail("%v", err)
 		return
 	}
+	lists.exclude(chains)
 
-	header, err := client.HeaderByNumber(context.Background(), nil) // Get the most recent block
-	if err != nil {
-		log.Fatal(err)
+	store := deps.store
+	if deps.lock != nil && !dryRun && event.Test == nil {
+		unlock, err := deps.lock()
+		if errors.Is(err, errLocked) {
+			// the previous run is still going, it will post the alerts
+			summary.skip("Run skipped: %v", err)
+			return
+		}
+		if err != nil {
+			summary.fail("Unable to take the run lock: %v", err)
+			return
+		}
+		defer unlock()
 	}
-	_ = header
-	toBlock := header.Number // current block
-	fromBlock := big.NewInt(0).Sub(toBlock, big.NewInt(newBlocks))
-	log.Printf("Start block: %v   End block: %v", fromBlock.String(), toBlock.String())
+	status := store.load()
 
-	// Query logs for transfer events
-	query := ethereum.FilterQuery{
-		FromBlock: fromBlock,
-		ToBlock:   toBlock,
-		Topics:    [][]common.Hash{{common.HexToHash(topicTransfer)}},
+	tiers, err := loadTiers()
+	if err != nil {
+		summary.fail("%v", err)
+		return
+	}
+	targets := deps.notifiers(&summary.Usage)
+	alerts := &alerter{
+		osclient:       deps.source,
+		targets:        targets,
+		summary:        summary,
+		budget:         budget,
+		canary:         getCanaryConfig(),
+		tiers:          tiers,
+		minutes:        windowMinutes(),
+		cooldown:       alertCooldown(),
+		filter:         getStatsFilter(),
+		safelist:       getSafelistFilter(),
+		lists:          lists,
+		minterFilter:   getMinterFilter(),
+		events:         newEventReader(),
+		scorer:         newScorer(),
+		tokens:         getTokenFilter(),
+		preview:        dryRun,
+		concurrency:    envInt("OPENSEA_CONCURRENCY", defaultOpenSeaConcurrency),
+		requestTimeout: time.Duration(envInt("OPENSEA_TIMEOUT_SECONDS", defaultOpenSeaTimeoutSeconds)) * time.Second,
+	}
+	if deps.loadCache != nil && event.Test == nil {
+		alerts.cache = deps.loadCache()
+	}
+	if event.Test != nil {
+		// Synthetic alerts don't touch the status file
+		alerts.sendTest(ctx, *event.Test)
+		return
+	}
+	if !dryRun {
+		targets.retryPending(ctx, &status, summary)
 	}
-	log.Println("Querying...")
 
-	logs, err := client.FilterLogs(context.Background(), query)
+	addresses, err := queryAddresses()
 	if err != nil {
-		log.Fatal(err)
-	}
-	log.Printf("Log entries to process: %v\n", len(logs))
-	// build a list of unique transactions
-	for _, vLog := range logs {
-		identifier := vLog.TxHash.Hex()
-		_, ok := transHashList[identifier]
-		if !ok {
-			transHashList[identifier] = identifier
-			transList = append(transList, vLog)
+		summary.fail("%v", err)
+		return
+	}
+	source := alerts.osclient
+	persist := func() {
+		// a dry run leaves the status as it was, so the next run still posts
+		// the alerts it previewed
+		if !dryRun {
+			store.save(status)
 		}
 	}
-	log.Printf("Unique transactions to process: %v\n", len(transHashList))
-	// Process the logs
-	lastBlock := types.Block{}
-	for count, txLog := range transList {
-		var topicHash common.Hash
-		topicHash.SetBytes(txLog.Topics[0][:])
-		topic := topicHash.Hex()
-		address := txLog.Address.Hex()
-		_ = lastBlock
-		_ = count
-		/*
-			if count == 0 || txLog.BlockNumber != lastBlock.NumberU64() {
-				blk, err := client.BlockByHash(context.Background(), txLog.BlockHash)
-				if err != nil {
-					log.Printf("Error reading block (%v): %v\n", txLog.BlockNumber, err)
-				}
-				lastBlock = *blk
-				//fmt.Printf("Block: %v(%v) [%v] %v\n", txLog.BlockNumber, lastBlock.NumberU64(), count, txLog.BlockHash.String())
-			}
-		*/
-		if topic != topicTransfer {
-			// skip everything not a transfer
-			continue
+	scanned := 0
+	for _, chain := range chains {
+		if budget.low() {
+			summary.addError("Time budget low (%v left), skipping %v", budget.remaining().Round(time.Second), chain.Name)
+			break
 		}
-		if len(txLog.Topics) < 4 {
-			// ERC20 transfers have 3 topics. Skip
+		// The logs are only kept when the run is being recorded
+		var recorded []types.Log
+		var record func([]types.Log)
+		if deps.recorder != nil {
+			record = func(logs []types.Log) { recorded = append(recorded, logs...) }
+		}
+		client, err := deps.dial(chain)
+		if err != nil {
+			summary.addError("%v: unable to connect to the network: %v", chain.DisplayName, err)
 			continue
 		}
-		if address == contractAddressOpenSea || address == contractENS || address == contractENS2 {
-			// skip opensea and ENS transfers.
+		counter, toBlock, err := scanChain(ctx, client, chain, status.Checkpoints[chain.Name], addresses, summary, record)
+		if err != nil {
+			// Carry on with the other chains. The checkpoint is left alone so
+			// the blocks are scanned again on the next run.
+			summary.addError("%v: %v", chain.DisplayName, err)
+			client.Close()
 			continue
 		}
+		scanned++
+		var recorder *fixtureStore
+		if deps.recorder != nil {
+			recorder = deps.recorder(chain.Name + "-" + toBlock.String())
+			recorder.writeChain(chain.Name)
+			recorder.writeLogs(recorded)
+			recorder.writeCooling(&status, alerts.cooldown)
+			alerts.osclient = &recordingSource{next: source, store: recorder}
+			// every lookup has to be recorded for the run to replay
+			alerts.cache = nil
+		}
+		archived := len(summary.Archive)
+		alerts.postChain(ctx, &status, client, chain, counter, toBlock, persist)
+		client.Close()
+		// The checkpoint only moves once the chain's alerts are posted, so a
+		// run that dies partway through posting scans the window again. The
+		// idempotency keys keep the alerts already sent from repeating.
+		if status.Checkpoints == nil {
+			status.Checkpoints = make(map[string]uint64)
+		}
+		status.Checkpoints[chain.Name] = toBlock.Uint64()
+		persist()
+		if recorder != nil && !dryRun {
+			recorder.writeAlerts(chain.Name, summary.Archive[archived:])
+		}
+	}
+	if scanned == 0 && len(chains) > 0 {
+		summary.fail("No chains could be scanned")
+	}
+
+	if dryRun {
+		slog.Info("End of dry run, status not saved")
+		return
+	}
+	finishStatus(&status, summary, ops, alerts.cooldown)
+	store.save(status)
+	if deps.saveCache != nil {
+		deps.saveCache(alerts.cache)
+	}
+	slog.Info("End")
+}
 
-		// Count all of the transfers for an address
-		fromAddr := common.BytesToAddress(txLog.Topics[1][:]).Hex()
-		toAddr := common.BytesToAddress(txLog.Topics[2][:]).Hex()
-		_ = toAddr
-		if fromAddr == nullAddress {
-			// count the mint transactions
-			identifier := txLog.TxHash.Hex()
-			_ = identifier
-			//fmt.Printf("tx: %v cont: %v\n", identifier, address)
-			count, _ := addressList[address]
-			count++
-			addressList[address] = count
+// finishStatus trims the status before it is saved at the end of a run and
+// records the run's API usage.
+func finishStatus(status *Status, summary *RunSummary, ops OpsConfig, cooldown time.Duration) {
+	status.trimPosted(cooldown)
+	checkSilence(status, summary, ops.SilencePeriod)
+	status.trimSent()
+	summary.UsageToday = status.recordUsage(summary.Usage)
+}
+
+// scanChain counts the mints for each contract in the blocks after the
+// checkpoint, or over the chain's block window when there is no checkpoint
+// yet. The logs are counted as each chunk arrives and are also passed to
+// record if it is set. It returns the counter and the last block scanned.
+func scanChain(ctx context.Context, client chainClient, chain Chain, checkpoint uint64, addresses []common.Address, summary *RunSummary, record func([]types.Log)) (*mintCounter, *big.Int, error) {
+	counter := newMintCounter(chain.Exclude)
+	if salesEnabled() {
+		counter.sales = newSaleCounter(chain.Exclude)
+	}
+	toBlock, err := scanLogs(ctx, client, chain, checkpoint, addresses, summary, func(logs []types.Log) {
+		for _, txLog := range logs {
+			counter.add(txLog)
+		}
+		if record != nil {
+			record(logs)
 		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return counter, toBlock, nil
+}
 
+// scanLogs queries the transfer logs from the block after the checkpoint to
+// the head, limited to the given contracts if there are any, and passes them
+// to handle a chunk at a time. It returns the last block scanned.
+func scanLogs(ctx context.Context, client chainClient, chain Chain, checkpoint uint64, addresses []common.Address, summary *RunSummary, handle func([]types.Log)) (*big.Int, error) {
+	summary.Usage.RPC++
+	header, err := client.HeaderByNumber(ctx, nil) // Get the most recent block
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the most recent block: %w", err)
 	}
+	toBlock := header.Number // current block
+	fromBlock := big.NewInt(0).Sub(toBlock, new(big.Int).SetUint64(chain.BlockWindow))
+	if checkpoint > 0 {
+		head := toBlock.Uint64()
+		if checkpoint >= head {
+			slog.Info("No new blocks", "chain", chain.Name, "checkpoint", checkpoint)
+			return new(big.Int).SetUint64(checkpoint), nil
+		}
+		if behind := head - checkpoint; behind > chain.MaxCatchup {
+			summary.addError("%v is %v blocks behind, skipping to the last %v blocks", chain.DisplayName, behind, chain.MaxCatchup)
+			fromBlock.SetUint64(head - chain.MaxCatchup + 1)
+		} else {
+			fromBlock.SetUint64(checkpoint + 1)
+		}
+	}
+	slog.Info("Scanning blocks", "chain", chain.Name, "from_block", fromBlock.Uint64(), "to_block", toBlock.Uint64())
+	summary.Blocks = append(summary.Blocks, fmt.Sprintf("%v %v-%v", chain.Name, fromBlock, toBlock))
+	summary.BlocksScanned += toBlock.Uint64() - fromBlock.Uint64() + 1
 
-	// order from most to least mint transactions
-	mintlist := rankByWordCount(addressList)
-
-	osclient := &opensea.Client{
-		Client:     http.DefaultClient,
-		Host:       "https://api.opensea.io",
-		Authorizer: openseaKey,
-	}
-	discordWebhookId := os.Getenv("DISCORD_WEBHOOK_ID")
-	discordWebhookToken := os.Getenv("DISCORD_WEBHOOK_TOKEN")
-	twitKey := TwitterKeys{
-		ConsumerKey:    os.Getenv("TWITTER_CONSUMER_KEY"),
-		ConsumerSecret: os.Getenv("TWITTER_CONSUMER_SECRET"),
-		Token:          os.Getenv("TWITTER_TOKEN"),
-		TokenSecret:    os.Getenv("TWITTER_TOKEN_SECRET"),
-	}
-	for index, mint := range mintlist {
-		//fmt.Printf("Key: %v val: %v\n", mint.Key, mint.Value)
-		if mint.Value > 100 {
-			// more than 100 mints
-			// Check to see if we've already posted about this nft
-			found := false
-			for _, recent := range status.Recents {
-				if recent == "" {
-					continue
-				}
-				if mint.Key == recent {
-					// We've already posted this NFT project
-					found = true
-					break
-				}
-			}
-			if found {
-				continue
-			}
-			collection, err := osclient.AssetContract(context.Background(), mint.Key)
-			if err != nil {
-				log.Printf("Opensea API error on contract %v: %v\n", mint.Key, err)
-				return
-			}
-			result := callOut(collection, mint.Key, mint.Value)
-			if result {
-				log.Printf("Sending tweet. Contract: %v Slug: %v TwitterId: %v\n", mint.Key, collection.Collection.Slug, collection.Collection.TwitterUsername)
-				//sendTweet(collection, mint.Value, twitKey)
-				sendTweetV2(collection, mint.Value, twitKey)
-				sendDiscordWebhook(collection, mint.Value, discordWebhookId, discordWebhookToken)
-				// Add to list of NFT projects we've posted
-				status.Recents = append(status.Recents, mint.Key)
+	// Query logs for transfer events
+	query := ethereum.FilterQuery{
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		Addresses: addresses,
+		Topics:    [][]common.Hash{transferTopics()},
+	}
+	if len(addresses) > 0 {
+		slog.Info("Limited to the watchlist contracts", "contracts", len(addresses))
+	}
+	if salesEnabled() {
+		// the marketplace events tell the sales from the other transfers
+		query.Topics = [][]common.Hash{append(transferTopics(), saleTopics()...)}
+		if len(addresses) > 0 {
+			query.Addresses = append([]common.Address{}, addresses...)
+			for marketplace := range marketplaces {
+				query.Addresses = append(query.Addresses, marketplace)
 			}
-			_ = err
 		}
-		_ = index
 	}
 
-	if len(status.Recents) > 200 {
-		// trim the oldest from the list
-		status.Recents = status.Recents[2:]
+	if os.Getenv("SCAN_MODE") == scanModeBlocks {
+		err = filterLogsByBlock(ctx, client, query, summary, handle)
+	} else {
+		var last uint64
+		if last, err = filterLogsChunked(ctx, client, query, summary, handle); err == nil && last < toBlock.Uint64() {
+			// stop at the first gap, the rest is scanned again next run
+			toBlock = new(big.Int).SetUint64(last)
+		}
 	}
-	SetStatus(sess, status, s3bucket, s3key)
-	log.Println("End")
-
-	//fmt.Println(addressList)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query transfer logs: %w", err)
+	}
+	return toBlock, nil
 }
 
 func HandleRequest(ctx context.Context, event Event) {
-	processLogs(event)
+	loadSecrets()
+	if event.Name == eventWeeklyReport {
+		sendWeeklyReport()
+		return
+	}
+	if days, ok := digestPeriods[event.Name]; ok {
+		sendDigest(ctx, days, event.dryRun())
+		return
+	}
+	if event.Replay != "" {
+		replayFixture(ctx, event.Replay)
+		return
+	}
+	runScan(ctx, event)
 	return
 }
 
 func init() {
 	godotenv.Load()
+	if err := loadConfig(); err != nil {
+		slog.Error("Invalid config file", "error", err)
+		os.Exit(1)
+	}
+	configureLogging()
 }
 
 func main() {
+	slog.Info("Starting", "version", buildInfo())
+	loadSecrets()
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(context.Background()))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "subscribe" {
+		os.Exit(runSubscribe(context.Background()))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		os.Exit(runHistory(context.Background(), os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(context.Background(), os.Args[2:]))
+	}
+	daemon := flag.Bool("daemon", false, "scan on a schedule instead of running as a Lambda")
+	once := flag.Bool("once", false, "scan once and exit instead of running as a Lambda")
+	interval := flag.Duration("interval", daemonInterval(), "time between scans with -daemon")
+	flag.Parse()
+	if *daemon {
+		os.Exit(runDaemon(context.Background(), *interval))
+	}
+	if *once {
+		runScan(context.Background(), Event{})
+		return
+	}
 	lambda.Start(HandleRequest)
 
-	//processLogs(Event{})
+	//processLogs(context.Background(), Event{})
 }
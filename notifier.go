@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"nftmintalert/opensea"
+)
+
+const (
+	targetTwitter = "twitter"
+	targetDiscord = "discord"
+	// targetCanaryDiscord receives the alerts selected by the canary mode
+	targetCanaryDiscord = "canary_discord"
+	targetLog           = "log"
+
+	sendAttempts = 3
+	sendBackoff  = 2 * time.Second
+
+	defaultNotifiers       = "twitter,discord"
+	defaultCanaryNotifiers = "canary_discord"
+)
+
+// Alert is a mint alert for a single collection.
+type Alert struct {
+	Key string `json:"key"`
+	// Chain is empty for alerts queued before multi-chain support, which
+	// are all Ethereum
+	Chain      string                     `json:"chain,omitempty"`
+	Contract   string                     `json:"contract"`
+	Count      int                        `json:"count"`
+	Collection *opensea.OpenSeaCollection `json:"collection"`
+	// Kind is empty for mint alerts and "sales" for sales alerts, whose
+	// Count is the tokens sold
+	Kind string `json:"kind,omitempty"`
+	// Canary alerts are only posted to the canary channels
+	Canary bool `json:"canary,omitempty"`
+	// Tier is the alert tier the count qualified for and Headline opens
+	// the message
+	Tier     string `json:"tier,omitempty"`
+	Headline string `json:"headline,omitempty"`
+	// Minutes is the time the count covers
+	Minutes int `json:"minutes,omitempty"`
+	// Price is the amount spent on the mints, if it could be read
+	Price *MintStatus `json:"price,omitempty"`
+	// Stats are the collection's floor price and volume, if known
+	Stats *opensea.Stats `json:"stats,omitempty"`
+	// Score is the trending score and Previous the mint count of the
+	// window before, see SCORING
+	Score    int `json:"score,omitempty"`
+	Previous int `json:"previous,omitempty"`
+	// Minters are the wallets minted to, if known
+	Minters *MinterStats `json:"minters,omitempty"`
+	// Activity is what the collection's OpenSea events show, see
+	// OPENSEA_EVENTS
+	Activity *EventActivity `json:"activity,omitempty"`
+	// Stealth marks a contract deployed within the window or without a
+	// collection yet
+	Stealth bool `json:"stealth,omitempty"`
+	// Unverified marks a collection that doesn't meet the call out
+	// criteria, only posted to the notifiers with <NOTIFIER>_UNVERIFIED
+	Unverified bool `json:"unverified,omitempty"`
+	// DYOR marks a collection without a trusted safelist status, see
+	// SAFELIST_MODE
+	DYOR bool `json:"dyor,omitempty"`
+}
+
+// Notifier posts alerts to a channel.
+type Notifier interface {
+	// Name identifies the notifier in NOTIFIERS, logs and the retry queue.
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// messageRenderer is implemented by the notifiers that can show the message
+// they would post, for DRY_RUN.
+type messageRenderer interface {
+	render(alert Alert) (string, error)
+}
+
+// notifierFactory creates a notifier from its environment configuration. It
+// returns an error when the notifier is not configured.
+type notifierFactory func() (Notifier, error)
+
+var notifierRegistry = make(map[string]notifierFactory)
+
+// registerNotifier makes a notifier available to NOTIFIERS and
+// CANARY_NOTIFIERS under the given name.
+func registerNotifier(name string, factory notifierFactory) {
+	notifierRegistry[name] = factory
+}
+
+func init() {
+	registerNotifier(targetTwitter, newTwitterNotifier)
+	registerNotifier(targetDiscord, func() (Notifier, error) {
+		return newDiscordNotifier(targetDiscord, "DISCORD_WEBHOOK_ID", "DISCORD_WEBHOOK_TOKEN")
+	})
+	registerNotifier(targetCanaryDiscord, func() (Notifier, error) {
+		return newDiscordNotifier(targetCanaryDiscord, "CANARY_DISCORD_WEBHOOK_ID", "CANARY_DISCORD_WEBHOOK_TOKEN")
+	})
+	registerNotifier(targetLog, newLogNotifier)
+}
+
+// notifiers is the set of channels the alerts are posted to.
+type notifiers struct {
+	public []Notifier
+	canary []Notifier
+	usage  *UsageCounts
+	// routes are the posting rules by notifier name
+	routes map[string]route
+}
+
+// loadNotifiers creates the notifiers listed in NOTIFIERS and
+// CANARY_NOTIFIERS with their posting rules. Notifiers that are unknown or
+// not configured are logged and left out.
+func loadNotifiers(usage *UsageCounts) *notifiers {
+	n := &notifiers{
+		public: buildNotifiers(envList("NOTIFIERS", defaultNotifiers)),
+		canary: buildNotifiers(envList("CANARY_NOTIFIERS", defaultCanaryNotifiers)),
+		usage:  usage,
+		routes: make(map[string]route),
+	}
+	for _, notifier := range append(n.public, n.canary...) {
+		n.routes[notifier.Name()] = loadRoute(notifier.Name())
+	}
+	return n
+}
+
+func buildNotifiers(names []string) []Notifier {
+	var list []Notifier
+	for _, name := range names {
+		factory, ok := notifierRegistry[name]
+		if !ok && strings.HasPrefix(name, discordPrefix) {
+			prefix := strings.ToUpper(name)
+			factory, ok = func() (Notifier, error) {
+				return newDiscordNotifier(name, prefix+"_WEBHOOK_ID", prefix+"_WEBHOOK_TOKEN")
+			}, true
+		}
+		if !ok && strings.HasPrefix(name, webhookPrefix) {
+			factory, ok = func() (Notifier, error) {
+				return newWebhookNotifier(name)
+			}, true
+		}
+		if !ok {
+			slog.Warn("Unknown notifier", "channel", name, "available", registeredNotifiers())
+			continue
+		}
+		notifier, err := factory()
+		if err != nil {
+			slog.Warn("Notifier is not configured", "channel", name, "error", err)
+			continue
+		}
+		list = append(list, notifier)
+	}
+	return list
+}
+
+func registeredNotifiers() string {
+	var names []string
+	for name := range notifierRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (n *notifiers) byName(name string) Notifier {
+	for _, notifier := range append(n.public, n.canary...) {
+		if notifier.Name() == name {
+			return notifier
+		}
+	}
+	return nil
+}
+
+// attemptsNotifier is implemented by the notifiers with their own number of
+// send attempts.
+type attemptsNotifier interface {
+	sendAttempts() int
+}
+
+// sendWithRetry sends the alert, backing off between attempts. It stops
+// early when the wait would run into the time budget's reserve, the failed
+// delivery is queued and retried by the next run.
+func (n *notifiers) sendWithRetry(ctx context.Context, notifier Notifier, alert Alert) error {
+	var err error
+	budget := newTimeBudget(ctx)
+	backoff := sendBackoff
+	attempts := sendAttempts
+	if a, ok := notifier.(attemptsNotifier); ok {
+		attempts = a.sendAttempts()
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		n.usage.countPost(notifier.Name())
+		err = notifier.Notify(ctx, alert)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("Sending alert failed", "channel", notifier.Name(), "contract", alert.Contract, "attempt", attempt, "attempts", attempts, "error", err)
+		if attempt == attempts || !budget.allows(backoff) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// notify sends the alert to every notifier and queues the failed deliveries.
+// The idempotency key for each post is saved with persist before posting so
+// a repeated run never posts the same alert twice.
+func (n *notifiers) notify(ctx context.Context, status *Status, summary *RunSummary, alert Alert, persist func()) {
+	list := n.routed(alert)
+	if len(list) == 0 {
+		slog.Warn("No notifiers configured for the alert, alert not sent", "contract", alert.Contract, "count", alert.Count, "tier", alert.Tier)
+	}
+	var sent, failed []string
+	defer func() { summary.archive(alert, sent, failed) }()
+	for _, notifier := range list {
+		if !status.claimKey(alert.Key + ":" + notifier.Name()) {
+			slog.Info("Skipping alert, already posted", "channel", notifier.Name(), "contract", alert.Contract, "key", alert.Key)
+			continue
+		}
+		persist()
+		err := n.sendWithRetry(ctx, notifier, alert)
+		if err == nil {
+			summary.countSent(notifier.Name())
+			sent = append(sent, notifier.Name())
+			continue
+		}
+		failed = append(failed, notifier.Name())
+		summary.addError("%v error on contract %v: %v", notifier.Name(), alert.Contract, err)
+		status.queuePending(notifier.Name(), alert, err)
+	}
+}
+
+// preview logs the message each notifier would post for the alert.
+func (n *notifiers) preview(alert Alert) {
+	for _, notifier := range n.routed(alert) {
+		renderer, ok := notifier.(messageRenderer)
+		if !ok {
+			continue
+		}
+		text, err := renderer.render(alert)
+		if err != nil {
+			slog.Warn("Unable to render the message", "channel", notifier.Name(), "contract", alert.Contract, "error", err)
+			continue
+		}
+		slog.Info("Dry run message", "channel", notifier.Name(), "contract", alert.Contract, "text", text)
+	}
+}
+
+// logNotifier writes the alerts to the log. Useful for trying out a
+// configuration without posting anything.
+type logNotifier struct {
+	template *messageTemplate
+}
+
+func newLogNotifier() (Notifier, error) {
+	template, err := loadMessageTemplate(targetLog)
+	if err != nil {
+		return nil, err
+	}
+	return logNotifier{template: template}, nil
+}
+
+func (logNotifier) Name() string { return targetLog }
+
+func (l logNotifier) render(alert Alert) (string, error) {
+	return l.template.text(alert, logText)
+}
+
+func (l logNotifier) Notify(ctx context.Context, alert Alert) error {
+	text, err := l.render(alert)
+	if err != nil {
+		return err
+	}
+	slog.Info("Alert", "channel", targetLog, "contract", alert.Contract, "text", text)
+	return nil
+}
+
+func logText(alert Alert) string {
+	return fmt.Sprintf("%v%v: %v %v%v%v %v (%v)%v %v", alert.headline(), chainTag(alert.Chain), alert.Count, alert.action(), alert.mintersText(), alert.priceText(), alert.Collection.Name, alert.Contract, alert.statsText(), openseaLink(alert.Collection))
+}
+
+func openseaLink(collection *opensea.OpenSeaCollection) string {
+	return fmt.Sprintf("https://opensea.io/collection/%v", collection.Collection.Slug)
+}
+
+// twitterNotifier tweets the alerts from the account in TWITTER_*.
+type twitterNotifier struct {
+	keys     TwitterKeys
+	template *messageTemplate
+	// cards attaches a share card image to the tweets, see
+	// TWITTER_IMAGE_CARDS. Nil tweets the text only.
+	cards *cardRenderer
+}
+
+func newTwitterNotifier() (Notifier, error) {
+	keys := TwitterKeys{
+		ConsumerKey:    os.Getenv("TWITTER_CONSUMER_KEY"),
+		ConsumerSecret: os.Getenv("TWITTER_CONSUMER_SECRET"),
+		Token:          os.Getenv("TWITTER_TOKEN"),
+		TokenSecret:    os.Getenv("TWITTER_TOKEN_SECRET"),
+	}
+	if keys.ConsumerKey == "" || keys.ConsumerSecret == "" || keys.Token == "" || keys.TokenSecret == "" {
+		return nil, fmt.Errorf("TWITTER_CONSUMER_KEY, TWITTER_CONSUMER_SECRET, TWITTER_TOKEN and TWITTER_TOKEN_SECRET must be set")
+	}
+	template, err := loadMessageTemplate(targetTwitter)
+	if err != nil {
+		return nil, err
+	}
+	t := &twitterNotifier{keys: keys, template: template}
+	if envBool("TWITTER_IMAGE_CARDS") {
+		if t.cards, err = newCardRenderer(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *twitterNotifier) Name() string { return targetTwitter }
+
+func (t *twitterNotifier) render(alert Alert) (string, error) {
+	return t.template.text(alert, tweetText)
+}
+
+func (t *twitterNotifier) Notify(ctx context.Context, alert Alert) error {
+	status, err := t.render(alert)
+	if err != nil {
+		return err
+	}
+	var media []string
+	if id, err := t.card(ctx, alert); err != nil {
+		// tweet the text rather than nothing
+		slog.Warn("Unable to attach the share card", "channel", targetTwitter, "contract", alert.Contract, "error", err)
+	} else if id != "" {
+		media = append(media, id)
+	}
+	return sendTweetV2(ctx, status, t.keys, media...)
+}
+
+// card renders and uploads the alert's share card and returns its media ID,
+// or "" when the cards are off.
+func (t *twitterNotifier) card(ctx context.Context, alert Alert) (string, error) {
+	if t.cards == nil {
+		return "", nil
+	}
+	png, err := t.cards.render(ctx, alert)
+	if err != nil {
+		return "", err
+	}
+	return uploadMedia(ctx, twitterHTTPClient(t.keys), "card.png", png)
+}
+
+// discordNotifier posts the alerts to a Discord webhook.
+type discordNotifier struct {
+	name         string
+	host         string
+	webhookId    string
+	webhookToken string
+	client       *http.Client
+	template     *messageTemplate
+	colors       map[string]int
+}
+
+// newDiscordWebhook is the notifier's webhook, without a message template.
+func newDiscordWebhook(name string, webhookId string, webhookToken string) *discordNotifier {
+	return &discordNotifier{
+		name:         name,
+		host:         discordWebhooksURL,
+		webhookId:    webhookId,
+		webhookToken: webhookToken,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func newDiscordNotifier(name string, idVar string, tokenVar string) (Notifier, error) {
+	d := newDiscordWebhook(name, os.Getenv(idVar), os.Getenv(tokenVar))
+	if d.webhookId == "" || d.webhookToken == "" {
+		return nil, fmt.Errorf("%v and %v must be set", idVar, tokenVar)
+	}
+	template, err := loadMessageTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	d.template = template
+	d.colors = loadDiscordColors()
+	return d, nil
+}
+
+func (d *discordNotifier) Name() string { return d.name }
+
+func (d *discordNotifier) render(alert Alert) (string, error) {
+	return d.template.text(alert, discordText)
+}
+
+func (d *discordNotifier) Notify(ctx context.Context, alert Alert) error {
+	description, err := d.render(alert)
+	if err != nil {
+		return err
+	}
+	id, err := d.execute(ctx, discordHeadline(alert), discordEmbed(alert, description, discordColor(d.colors, alert.Tier)))
+	if err != nil {
+		return err
+	}
+	slog.Info("Discord message sent", "channel", d.name, "contract", alert.Contract, "message_id", id)
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testAlert() Alert {
+	contract := "0x1000000000000000000000000000000000000001"
+	return Alert{
+		Key:        "mint:" + contract,
+		Chain:      chainEthereum,
+		Contract:   contract,
+		Count:      150,
+		Collection: mockCollection(contract),
+		Stats:      mockStats(),
+		Tier:       tierNormal,
+		Headline:   defaultHeadline,
+		Minutes:    defaultWindowMinutes,
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	alert := testAlert()
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost {
+			t.Errorf("method %v", r.Method)
+		}
+		if key := r.Header.Get("Idempotency-Key"); key != alert.Key {
+			t.Errorf("idempotency key %q, want %q", key, alert.Key)
+		}
+		notifier := &webhookNotifier{secret: "secret"}
+		if signature := r.Header.Get(defaultSignatureHeader); signature != "sha256="+notifier.signature(body) {
+			t.Errorf("signature %q does not match the body", signature)
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("body: %v", err)
+		}
+		if !strings.Contains(string(body), alert.Contract) {
+			t.Errorf("body %s lacks the contract", body)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("WEBHOOK_URL", srv.URL)
+	t.Setenv("WEBHOOK_SECRET", "secret")
+
+	notifier, err := newWebhookNotifier(targetWebhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("%v requests, want 1", requests)
+	}
+}
+
+func TestWebhookNotifierStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	t.Setenv("WEBHOOK_URL", srv.URL)
+
+	notifier, err := newWebhookNotifier(targetWebhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = notifier.Notify(context.Background(), testAlert())
+	if err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("error %v, want the 503 status", err)
+	}
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	alert := testAlert()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1234/token" {
+			t.Errorf("path %v, want the webhook ID and token", r.URL.Path)
+		}
+		if r.URL.Query().Get("wait") != "true" {
+			t.Error("the message ID is not waited for")
+		}
+		var params struct {
+			Content string `json:"content"`
+			Embeds  []struct {
+				Title       string `json:"title"`
+				Description string `json:"description"`
+			} `json:"embeds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("body: %v", err)
+		}
+		if params.Content != discordHeadline(alert) {
+			t.Errorf("content %q, want the headline %q", params.Content, discordHeadline(alert))
+		}
+		if len(params.Embeds) != 1 || params.Embeds[0].Title != alert.Collection.Name {
+			t.Errorf("embeds %+v, want one for the collection", params.Embeds)
+		}
+		w.Write([]byte(`{"id":"42"}`))
+	}))
+	defer srv.Close()
+	t.Setenv("DISCORD_WEBHOOK_ID", "1234")
+	t.Setenv("DISCORD_WEBHOOK_TOKEN", "token")
+
+	notifier, err := newDiscordNotifier(targetDiscord, "DISCORD_WEBHOOK_ID", "DISCORD_WEBHOOK_TOKEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.(*discordNotifier).host = srv.URL
+	if err := notifier.Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscordWebhookStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Unknown Webhook"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+	webhook := newDiscordWebhook(targetDiscord, "1234", "secret-token")
+	webhook.host = srv.URL
+
+	_, err := webhook.execute(context.Background(), "content", nil)
+	if err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("error %v, want the 404 status", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("the token is in the error %v", err)
+	}
+}
+
+func TestDiscordWebhookCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a cancelled send reached the webhook")
+	}))
+	defer srv.Close()
+	webhook := newDiscordWebhook(targetDiscord, "1234", "token")
+	webhook.host = srv.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := webhook.execute(ctx, "content", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want the cancellation", err)
+	}
+}
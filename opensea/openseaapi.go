@@ -6,17 +6,29 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type endpoint string
 
 const (
-	retrieveSingleContractEndpoint  endpoint = "api/v1/asset_contract/{id}"
-	retrieveCollectionStatsEndpoint endpoint = "api/v1/collection/{id}/stats"
+	retrieveContractV2Endpoint        endpoint = "api/v2/chain/{chain}/contract/{id}"
+	retrieveCollectionV2Endpoint      endpoint = "api/v2/collections/{id}"
+	retrieveCollectionStatsV2Endpoint endpoint = "api/v2/collections/{id}/stats"
+	listCollectionEventsV2Endpoint    endpoint = "api/v2/events/collection/{id}"
 
-	idTag = "{id}"
+	// DefaultChain is the chain used by the methods that predate the v2 API
+	DefaultChain = "ethereum"
+
+	idTag    = "{id}"
+	chainTag = "{chain}"
 )
 
 func (e endpoint) url(host string) string {
@@ -28,10 +40,86 @@ func (e endpoint) urlID(host, id string) string {
 	return strings.ReplaceAll(u, idTag, id)
 }
 
+func (e endpoint) urlChainID(host, chain, id string) string {
+	return strings.ReplaceAll(e.urlID(host, id), chainTag, chain)
+}
+
 type Client struct {
 	Authorizer string
 	Client     *http.Client
 	Host       string
+	// RequestsPerSecond limits the rate of requests. Zero is unlimited.
+	RequestsPerSecond float64
+	// MaxRetries is the number of times a request is retried after a 429,
+	// a 5xx or a network error. Zero does not retry.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for each
+	// retry after. It defaults to one second. A Retry-After header takes
+	// precedence.
+	RetryBackoff time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+const (
+	defaultRetryBackoff = time.Second
+	// maxRetryAfter caps the wait a Retry-After header asks for
+	maxRetryAfter = 30 * time.Second
+)
+
+// wait blocks until the rate limit allows another request.
+func (c *Client) wait(ctx context.Context) error {
+	if c.RequestsPerSecond <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / c.RequestsPerSecond)
+	c.mu.Lock()
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	delay := c.next.Sub(now)
+	c.next = c.next.Add(interval)
+	c.mu.Unlock()
+	return sleep(ctx, delay)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryable reports whether a response status is worth retrying.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// backoff returns the wait before the given retry, using the Retry-After
+// header when the server sent one, up to maxRetryAfter.
+func (c *Client) backoff(retry int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && after >= 0 {
+			if wait := time.Duration(after) * time.Second; wait < maxRetryAfter {
+				return wait
+			}
+			return maxRetryAfter
+		}
+	}
+	base := c.RetryBackoff
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	return base << uint(retry)
 }
 
 // Error is part of the HTTP response error
@@ -40,6 +128,18 @@ type Error struct {
 	Message    string      `json:"message"`
 }
 
+// UnmarshalJSON accepts the v1 error objects and the plain strings the v2
+// API returns.
+func (e *Error) UnmarshalJSON(b []byte) error {
+	var message string
+	if err := json.Unmarshal(b, &message); err == nil {
+		e.Message = message
+		return nil
+	}
+	type plain Error
+	return json.Unmarshal(b, (*plain)(e))
+}
+
 // HTTPError is a response error where the body is not JSON, but XML.  This commonly seen in 404 errors.
 type HTTPError struct {
 	Status     string
@@ -48,7 +148,7 @@ type HTTPError struct {
 }
 
 func (h *HTTPError) Error() string {
-	return fmt.Sprintf("twitter [%s] status: %s code: %d", h.URL, h.Status, h.StatusCode)
+	return fmt.Sprintf("opensea [%s] status: %s code: %d", h.URL, h.Status, h.StatusCode)
 }
 
 // ErrorResponse is returned by a non-success callout
@@ -61,6 +161,13 @@ type ErrorResponse struct {
 }
 
 func (e *ErrorResponse) Error() string {
+	if e.Title == "" && e.Detail == "" && len(e.Errors) > 0 {
+		messages := make([]string, len(e.Errors))
+		for i, err := range e.Errors {
+			messages[i] = err.Message
+		}
+		return fmt.Sprintf("opensea callout status %d %s", e.StatusCode, strings.Join(messages, "; "))
+	}
 	return fmt.Sprintf("opensea callout status %d %s:%s", e.StatusCode, e.Title, e.Detail)
 }
 
@@ -153,104 +260,446 @@ type OpenSeaStats struct {
 	} `json:"stats"`
 }
 
+// AssetContract looks up an Ethereum contract and its collection. The v1
+// asset_contract endpoint is deprecated, the lookup uses the v2 API.
 func (c *Client) AssetContract(ctx context.Context, id string) (*OpenSeaCollection, error) {
 	if len(id) == 0 {
-		return nil, fmt.Errorf("collection stats: id is required: %w", ErrParameter)
+		return nil, fmt.Errorf("asset contract: id is required: %w", ErrParameter)
 	}
+	return c.ChainAssetContract(ctx, DefaultChain, id)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, retrieveSingleContractEndpoint.urlID(c.Host, id), nil)
+// CollectionStats retrieves the stats for a collection slug. The v1 stats
+// endpoint is deprecated, the stats come from the v2 API and are returned in
+// the v1 shape. The 1, 7 and 30 day figures are filled in when v2 returns
+// those intervals.
+func (c *Client) CollectionStats(ctx context.Context, id string) (*OpenSeaStats, error) {
+	if len(id) == 0 {
+		return nil, fmt.Errorf("collection stats: id is required: %w", ErrParameter)
+	}
+	v2, err := c.Stats(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("collection stats: request: %w", err)
+		return nil, err
 	}
-	req.Header.Add("Accept", "application/json")
-	if c.Authorizer != "" {
-		req.Header.Add("X-API-KEY", c.Authorizer)
+	stats := &OpenSeaStats{}
+	stats.Stats.TotalVolume = v2.Total.Volume
+	stats.Stats.TotalSales = v2.Total.Sales
+	stats.Stats.AveragePrice = v2.Total.AveragePrice
+	stats.Stats.NumOwners = v2.Total.NumOwners
+	stats.Stats.MarketCap = v2.Total.MarketCap
+	stats.Stats.FloorPrice = v2.Total.FloorPrice
+	for _, interval := range v2.Intervals {
+		switch interval.Interval {
+		case IntervalOneDay:
+			stats.Stats.OneDayVolume = interval.Volume
+			stats.Stats.OneDayChange = interval.VolumeChange
+			stats.Stats.OneDaySales = interval.Sales
+			stats.Stats.OneDayAveragePrice = interval.AveragePrice
+		case IntervalSevenDay:
+			stats.Stats.SevenDayVolume = interval.Volume
+			stats.Stats.SevenDayChange = interval.VolumeChange
+			stats.Stats.SevenDaySales = interval.Sales
+			stats.Stats.SevenDayAveragePrice = interval.AveragePrice
+		case IntervalThirtyDay:
+			stats.Stats.ThirtyDayVolume = interval.Volume
+			stats.Stats.ThirtyDayChange = interval.VolumeChange
+			stats.Stats.ThirtyDaySales = interval.Sales
+			stats.Stats.ThirtyDayAveragePrice = interval.AveragePrice
+		}
 	}
-	//c.Authorizer.Add(req)
-	//opts.addQuery(req)
-	q := req.URL.Query()
-	req.URL.RawQuery = q.Encode()
+	return stats, nil
+}
 
-	resp, err := c.Client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("collection stats response: %w", err)
+// Contract is the v2 API response for a contract
+type Contract struct {
+	Address          string `json:"address"`
+	Chain            string `json:"chain"`
+	Collection       string `json:"collection"`
+	ContractStandard string `json:"contract_standard"`
+	Name             string `json:"name"`
+	TotalSupply      int    `json:"total_supply"`
+}
+
+// Collection is the v2 API response for a collection
+type Collection struct {
+	Collection              string `json:"collection"`
+	Name                    string `json:"name"`
+	Description             string `json:"description"`
+	ImageURL                string `json:"image_url"`
+	BannerImageURL          string `json:"banner_image_url"`
+	Owner                   string `json:"owner"`
+	SafelistStatus          string `json:"safelist_status"`
+	Category                string `json:"category"`
+	IsDisabled              bool   `json:"is_disabled"`
+	IsNSFW                  bool   `json:"is_nsfw"`
+	TraitOffersEnabled      bool   `json:"trait_offers_enabled"`
+	CollectionOffersEnabled bool   `json:"collection_offers_enabled"`
+	OpenseaURL              string `json:"opensea_url"`
+	ProjectURL              string `json:"project_url"`
+	WikiURL                 string `json:"wiki_url"`
+	DiscordURL              string `json:"discord_url"`
+	TelegramURL             string `json:"telegram_url"`
+	TwitterUsername         string `json:"twitter_username"`
+	InstagramUsername       string `json:"instagram_username"`
+	Contracts               []struct {
+		Address string `json:"address"`
+		Chain   string `json:"chain"`
+	} `json:"contracts"`
+	TotalSupply int    `json:"total_supply"`
+	CreatedDate string `json:"created_date"`
+}
+
+// Intervals reported by the v2 stats endpoint
+const (
+	IntervalOneDay    = "one_day"
+	IntervalSevenDay  = "seven_day"
+	IntervalThirtyDay = "thirty_day"
+)
+
+// Stats is the v2 API response for collection stats
+type Stats struct {
+	Total struct {
+		Volume           float64 `json:"volume"`
+		Sales            float64 `json:"sales"`
+		AveragePrice     float64 `json:"average_price"`
+		NumOwners        int     `json:"num_owners"`
+		MarketCap        float64 `json:"market_cap"`
+		FloorPrice       float64 `json:"floor_price"`
+		FloorPriceSymbol string  `json:"floor_price_symbol"`
+	} `json:"total"`
+	Intervals []StatsInterval `json:"intervals"`
+}
+
+// StatsInterval is the activity of a collection over one of the intervals
+type StatsInterval struct {
+	Interval     string  `json:"interval"`
+	Volume       float64 `json:"volume"`
+	VolumeDiff   float64 `json:"volume_diff"`
+	VolumeChange float64 `json:"volume_change"`
+	Sales        float64 `json:"sales"`
+	SalesDiff    float64 `json:"sales_diff"`
+	AveragePrice float64 `json:"average_price"`
+}
+
+// Interval returns the stats for the named interval, or an empty interval
+// if the response did not include it.
+func (s *Stats) Interval(name string) StatsInterval {
+	for _, interval := range s.Intervals {
+		if interval.Interval == name {
+			return interval
+		}
 	}
-	defer resp.Body.Close()
+	return StatsInterval{Interval: name}
+}
 
-	respBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("collection stats response read: %w", err)
+// Event types of the v2 events endpoint
+const (
+	EventTypeSale     = "sale"
+	EventTypeTransfer = "transfer"
+	EventTypeMint     = "mint"
+	EventTypeListing  = "listing"
+	EventTypeOffer    = "offer"
+)
+
+// NullAddress is the sender of minted tokens.
+const NullAddress = "0x0000000000000000000000000000000000000000"
+
+// MaxEventsPage is the most events the API returns in a page.
+const MaxEventsPage = 50
+
+// EventsQuery filters the events of a collection.
+type EventsQuery struct {
+	// EventTypes are the kinds of events returned. Empty returns all.
+	EventTypes []string
+	// After and Before limit the time of the events. Zero is no limit.
+	After  time.Time
+	Before time.Time
+	// Limit is the page size, at most MaxEventsPage. Zero uses the API's
+	// default.
+	Limit int
+	// Next is the cursor of the page to return, from the previous page.
+	Next string
+}
+
+// values returns the query string parameters.
+func (q EventsQuery) values() url.Values {
+	values := url.Values{}
+	for _, eventType := range q.EventTypes {
+		values.Add("event_type", eventType)
+	}
+	if !q.After.IsZero() {
+		values.Set("after", strconv.FormatInt(q.After.Unix(), 10))
+	}
+	if !q.Before.IsZero() {
+		values.Set("before", strconv.FormatInt(q.Before.Unix(), 10))
+	}
+	if q.Limit > 0 {
+		limit := q.Limit
+		if limit > MaxEventsPage {
+			limit = MaxEventsPage
+		}
+		values.Set("limit", strconv.Itoa(limit))
+	}
+	if q.Next != "" {
+		values.Set("next", q.Next)
+	}
+	return values
+}
+
+// Events is a page of the v2 API response for collection events. Next is
+// the cursor of the following page, empty on the last page.
+type Events struct {
+	AssetEvents []Event `json:"asset_events"`
+	Next        string  `json:"next"`
+}
+
+// Event is a sale, transfer, mint, listing or offer of a collection's NFT.
+// The sale fields are empty on transfers and the transfer fields on sales.
+type Event struct {
+	EventType      string   `json:"event_type"`
+	EventTimestamp int64    `json:"event_timestamp"`
+	Chain          string   `json:"chain"`
+	Transaction    string   `json:"transaction"`
+	Quantity       int      `json:"quantity"`
+	FromAddress    string   `json:"from_address"`
+	ToAddress      string   `json:"to_address"`
+	Seller         string   `json:"seller"`
+	Buyer          string   `json:"buyer"`
+	Payment        *Payment `json:"payment"`
+	NFT            *NFT     `json:"nft"`
+}
+
+// Payment is the amount paid in a sale, in the token's smallest unit.
+type Payment struct {
+	Quantity     string `json:"quantity"`
+	TokenAddress string `json:"token_address"`
+	Decimals     int    `json:"decimals"`
+	Symbol       string `json:"symbol"`
+}
+
+// NFT is the token an event is about.
+type NFT struct {
+	Identifier string `json:"identifier"`
+	Collection string `json:"collection"`
+	Contract   string `json:"contract"`
+	Name       string `json:"name"`
+	ImageURL   string `json:"image_url"`
+}
+
+// Time returns when the event happened.
+func (e Event) Time() time.Time {
+	return time.Unix(e.EventTimestamp, 0)
+}
+
+// IsMint reports whether the event is a mint: a mint event, or a transfer
+// or sale from the null address.
+func (e Event) IsMint() bool {
+	switch e.EventType {
+	case EventTypeMint:
+		return true
+	case EventTypeTransfer:
+		return strings.EqualFold(e.FromAddress, NullAddress)
+	case EventTypeSale:
+		return strings.EqualFold(e.Seller, NullAddress)
+	}
+	return false
+}
+
+// Recipient returns the wallet the NFT went to.
+func (e Event) Recipient() string {
+	if e.Buyer != "" {
+		return e.Buyer
+	}
+	return e.ToAddress
+}
+
+// Amount returns the payment in whole tokens, e.g. ETH rather than wei.
+func (p *Payment) Amount() float64 {
+	quantity, ok := new(big.Float).SetString(p.Quantity)
+	if !ok {
+		return 0
+	}
+	unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.Decimals)), nil))
+	amount, _ := quantity.Quo(quantity, unit).Float64()
+	return amount
+}
+
+// get performs a GET request for the url and decodes the JSON response into
+// v. Requests are rate limited and retried as configured on the client.
+func (c *Client) get(ctx context.Context, name string, url string, v interface{}) error {
+	var resp *http.Response
+	var respBytes []byte
+	for retry := 0; ; retry++ {
+		if err := c.wait(ctx); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		var err error
+		resp, respBytes, err = c.do(ctx, name, url)
+		if err == nil && !retryable(resp.StatusCode) {
+			break
+		}
+		wait := c.backoff(retry, resp)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			// no time to wait for the retry, fail with this response
+			retry = c.MaxRetries
+		}
+		if retry >= c.MaxRetries || ctx.Err() != nil {
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
 	}
-	//body := string(respBytes)
-	//fmt.Println(body)
 	if resp.StatusCode != http.StatusOK {
 		e := &ErrorResponse{}
 		if err := json.Unmarshal(respBytes, e); err != nil {
-			return nil, &HTTPError{
+			return &HTTPError{
 				Status:     resp.Status,
 				StatusCode: resp.StatusCode,
 				URL:        resp.Request.URL.String(),
 			}
 		}
 		e.StatusCode = resp.StatusCode
-		return nil, e
+		return e
 	}
 
-	collection := &OpenSeaCollection{}
-
-	if err := json.Unmarshal(respBytes, collection); err != nil {
-		return nil, fmt.Errorf("collection stats raw response error decode: %w", err)
+	if err := json.Unmarshal(respBytes, v); err != nil {
+		return fmt.Errorf("%s raw response error decode: %w", name, err)
 	}
-
-	return collection, nil
+	return nil
 }
 
-func (c *Client) CollectionStats(ctx context.Context, id string) (*OpenSeaStats, error) {
-	if len(id) == 0 {
-		return nil, fmt.Errorf("collection stats: id is required: %w", ErrParameter)
-	}
+type requestCountKey struct{}
+
+// WithRequestCount returns a context that counts the requests the client
+// sends with it in count, retries included. A lookup such as
+// ChainAssetContract can take more than one request.
+func WithRequestCount(ctx context.Context, count *int64) context.Context {
+	return context.WithValue(ctx, requestCountKey{}, count)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, retrieveCollectionStatsEndpoint.urlID(c.Host, id), nil)
+// do sends a single GET request and reads the response.
+func (c *Client) do(ctx context.Context, name string, url string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("collection stats: request: %w", err)
+		return nil, nil, fmt.Errorf("%s: request: %w", name, err)
+	}
+	if count, ok := ctx.Value(requestCountKey{}).(*int64); ok {
+		atomic.AddInt64(count, 1)
 	}
 	req.Header.Add("Accept", "application/json")
 	if c.Authorizer != "" {
 		req.Header.Add("X-API-KEY", c.Authorizer)
 	}
-	//c.Authorizer.Add(req)
-	//opts.addQuery(req)
-	q := req.URL.Query()
-	req.URL.RawQuery = q.Encode()
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("collection stats response: %w", err)
+		return nil, nil, fmt.Errorf("%s response: %w", name, err)
 	}
 	defer resp.Body.Close()
 
 	respBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("collection stats response read: %w", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		e := &ErrorResponse{}
-		if err := json.Unmarshal(respBytes, e); err != nil {
-			return nil, &HTTPError{
-				Status:     resp.Status,
-				StatusCode: resp.StatusCode,
-				URL:        resp.Request.URL.String(),
-			}
-		}
-		e.StatusCode = resp.StatusCode
-		return nil, e
+		return nil, nil, fmt.Errorf("%s response read: %w", name, err)
 	}
+	return resp, respBytes, nil
+}
 
-	stats := &OpenSeaStats{}
+// Contract retrieves a contract on a chain using the v2 API.
+func (c *Client) Contract(ctx context.Context, chain string, address string) (*Contract, error) {
+	if len(chain) == 0 || len(address) == 0 {
+		return nil, fmt.Errorf("contract: chain and address are required: %w", ErrParameter)
+	}
+	contract := &Contract{}
+	if err := c.get(ctx, "contract", retrieveContractV2Endpoint.urlChainID(c.Host, chain, address), contract); err != nil {
+		return nil, err
+	}
+	return contract, nil
+}
 
-	if err := json.Unmarshal(respBytes, stats); err != nil {
-		return nil, fmt.Errorf("collection stats raw response error decode: %w", err)
+// Collection retrieves a collection by slug using the v2 API.
+func (c *Client) Collection(ctx context.Context, slug string) (*Collection, error) {
+	if len(slug) == 0 {
+		return nil, fmt.Errorf("collection: slug is required: %w", ErrParameter)
 	}
+	collection := &Collection{}
+	if err := c.get(ctx, "collection", retrieveCollectionV2Endpoint.urlID(c.Host, slug), collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
 
+// Stats retrieves the stats for a collection slug using the v2 API.
+func (c *Client) Stats(ctx context.Context, slug string) (*Stats, error) {
+	if len(slug) == 0 {
+		return nil, fmt.Errorf("stats: slug is required: %w", ErrParameter)
+	}
+	stats := &Stats{}
+	if err := c.get(ctx, "stats", retrieveCollectionStatsV2Endpoint.urlID(c.Host, slug), stats); err != nil {
+		return nil, err
+	}
 	return stats, nil
 }
+
+// Events retrieves a page of a collection's events using the v2 API, newest
+// first. Pass the Next cursor of the page in the query for the next page.
+func (c *Client) Events(ctx context.Context, slug string, query EventsQuery) (*Events, error) {
+	if len(slug) == 0 {
+		return nil, fmt.Errorf("events: slug is required: %w", ErrParameter)
+	}
+	u := listCollectionEventsV2Endpoint.urlID(c.Host, slug)
+	if values := query.values(); len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+	events := &Events{}
+	if err := c.get(ctx, "events", u, events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ChainAssetContract looks up a contract and its collection on any chain
+// supported by the v2 API and returns them in the v1 asset contract shape.
+func (c *Client) ChainAssetContract(ctx context.Context, chain string, address string) (*OpenSeaCollection, error) {
+	contract, err := c.Contract(ctx, chain, address)
+	if err != nil {
+		return nil, err
+	}
+	result := &OpenSeaCollection{
+		Address:     contract.Address,
+		Name:        contract.Name,
+		SchemaName:  strings.ToUpper(contract.ContractStandard),
+		TotalSupply: strconv.Itoa(contract.TotalSupply),
+	}
+	if contract.Collection == "" {
+		// not part of a collection yet
+		return result, nil
+	}
+	collection, err := c.Collection(ctx, contract.Collection)
+	if err != nil {
+		return nil, err
+	}
+	if result.Name == "" {
+		result.Name = collection.Name
+	}
+	result.Description = collection.Description
+	result.ExternalLink = collection.ProjectURL
+	result.ImageURL = collection.ImageURL
+	result.Collection.Slug = collection.Collection
+	result.Collection.Name = collection.Name
+	result.Collection.Description = collection.Description
+	result.Collection.ExternalURL = collection.ProjectURL
+	result.Collection.ImageURL = collection.ImageURL
+	result.Collection.BannerImageURL = collection.BannerImageURL
+	result.Collection.SafelistRequestStatus = collection.SafelistStatus
+	result.Collection.TwitterUsername = collection.TwitterUsername
+	result.Collection.InstagramUsername = collection.InstagramUsername
+	result.Collection.DiscordURL = collection.DiscordURL
+	result.Collection.TelegramURL = collection.TelegramURL
+	result.Collection.WikiURL = collection.WikiURL
+	result.Collection.CreatedDate = collection.CreatedDate
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package opensea
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChainAssetContract(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("X-API-KEY"); key != "key" {
+			t.Errorf("API key %q", key)
+		}
+		switch r.URL.Path {
+		case "/api/v2/chain/ethereum/contract/0xabc":
+			w.Write([]byte(`{"address":"0xabc","collection":"alpha","contract_standard":"erc721","total_supply":10}`))
+		case "/api/v2/collections/alpha":
+			w.Write([]byte(`{"collection":"alpha","name":"Alpha","project_url":"https://alpha.example","twitter_username":"alpha"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client := &Client{Client: srv.Client(), Host: srv.URL, Authorizer: "key"}
+
+	var requests int64
+	collection, err := client.ChainAssetContract(WithRequestCount(context.Background(), &requests), "ethereum", "0xabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("%v requests counted, want the contract and the collection", requests)
+	}
+	if collection.Name != "Alpha" || collection.SchemaName != "ERC721" || collection.TotalSupply != "10" {
+		t.Errorf("contract %+v", collection)
+	}
+	if collection.Collection.Slug != "alpha" || collection.ExternalLink != "https://alpha.example" || collection.Collection.TwitterUsername != "alpha" {
+		t.Errorf("collection %+v", collection.Collection)
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"total":{"floor_price":0.5}}`))
+	}))
+	defer srv.Close()
+	client := &Client{Client: srv.Client(), Host: srv.URL, MaxRetries: 2, RetryBackoff: time.Millisecond}
+
+	var counted int64
+	stats, err := client.Stats(WithRequestCount(context.Background(), &counted), "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total.FloorPrice != 0.5 || requests != 2 {
+		t.Errorf("floor %v after %v requests", stats.Total.FloorPrice, requests)
+	}
+	if counted != 2 {
+		t.Errorf("%v requests counted, want the retry too", counted)
+	}
+}
+
+func TestGetError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	client := &Client{Client: srv.Client(), Host: srv.URL}
+
+	_, err := client.Stats(context.Background(), "alpha")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("error %v, want the 502 status", err)
+	}
+}
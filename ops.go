@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+const (
+	defaultSilenceHours = 24
+	// defaultPartialErrors is how many errors a run that carried on needs
+	// before it pages the ops channel, so a single transient error does not
+	// page anyone.
+	defaultPartialErrors = 3
+	discordMaxContent    = 2000
+	heartbeatTimeout     = 10 * time.Second
+)
+
+// OpsConfig holds the destinations for operational alerts. These are kept
+// separate from the public mint alert channels.
+type OpsConfig struct {
+	DiscordWebhookId    string
+	DiscordWebhookToken string
+	SNSTopicArn         string
+	SilencePeriod       time.Duration
+	HeartbeatURL        string
+	// PartialErrors is the fewest errors of a partial run that are alerted
+	PartialErrors int
+}
+
+func getOpsConfig() OpsConfig {
+	ops := OpsConfig{
+		DiscordWebhookId:    os.Getenv("OPS_DISCORD_WEBHOOK_ID"),
+		DiscordWebhookToken: os.Getenv("OPS_DISCORD_WEBHOOK_TOKEN"),
+		SNSTopicArn:         os.Getenv("OPS_SNS_TOPIC_ARN"),
+		SilencePeriod:       time.Duration(envInt("OPS_SILENCE_HOURS", defaultSilenceHours)) * time.Hour,
+		HeartbeatURL:        os.Getenv("HEARTBEAT_URL"),
+		PartialErrors:       envInt("OPS_PARTIAL_ERRORS", defaultPartialErrors),
+	}
+	return ops
+}
+
+// checkSilence flags the run when no alert has been posted for longer than
+// the silence period. The flag is raised at most once per period.
+func checkSilence(status *Status, summary *RunSummary, period time.Duration) {
+	now := time.Now()
+	if status.LastAlert.IsZero() {
+		// Nothing to compare against yet, start the clock now.
+		status.LastAlert = now
+		return
+	}
+	if period <= 0 || now.Sub(status.LastAlert) < period {
+		return
+	}
+	if now.Sub(status.LastSilenceAlert) < period {
+		return
+	}
+	summary.Silent = true
+	status.LastSilenceAlert = now
+}
+
+// reportRun logs the run summary, records its metrics and sends an ops
+// alert if the run failed, had OPS_PARTIAL_ERRORS errors or has been silent
+// for too long.
+func reportRun(summary *RunSummary, ops OpsConfig) {
+	archiveRun(summary)
+	summary.log()
+	recordMetrics(summary)
+	daemonRuns.finished(summary)
+	if !summary.Failed {
+		pingHeartbeat(ops.HeartbeatURL)
+	}
+	if subject := opsSubject(summary, ops); subject != "" {
+		sendOpsAlert(ops, subject, summary.String())
+	}
+}
+
+// opsSubject is the subject of the ops alert for the run, or empty when the
+// run needs no alert. Partial runs with fewer than PartialErrors errors are
+// only logged.
+func opsSubject(summary *RunSummary, ops OpsConfig) string {
+	switch {
+	case summary.Failed:
+		return "NFT Mint Alert run failed"
+	case summary.Partial() && len(summary.Errors) >= ops.PartialErrors:
+		return "NFT Mint Alert run completed with errors"
+	case summary.Silent:
+		return fmt.Sprintf("NFT Mint Alert has not posted an alert in over %v", ops.SilencePeriod)
+	}
+	return ""
+}
+
+func sendOpsAlert(ops OpsConfig, subject string, message string) {
+	sent := false
+	if ops.DiscordWebhookId != "" && ops.DiscordWebhookToken != "" {
+		webhook := newDiscordWebhook("ops", ops.DiscordWebhookId, ops.DiscordWebhookToken)
+		if err := sendOpsDiscord(context.Background(), webhook, subject, message); err != nil {
+			slog.Error("Error sending ops Discord alert", "error", err)
+		}
+		sent = true
+	}
+	if ops.SNSTopicArn != "" {
+		if err := sendOpsSNS(ops, subject, message); err != nil {
+			slog.Error("Error sending ops SNS alert", "error", err)
+		}
+		sent = true
+	}
+	if !sent {
+		slog.Warn("Ops alert channel not configured", "variables", "OPS_DISCORD_WEBHOOK_ID/OPS_DISCORD_WEBHOOK_TOKEN or OPS_SNS_TOPIC_ARN", "subject", subject)
+	}
+}
+
+func sendOpsDiscord(ctx context.Context, webhook *discordNotifier, subject string, message string) error {
+	content := fmt.Sprintf("**%v**\n```\n%v\n```", subject, message)
+	// the limit is in characters, cut on one so the message stays UTF-8
+	if runes := []rune(content); len(runes) > discordMaxContent {
+		content = string(runes[:discordMaxContent-7]) + "\n...```"
+	}
+	_, err := webhook.execute(ctx, content, nil)
+	return err
+}
+
+func sendOpsSNS(ops OpsConfig, subject string, message string) error {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		return err
+	}
+	svc := sns.New(sess)
+	_, err = svc.Publish(&sns.PublishInput{
+		TopicArn: aws.String(ops.SNSTopicArn),
+		Subject:  aws.String(subject),
+		Message:  aws.String(message),
+	})
+	return err
+}
+
+// pingHeartbeat tells a dead man's switch service (Healthchecks.io, Cronitor,
+// etc.) that the run completed. The service alerts when the pings stop.
+func pingHeartbeat(url string) {
+	if url == "" {
+		return
+	}
+	client := &http.Client{Timeout: heartbeatTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		slog.Error("Heartbeat error", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("Heartbeat error", "error", resp.Status)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestOpsSubject(t *testing.T) {
+	ops := OpsConfig{PartialErrors: 2}
+	summary := newRunSummary()
+	if subject := opsSubject(summary, ops); subject != "" {
+		t.Errorf("ok run alerted %q", subject)
+	}
+	summary.addError("webhook error on contract 0x1")
+	if subject := opsSubject(summary, ops); subject != "" {
+		t.Errorf("one error alerted %q", subject)
+	}
+	summary.addError("webhook error on contract 0x2")
+	if subject := opsSubject(summary, ops); !strings.Contains(subject, "with errors") {
+		t.Errorf("two errors alerted %q", subject)
+	}
+	summary.fail("no chains could be scanned")
+	if subject := opsSubject(summary, ops); !strings.Contains(subject, "failed") {
+		t.Errorf("failed run alerted %q", subject)
+	}
+}
+
+func TestSendOpsDiscordTruncates(t *testing.T) {
+	var content string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&params)
+		content = params.Content
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer srv.Close()
+	webhook := newDiscordWebhook("ops", "1234", "token")
+	webhook.host = srv.URL
+	if err := sendOpsDiscord(context.Background(), webhook, "Run failed", strings.Repeat("é", discordMaxContent)); err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.ValidString(content) || utf8.RuneCountInString(content) > discordMaxContent {
+		t.Errorf("%v characters, valid UTF-8 %v", utf8.RuneCountInString(content), utf8.ValidString(content))
+	}
+	if !strings.HasSuffix(content, "...```") {
+		t.Errorf("content ends %q, want the code block closed", content[len(content)-10:])
+	}
+}
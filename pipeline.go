@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// chainClient is the part of the node's RPC the pipeline reads: the logs
+// and blocks to count the mints, the transactions to price them and the
+// contracts for stealth mints and ENS names. *ethclient.Client implements
+// it, memoryChain stands in for it in replays.
+type chainClient interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	Close()
+}
+
+// dialChain connects to the chain's RPC.
+func dialChain(chain Chain) (chainClient, error) {
+	client, err := ethclient.Dial(chain.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// postChain posts the alerts of a scanned chain: the mints, with the
+// contracts the last run did not have time for, scored against the chain's
+// previous window, then the sales and burns when they are turned on. The
+// mint counts are kept as the window for the next run.
+func (a *alerter) postChain(ctx context.Context, status *Status, client chainClient, chain Chain, counter *mintCounter, toBlock *big.Int, persist func()) {
+	counted := counter.ranked(a.summary)
+	// pick up anything the last run did not have time for
+	mintlist := mergeContinuation(counted, status.Continuations[chain.Name])
+	delete(status.Continuations, chain.Name)
+
+	a.prices = newMintPricer(client, chain, counter.txs, &a.summary.Usage)
+	a.deployments = newStealthDetector(client, &a.summary.Usage)
+	a.names = newENSResolver(client, chain, &a.summary.Usage)
+	a.supplies = newSupplyReader(client, &a.summary.Usage)
+	a.minters = minterStats(counter.minters)
+	mintlist = a.scoreMints(ctx, chain, mintlist, status.Windows[chain.Name])
+	if status.Windows == nil {
+		status.Windows = make(map[string]*WindowCounts)
+	}
+	status.Windows[chain.Name] = newWindowCounts(counted)
+	a.post(ctx, status, chain, mintlist, toBlock, persist)
+	if counter.sales != nil {
+		a.postCounted(ctx, status, chain, salesAlerts(), counter.sales.ranked(), toBlock, persist)
+	}
+	if burnMode() == burnModeAlert {
+		a.postCounted(ctx, status, chain, burnAlerts(), counter.burnsRanked(), toBlock, persist)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"nftmintalert/opensea"
+)
+
+// The runs under testdata/runs are in the RECORD_PATH layout: the chain,
+// the transfer logs, the collections in their cool-down, the OpenSea
+// responses and the alerts the run is expected to post.
+
+// fixtureEnv sets the settings the runs were recorded with.
+func fixtureEnv(t *testing.T) {
+	t.Setenv("MINT_THRESHOLD", "2")
+	t.Setenv("ETH_NETWORK_URL", "memory")
+}
+
+func fixtureRuns(t *testing.T) []string {
+	runs, err := filepath.Glob(filepath.Join("testdata", "runs", "*"))
+	if err != nil || len(runs) == 0 {
+		t.Fatalf("no runs in testdata: %v", err)
+	}
+	return runs
+}
+
+// openseaServer stands in for the OpenSea v2 API, serving the recorded
+// collections and stats of the run. The requests are counted in requests.
+func openseaServer(t *testing.T, run string, requests *int64) *httptest.Server {
+	collections := make(map[string]*opensea.OpenSeaCollection)
+	files, _ := filepath.Glob(filepath.Join(run, "opensea", "*.json"))
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		collection := &opensea.OpenSeaCollection{}
+		if err := json.Unmarshal(buf, collection); err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		collections[strings.ToLower(collection.Address)] = collection
+	}
+	bySlug := func(slug string) *opensea.OpenSeaCollection {
+		for _, collection := range collections {
+			if collection.Collection.Slug == slug {
+				return collection
+			}
+		}
+		return nil
+	}
+	respond := func(w http.ResponseWriter, v interface{}) {
+		if v == nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":["not found"]}`)
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 6 && parts[2] == "chain" && parts[4] == "contract":
+			collection, ok := collections[strings.ToLower(parts[5])]
+			if !ok {
+				respond(w, nil)
+				return
+			}
+			respond(w, &opensea.Contract{
+				Address:          collection.Address,
+				Chain:            parts[3],
+				Collection:       collection.Collection.Slug,
+				ContractStandard: strings.ToLower(collection.SchemaName),
+				Name:             collection.Name,
+			})
+		case len(parts) == 4 && parts[2] == "collections":
+			collection := bySlug(parts[3])
+			if collection == nil {
+				respond(w, nil)
+				return
+			}
+			respond(w, &opensea.Collection{
+				Collection:      collection.Collection.Slug,
+				Name:            collection.Collection.Name,
+				ProjectURL:      collection.ExternalLink,
+				TwitterUsername: collection.Collection.TwitterUsername,
+			})
+		case len(parts) == 5 && parts[2] == "collections" && parts[4] == "stats":
+			buf, err := ioutil.ReadFile(filepath.Join(run, "opensea", "stats", parts[3]+".json"))
+			if err != nil {
+				respond(w, nil)
+				return
+			}
+			w.Write(buf)
+		default:
+			respond(w, nil)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testOpenSeaClient(srv *httptest.Server) *opensea.Client {
+	return &opensea.Client{Client: srv.Client(), Host: srv.URL, Authorizer: "test"}
+}
+
+// testNotifiers posts to the notifier only.
+func testNotifiers(notifier Notifier, usage *UsageCounts) *notifiers {
+	return &notifiers{
+		public: []Notifier{notifier},
+		canary: []Notifier{notifier},
+		usage:  usage,
+		routes: map[string]route{},
+	}
+}
+
+func postedAlerts(notifier *memoryNotifier) []fixtureAlert {
+	var alerts []fixtureAlert
+	for _, alert := range notifier.posted() {
+		alerts = append(alerts, fixtureAlert{Kind: alert.Kind, Contract: alert.Contract, Count: alert.Count, Tier: alert.Tier})
+	}
+	return alerts
+}
+
+func checkAlerts(t *testing.T, expected []fixtureAlert, posted []fixtureAlert) {
+	t.Helper()
+	for _, diff := range diffAlerts(expected, posted) {
+		t.Error(diff)
+	}
+}
+
+func TestReplayFixtures(t *testing.T) {
+	fixtureEnv(t)
+	for _, run := range fixtureRuns(t) {
+		t.Run(filepath.Base(run), func(t *testing.T) {
+			if !replayFixture(context.Background(), run) {
+				t.Error("the replay differs from the recorded alerts")
+			}
+		})
+	}
+}
+
+func TestScanAndPostChain(t *testing.T) {
+	fixtureEnv(t)
+	ctx := context.Background()
+	for _, run := range fixtureRuns(t) {
+		t.Run(filepath.Base(run), func(t *testing.T) {
+			store := openFixtureStore(nil, run)
+			logs, err := store.readLogs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			chains, err := loadChains()
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain := chains[0]
+			summary := newRunSummary()
+			client := newMemoryChain(logs)
+			counter, toBlock, err := scanChain(ctx, client, chain, 0, nil, summary, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if toBlock.Uint64() != client.head {
+				t.Errorf("scanned to block %v, want the head %v", toBlock, client.head)
+			}
+
+			tiers, err := loadTiers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			notifier := &memoryNotifier{}
+			state := &memoryStore{}
+			status := state.load()
+			for _, recent := range store.readCooling() {
+				status.markPosted(recent)
+			}
+			var requests int64
+			alerts := &alerter{
+				osclient: testOpenSeaClient(openseaServer(t, run, &requests)),
+				targets:  testNotifiers(notifier, &summary.Usage),
+				summary:  summary,
+				budget:   newTimeBudget(ctx),
+				tiers:    tiers,
+				minutes:  windowMinutes(),
+				cooldown: alertCooldown(),
+			}
+			alerts.postChain(ctx, &status, client, chain, counter, toBlock, func() { state.save(status) })
+
+			checkAlerts(t, store.readAlerts(), postedAlerts(notifier))
+			for _, alert := range notifier.posted() {
+				if alert.Collection == nil || alert.Collection.Collection.Slug == "" {
+					t.Errorf("%v: alert without the OpenSea collection", alert.Contract)
+				}
+				if alert.Stats == nil {
+					t.Errorf("%v: alert without the OpenSea stats", alert.Contract)
+				}
+				if !status.recentlyPosted(alert.Contract, alerts.cooldown) {
+					t.Errorf("%v: not marked as posted", alert.Contract)
+				}
+			}
+			if summary.Usage.OpenSea != int(requests) {
+				t.Errorf("OpenSea usage %v, made %v requests", summary.Usage.OpenSea, requests)
+			}
+			if len(summary.Errors) > 0 {
+				t.Errorf("errors: %v", summary.Errors)
+			}
+		})
+	}
+}
+
+// memoryDeps runs processLogs on the recorded run with the in-memory chain,
+// store and notifier and OpenSea served by openseaServer.
+func memoryDeps(t *testing.T, run string, notifier *memoryNotifier) (*runDeps, *memoryStore) {
+	logs, err := openFixtureStore(nil, run).readLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryStore{}
+	var requests int64
+	return &runDeps{
+		store:     store,
+		source:    testOpenSeaClient(openseaServer(t, run, &requests)),
+		notifiers: func(usage *UsageCounts) *notifiers { return testNotifiers(notifier, usage) },
+		dial:      func(chain Chain) (chainClient, error) { return newMemoryChain(logs), nil },
+	}, store
+}
+
+func TestProcessLogs(t *testing.T) {
+	fixtureEnv(t)
+	ctx := context.Background()
+	run := filepath.Join("testdata", "runs", "mints")
+	notifier := &memoryNotifier{}
+	deps, store := memoryDeps(t, run, notifier)
+
+	processLogs(ctx, Event{}, deps)
+	checkAlerts(t, openFixtureStore(nil, run).readAlerts(), postedAlerts(notifier))
+	status := store.load()
+	if checkpoint := status.Checkpoints[chainEthereum]; checkpoint != 1003 {
+		t.Errorf("checkpoint %v, want 1003", checkpoint)
+	}
+
+	// the next run has no new blocks and posts nothing more
+	posted := len(notifier.posted())
+	processLogs(ctx, Event{}, deps)
+	if len(notifier.posted()) != posted {
+		t.Errorf("the second run posted %v alerts", len(notifier.posted())-posted)
+	}
+}
+
+func TestProcessLogsLocked(t *testing.T) {
+	fixtureEnv(t)
+	notifier := &memoryNotifier{}
+	deps, store := memoryDeps(t, filepath.Join("testdata", "runs", "mints"), notifier)
+	deps.lock = func() (func(), error) { return func() {}, fmt.Errorf("%w by another run", errLocked) }
+
+	processLogs(context.Background(), Event{}, deps)
+	if posted := notifier.posted(); len(posted) > 0 {
+		t.Errorf("a locked run posted %v alerts", len(posted))
+	}
+	if status := store.load(); len(status.Checkpoints) > 0 {
+		t.Errorf("a locked run saved checkpoints %v", status.Checkpoints)
+	}
+}
+
+func TestProcessLogsDryRun(t *testing.T) {
+	fixtureEnv(t)
+	notifier := &memoryNotifier{}
+	deps, store := memoryDeps(t, filepath.Join("testdata", "runs", "mints"), notifier)
+
+	processLogs(context.Background(), Event{DryRun: true}, deps)
+	if store.data != nil {
+		t.Errorf("a dry run saved the status %s", store.data)
+	}
+}
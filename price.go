@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const defaultMintPriceSample = 20
+
+// weiPerEther converts the transaction values to the native currency.
+var weiPerEther = new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+
+// priceSource returns the amount spent on a contract's mints.
+type priceSource interface {
+	// mintValue returns nil if there are no transactions to price.
+	mintValue(ctx context.Context, contract string, count int) (*MintStatus, error)
+}
+
+// mintPricer reads the value of the mint transactions from the chain. Only
+// a sample of the transactions is read for busy collections and the total is
+// estimated from the sample's average.
+type mintPricer struct {
+	client   chainClient
+	currency string
+	txs      map[string][]common.Hash
+	sample   int
+	usage    *UsageCounts
+}
+
+// newMintPricer returns a pricer for the mint transactions in txs, or nil if
+// pricing is turned off with MINT_PRICE_SAMPLE=0.
+func newMintPricer(client chainClient, chain Chain, txs map[string][]common.Hash, usage *UsageCounts) priceSource {
+	sample := envInt("MINT_PRICE_SAMPLE", defaultMintPriceSample)
+	if sample <= 0 {
+		return nil
+	}
+	return &mintPricer{client: client, currency: chain.Currency, txs: txs, sample: sample, usage: usage}
+}
+
+// mintValue returns the total and average value of the contract's mints in
+// the native currency. Collections carried over from the previous run have
+// no transactions to price.
+func (p *mintPricer) mintValue(ctx context.Context, contract string, count int) (*MintStatus, error) {
+	txs := p.txs[contract]
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	if len(txs) > p.sample {
+		txs = txs[:p.sample]
+	}
+	total := new(big.Int)
+	for _, hash := range txs {
+		p.usage.RPC++
+		tx, _, err := p.client.TransactionByHash(ctx, hash)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read mint transaction %v: %w", hash.Hex(), err)
+		}
+		total.Add(total, tx.Value())
+	}
+	sampled, _ := new(big.Float).Quo(new(big.Float).SetInt(total), weiPerEther).Float64()
+	average := sampled / float64(len(txs))
+	return &MintStatus{
+		Count:    count,
+		Value:    average * float64(count),
+		Currency: p.currency,
+		Sampled:  len(txs) < count,
+	}, nil
+}
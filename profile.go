@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// profileWatchlist only follows the contracts in WATCHLIST. The addresses are
+// passed to the node so it does the filtering.
+const profileWatchlist = "watchlist"
+
+// parseAddresses parses a comma separated list of contract addresses.
+func parseAddresses(list string) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !common.IsHexAddress(entry) {
+			return nil, fmt.Errorf("invalid contract address %q", entry)
+		}
+		addresses = append(addresses, common.HexToAddress(entry))
+	}
+	return addresses, nil
+}
+
+// queryAddresses returns the contract addresses to filter the log query on
+// for the selected PROFILE. It returns nil when every contract is scanned.
+func queryAddresses() ([]common.Address, error) {
+	profile := os.Getenv("PROFILE")
+	switch profile {
+	case "", "all":
+		return nil, nil
+	case profileWatchlist:
+		addresses, err := parseAddresses(os.Getenv("WATCHLIST"))
+		if err != nil {
+			return nil, fmt.Errorf("WATCHLIST: %w", err)
+		}
+		if len(addresses) == 0 {
+			return nil, fmt.Errorf("the %v profile requires contract addresses in WATCHLIST", profileWatchlist)
+		}
+		return addresses, nil
+	}
+	return nil, fmt.Errorf("unknown PROFILE %q", profile)
+}
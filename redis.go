@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	stateBackendRedis = "redis"
+
+	defaultRedisPrefix = "nftmintalert:"
+	redisTimeout       = 5 * time.Second
+)
+
+// redisSaveScript writes the status only if its version is still the one
+// loaded, like the conditional write of the DynamoDB store.
+var redisSaveScript = redis.NewScript(`
+local version = tonumber(redis.call("HGET", KEYS[1], "version") or "0")
+if version ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("HSET", KEYS[1], "data", ARGV[2], "version", version + 1)
+return 1
+`)
+
+var (
+	// redisClients are kept between the runs of the daemon so every scan
+	// reuses the connections
+	redisClients   = make(map[string]*redis.Client)
+	redisClientsMu sync.Mutex
+)
+
+// redisStore keeps the Status in Redis or ElastiCache, for daemons polling
+// every minute where reading and writing the S3 status file each run is
+// slow. The keys, under REDIS_PREFIX, are:
+//
+//   - status, a hash with the rest of the status as JSON and its version
+//   - recent, a sorted set of the posted collections scored by post time,
+//     trimmed to dynamoRecentTTL
+//   - checkpoints, a hash of the last block scanned on each chain
+//   - sent:<key>, an idempotency key set with NX that expires after
+//     sentKeyRetention
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	// version of the status when it was loaded or last saved
+	version int
+	// posted collections as last loaded or saved
+	posted map[string]time.Time
+}
+
+func newRedisStore(url string, prefix string) (*redisStore, error) {
+	redisClientsMu.Lock()
+	defer redisClientsMu.Unlock()
+	client, ok := redisClients[url]
+	if !ok {
+		options, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		client = redis.NewClient(options)
+		redisClients[url] = client
+	}
+	return &redisStore{client: client, prefix: prefix}, nil
+}
+
+func (r *redisStore) key(name string) string {
+	return r.prefix + name
+}
+
+func (r *redisStore) load() Status {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	var status Status
+	fields, err := r.client.HGetAll(ctx, r.key("status")).Result()
+	if err != nil {
+		slog.Error("Error reading status from Redis", "error", err)
+	} else {
+		if data := fields["data"]; data != "" {
+			if err := json.Unmarshal([]byte(data), &status); err != nil {
+				slog.Error("Error reading status from Redis", "error", err)
+			}
+		}
+		r.version, _ = strconv.Atoi(fields["version"])
+	}
+
+	checkpoints, err := r.client.HGetAll(ctx, r.key("checkpoints")).Result()
+	if err != nil {
+		slog.Error("Error reading checkpoints from Redis", "error", err)
+	}
+	for chain, block := range checkpoints {
+		n, err := strconv.ParseUint(block, 10, 64)
+		if err != nil {
+			continue
+		}
+		if status.Checkpoints == nil {
+			status.Checkpoints = make(map[string]uint64)
+		}
+		status.Checkpoints[chain] = n
+	}
+
+	r.posted = make(map[string]time.Time)
+	oldest := time.Now().Add(-dynamoRecentTTL).Unix()
+	recents, err := r.client.ZRangeByScoreWithScores(ctx, r.key("recent"), &redis.ZRangeBy{
+		Min: strconv.FormatInt(oldest, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		slog.Error("Error reading recent alerts from Redis", "error", err)
+	}
+	for _, recent := range recents {
+		contract, ok := recent.Member.(string)
+		if !ok {
+			continue
+		}
+		if status.Posted == nil {
+			status.Posted = make(map[string]time.Time)
+		}
+		posted := time.Unix(int64(recent.Score), 0)
+		status.Posted[contract] = posted
+		r.posted[contract] = posted
+	}
+	status.migrateRecents()
+	status.claimer = r.claim
+	return status
+}
+
+func (r *redisStore) save(status Status) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := r.client.TxPipeline()
+	for recent, posted := range status.Posted {
+		// times are stored to the second
+		posted = time.Unix(posted.Unix(), 0)
+		if last, ok := r.posted[recent]; ok && last.Equal(posted) {
+			continue
+		}
+		pipe.ZAdd(ctx, r.key("recent"), redis.Z{Score: float64(posted.Unix()), Member: recent})
+	}
+	for recent := range r.posted {
+		if _, ok := status.Posted[recent]; !ok {
+			// the cool-down is over
+			pipe.ZRem(ctx, r.key("recent"), recent)
+		}
+	}
+	pipe.ZRemRangeByScore(ctx, r.key("recent"), "-inf", "("+strconv.FormatInt(time.Now().Add(-dynamoRecentTTL).Unix(), 10))
+	for chain, block := range status.Checkpoints {
+		pipe.HSet(ctx, r.key("checkpoints"), chain, strconv.FormatUint(block, 10))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Error saving recent alerts and checkpoints to Redis", "error", err)
+	} else {
+		r.posted = make(map[string]time.Time, len(status.Posted))
+		for recent, posted := range status.Posted {
+			r.posted[recent] = time.Unix(posted.Unix(), 0)
+		}
+	}
+
+	// the posted collections, checkpoints and idempotency keys are keys
+	// of their own
+	status.Posted = nil
+	status.Checkpoints = nil
+	status.Sent = nil
+	buf, err := json.Marshal(status)
+	if err != nil {
+		slog.Error("Error saving status to Redis", "error", err)
+		return
+	}
+	saved, err := redisSaveScript.Run(ctx, r.client, []string{r.key("status")}, r.version, string(buf)).Int()
+	if err != nil {
+		slog.Error("Error saving status to Redis", "error", err)
+		return
+	}
+	if saved == 0 {
+		slog.Warn("Status not saved, another run saved it first", "version", r.version)
+		return
+	}
+	r.version++
+}
+
+// claim records the idempotency key unless another run already has. The
+// key expires after sentKeyRetention.
+func (r *redisStore) claim(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	claimed, err := r.client.SetNX(ctx, r.key("sent:"+key), time.Now().Unix(), sentKeyRetention).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return false, err
+	}
+	return claimed, nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"nftmintalert/opensea"
+)
+
+const (
+	providerOpenSea   = "opensea"
+	providerReservoir = "reservoir"
+	providerAlchemy   = "alchemy"
+
+	defaultMetadataProviders = providerOpenSea
+)
+
+// CollectionResolver looks up the collection details of a contract: its
+// name, image, external link and Twitter account. The results are in the
+// OpenSea asset contract shape the alerts are built from.
+type CollectionResolver interface {
+	// Name identifies the resolver in METADATA_PROVIDERS and the logs.
+	Name() string
+	ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error)
+}
+
+// newCollectionSource returns the OpenSea client, or when METADATA_PROVIDERS
+// lists other providers, a source that tries each of them in turn.
+func newCollectionSource(openseaKey string) collectionSource {
+	client := newOpenSeaClient(openseaKey)
+	names := envList("METADATA_PROVIDERS", defaultMetadataProviders)
+	if len(names) == 1 && names[0] == providerOpenSea {
+		return client
+	}
+	source := &fallbackSource{stats: client}
+	for _, name := range names {
+		var resolver CollectionResolver
+		switch name {
+		case providerOpenSea:
+			resolver = openseaResolver{client}
+		case providerReservoir:
+			resolver = newReservoirResolver(os.Getenv("RESERVOIR_API_KEY"))
+		case providerAlchemy:
+			key := os.Getenv("ALCHEMY_API_KEY")
+			if key == "" {
+				slog.Warn("Metadata provider is not configured", "provider", name, "error", "ALCHEMY_API_KEY must be set")
+				continue
+			}
+			resolver = newAlchemyResolver(key)
+		default:
+			slog.Warn("Unknown metadata provider", "provider", name)
+			continue
+		}
+		source.resolvers = append(source.resolvers, resolver)
+	}
+	if len(source.resolvers) == 0 {
+		return client
+	}
+	return source
+}
+
+// fallbackSource looks up the collection with each resolver in turn until
+// one succeeds, so a contract OpenSea doesn't know yet or a rate limit
+// doesn't lose the alert. The stats and events always come from OpenSea.
+type fallbackSource struct {
+	resolvers []CollectionResolver
+	stats     collectionSource
+}
+
+func (f *fallbackSource) ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error) {
+	var err error
+	for _, resolver := range f.resolvers {
+		var collection *opensea.OpenSeaCollection
+		collection, err = resolver.ChainAssetContract(ctx, chain, id)
+		if err == nil {
+			return collection, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		slog.Info("Collection lookup failed, trying the next provider", "provider", resolver.Name(), "contract", id, "error", err)
+	}
+	return nil, err
+}
+
+func (f *fallbackSource) Stats(ctx context.Context, slug string) (*opensea.Stats, error) {
+	return f.stats.Stats(ctx, slug)
+}
+
+func (f *fallbackSource) Events(ctx context.Context, slug string, query opensea.EventsQuery) (*opensea.Events, error) {
+	return f.stats.Events(ctx, slug, query)
+}
+
+// openseaResolver is the OpenSea client as a CollectionResolver.
+type openseaResolver struct {
+	client *opensea.Client
+}
+
+func (o openseaResolver) Name() string { return providerOpenSea }
+
+func (o openseaResolver) ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error) {
+	return o.client.ChainAssetContract(ctx, chain, id)
+}
+
+// reservoirHosts are the Reservoir API hosts by OpenSea chain identifier.
+var reservoirHosts = map[string]string{
+	"ethereum": "https://api.reservoir.tools",
+	"matic":    "https://api-polygon.reservoir.tools",
+	"arbitrum": "https://api-arbitrum.reservoir.tools",
+	"base":     "https://api-base.reservoir.tools",
+	"optimism": "https://api-optimism.reservoir.tools",
+}
+
+// reservoirResolver looks up collections with the Reservoir API. The API
+// key in RESERVOIR_API_KEY is optional but raises the rate limit.
+type reservoirResolver struct {
+	apiKey string
+	client *http.Client
+}
+
+func newReservoirResolver(apiKey string) *reservoirResolver {
+	return &reservoirResolver{apiKey: apiKey, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (r *reservoirResolver) Name() string { return providerReservoir }
+
+type reservoirCollections struct {
+	Collections []struct {
+		ID              string `json:"id"`
+		Slug            string `json:"slug"`
+		Name            string `json:"name"`
+		Image           string `json:"image"`
+		Banner          string `json:"banner"`
+		Description     string `json:"description"`
+		ExternalURL     string `json:"externalUrl"`
+		TwitterUsername string `json:"twitterUsername"`
+		DiscordURL      string `json:"discordUrl"`
+		ContractKind    string `json:"contractKind"`
+		TokenCount      string `json:"tokenCount"`
+	} `json:"collections"`
+}
+
+func (r *reservoirResolver) ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error) {
+	host, ok := reservoirHosts[chain]
+	if !ok {
+		return nil, fmt.Errorf("reservoir does not support %v", chain)
+	}
+	var result reservoirCollections
+	headers := map[string]string{}
+	if r.apiKey != "" {
+		headers["x-api-key"] = r.apiKey
+	}
+	if err := getJSON(ctx, r.client, "reservoir collection", host+"/collections/v7?id="+url.QueryEscape(id), headers, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Collections) == 0 {
+		return nil, fmt.Errorf("reservoir %v: %w", id, errCollectionNotFound)
+	}
+	found := result.Collections[0]
+	collection := &opensea.OpenSeaCollection{
+		Address:      id,
+		Name:         found.Name,
+		Description:  found.Description,
+		ExternalLink: found.ExternalURL,
+		ImageURL:     found.Image,
+		SchemaName:   found.ContractKind,
+		TotalSupply:  found.TokenCount,
+	}
+	// Reservoir's slugs are its own, not OpenSea's, so the OpenSea link and
+	// stats are left out
+	collection.Collection.Name = found.Name
+	collection.Collection.Description = found.Description
+	collection.Collection.ExternalURL = found.ExternalURL
+	collection.Collection.ImageURL = found.Image
+	collection.Collection.BannerImageURL = found.Banner
+	collection.Collection.TwitterUsername = found.TwitterUsername
+	collection.Collection.DiscordURL = found.DiscordURL
+	return collection, nil
+}
+
+// alchemyNetworks are the Alchemy network names by OpenSea chain identifier.
+var alchemyNetworks = map[string]string{
+	"ethereum": "eth-mainnet",
+	"matic":    "polygon-mainnet",
+	"arbitrum": "arb-mainnet",
+	"base":     "base-mainnet",
+	"optimism": "opt-mainnet",
+}
+
+// alchemyResolver looks up collections with the Alchemy NFT API, whose
+// contract metadata includes OpenSea's collection details when it has
+// them.
+type alchemyResolver struct {
+	apiKey string
+	client *http.Client
+}
+
+func newAlchemyResolver(apiKey string) *alchemyResolver {
+	return &alchemyResolver{apiKey: apiKey, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (a *alchemyResolver) Name() string { return providerAlchemy }
+
+type alchemyContract struct {
+	Address         string `json:"address"`
+	Name            string `json:"name"`
+	TotalSupply     string `json:"totalSupply"`
+	TokenType       string `json:"tokenType"`
+	OpenSeaMetadata struct {
+		CollectionName        string `json:"collectionName"`
+		CollectionSlug        string `json:"collectionSlug"`
+		SafelistRequestStatus string `json:"safelistRequestStatus"`
+		ImageURL              string `json:"imageUrl"`
+		Description           string `json:"description"`
+		ExternalURL           string `json:"externalUrl"`
+		TwitterUsername       string `json:"twitterUsername"`
+		DiscordURL            string `json:"discordUrl"`
+		BannerImageURL        string `json:"bannerImageUrl"`
+	} `json:"openSeaMetadata"`
+}
+
+func (a *alchemyResolver) ChainAssetContract(ctx context.Context, chain string, id string) (*opensea.OpenSeaCollection, error) {
+	network, ok := alchemyNetworks[chain]
+	if !ok {
+		return nil, fmt.Errorf("alchemy does not support %v", chain)
+	}
+	var contract alchemyContract
+	endpoint := fmt.Sprintf("https://%v.g.alchemy.com/nft/v3/%v/getContractMetadata?contractAddress=%v", network, a.apiKey, url.QueryEscape(id))
+	if err := getJSON(ctx, a.client, "alchemy contract", endpoint, nil, &contract); err != nil {
+		return nil, err
+	}
+	meta := contract.OpenSeaMetadata
+	collection := &opensea.OpenSeaCollection{
+		Address:      id,
+		Name:         contract.Name,
+		Description:  meta.Description,
+		ExternalLink: meta.ExternalURL,
+		ImageURL:     meta.ImageURL,
+		SchemaName:   contract.TokenType,
+		TotalSupply:  contract.TotalSupply,
+	}
+	if collection.Name == "" {
+		collection.Name = meta.CollectionName
+	}
+	collection.Collection.Slug = meta.CollectionSlug
+	collection.Collection.Name = meta.CollectionName
+	collection.Collection.Description = meta.Description
+	collection.Collection.ExternalURL = meta.ExternalURL
+	collection.Collection.ImageURL = meta.ImageURL
+	collection.Collection.BannerImageURL = meta.BannerImageURL
+	collection.Collection.SafelistRequestStatus = meta.SafelistRequestStatus
+	collection.Collection.TwitterUsername = meta.TwitterUsername
+	collection.Collection.DiscordURL = meta.DiscordURL
+	return collection, nil
+}
+
+// getJSON fetches the URL and decodes the JSON response into v. what names
+// the request in errors, which leave out the URL as it can hold an API key.
+func getJSON(ctx context.Context, client *http.Client, what string, url string, headers map[string]string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("%v: request: %w", what, err)
+	}
+	req.Header.Add("Accept", "application/json")
+	for name, value := range headers {
+		req.Header.Add(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// the client's errors include the URL
+		if ctx.Err() != nil {
+			return fmt.Errorf("%v response: %w", what, ctx.Err())
+		}
+		return fmt.Errorf("%v response: request failed", what)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%v response read: %w", what, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v status %v", what, resp.StatusCode)
+	}
+	return json.Unmarshal(respBytes, v)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	maxPendingAttempts = 10
+	maxPendingAge      = 24 * time.Hour
+	maxPending         = 50
+)
+
+// PendingNotification is an alert that could not be delivered to a notifier.
+// It is kept in the status file and retried on the following runs.
+type PendingNotification struct {
+	Target    string    `json:"target"`
+	Alert     Alert     `json:"alert"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	Created   time.Time `json:"created"`
+}
+
+// queuePending adds a failed delivery to the retry queue.
+func (s *Status) queuePending(target string, alert Alert, err error) {
+	s.Pending = append(s.Pending, PendingNotification{
+		Target:    target,
+		Alert:     alert,
+		Attempts:  1,
+		LastError: err.Error(),
+		Created:   time.Now(),
+	})
+	if len(s.Pending) > maxPending {
+		// drop the oldest
+		s.Pending = s.Pending[len(s.Pending)-maxPending:]
+	}
+}
+
+// retryPending re-attempts the notifications that failed on earlier runs.
+// Notifications that keep failing are dropped after maxPendingAttempts or
+// maxPendingAge.
+func (n *notifiers) retryPending(ctx context.Context, status *Status, summary *RunSummary) {
+	if len(status.Pending) == 0 {
+		return
+	}
+	slog.Info("Retrying pending notifications", "pending", len(status.Pending))
+	var remaining []PendingNotification
+	for _, pending := range status.Pending {
+		notifier := n.byName(pending.Target)
+		if notifier == nil {
+			summary.addError("Dropping pending %v alert for %v, the notifier is no longer configured", pending.Target, pending.Alert.Contract)
+			continue
+		}
+		err := n.sendWithRetry(ctx, notifier, pending.Alert)
+		if err == nil {
+			summary.countSent(pending.Target)
+			summary.archive(pending.Alert, []string{pending.Target}, nil)
+			slog.Info("Pending alert sent", "channel", pending.Target, "contract", pending.Alert.Contract)
+			continue
+		}
+		pending.Attempts++
+		pending.LastError = err.Error()
+		if pending.Attempts >= maxPendingAttempts || time.Since(pending.Created) > maxPendingAge {
+			summary.addError("Giving up on %v alert for %v after %v attempts: %v", pending.Target, pending.Alert.Contract, pending.Attempts, err)
+			continue
+		}
+		summary.addError("Pending %v alert for %v failed again: %v", pending.Target, pending.Alert.Contract, err)
+		remaining = append(remaining, pending)
+	}
+	status.Pending = remaining
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	alertKindMint = "mint"
+	// discordPrefix names extra Discord webhooks, e.g. discord_degen posts
+	// to DISCORD_DEGEN_WEBHOOK_ID and DISCORD_DEGEN_WEBHOOK_TOKEN
+	discordPrefix = "discord_"
+)
+
+// route is a notifier's posting rule. Every alert is posted unless the
+// notifier sets <NOTIFIER>_MIN_COUNT, <NOTIFIER>_TIERS or <NOTIFIER>_ALERTS,
+// and only the notifiers with <NOTIFIER>_UNVERIFIED get the collections
+// that don't meet the call out criteria.
+type route struct {
+	// minCount is the mint count a mint alert needs, on top of the tier
+	// thresholds
+	minCount int
+	// tiers and kinds limit the alerts to those tiers and kinds when set
+	tiers      map[string]bool
+	kinds      map[string]bool
+	unverified bool
+}
+
+func loadRoute(name string) route {
+	prefix := strings.ToUpper(name)
+	r := route{
+		minCount:   envInt(prefix+"_MIN_COUNT", 0),
+		unverified: envBool(prefix + "_UNVERIFIED"),
+	}
+	if tiers := envList(prefix+"_TIERS", ""); len(tiers) > 0 {
+		r.tiers = make(map[string]bool)
+		for _, tier := range tiers {
+			r.tiers[tier] = true
+		}
+	}
+	if kinds := envList(prefix+"_ALERTS", ""); len(kinds) > 0 {
+		r.kinds = make(map[string]bool)
+		for _, kind := range kinds {
+			r.kinds[kind] = true
+		}
+	}
+	return r
+}
+
+// accepts reports whether the alert is posted to the notifier.
+func (r route) accepts(alert Alert) bool {
+	if alert.Unverified && !r.unverified {
+		return false
+	}
+	kind := alert.Kind
+	if kind == "" {
+		kind = alertKindMint
+	}
+	if r.kinds != nil && !r.kinds[kind] {
+		return false
+	}
+	if kind != alertKindMint {
+		return true
+	}
+	if r.tiers != nil && !r.tiers[alert.Tier] {
+		return false
+	}
+	return alert.Count >= r.minCount
+}
+
+// acceptsUnverified reports whether any notifier gets the collections that
+// don't meet the call out criteria, so they are worth posting at all.
+func (n *notifiers) acceptsUnverified(canary bool) bool {
+	list := n.public
+	if canary {
+		list = n.canary
+	}
+	for _, notifier := range list {
+		if n.routes[notifier.Name()].unverified {
+			return true
+		}
+	}
+	return false
+}
+
+// routed returns the notifiers the alert is posted to.
+func (n *notifiers) routed(alert Alert) []Notifier {
+	list := n.public
+	if alert.Canary {
+		list = n.canary
+	}
+	var routed []Notifier
+	for _, notifier := range list {
+		if n.routes[notifier.Name()].accepts(alert) {
+			routed = append(routed, notifier)
+		}
+	}
+	return routed
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	"nftmintalert/opensea"
+)
+
+const (
+	// safelistRequire only alerts the collections with a trusted safelist
+	// status and safelistTag alerts the others with SAFELIST_TAG
+	safelistRequire = "require"
+	safelistTag     = "tag"
+
+	defaultSafelistStatuses = "verified,approved"
+	defaultSafelistTag      = "⚠️ DYOR"
+)
+
+// safelistFilter uses the collection's OpenSea safelist status to keep spam
+// and airdrop contracts out of the alerts, or to warn about them.
+type safelistFilter struct {
+	mode     string
+	statuses map[string]bool
+	tag      string
+}
+
+// getSafelistFilter reads SAFELIST_MODE, SAFELIST_STATUSES and SAFELIST_TAG.
+// The filter is off when SAFELIST_MODE is not set.
+func getSafelistFilter() safelistFilter {
+	f := safelistFilter{
+		mode:     strings.ToLower(envString("SAFELIST_MODE", "")),
+		statuses: make(map[string]bool),
+		tag:      envString("SAFELIST_TAG", defaultSafelistTag),
+	}
+	for _, status := range envList("SAFELIST_STATUSES", defaultSafelistStatuses) {
+		f.statuses[strings.ToLower(status)] = true
+	}
+	return f
+}
+
+// trusted reports whether the collection has one of the trusted statuses.
+func (f safelistFilter) trusted(collection *opensea.OpenSeaCollection) bool {
+	return f.statuses[strings.ToLower(collection.Collection.SafelistRequestStatus)]
+}
+
+// passes reports whether the collection may be alerted. Only the require
+// mode filters.
+func (f safelistFilter) passes(contract string, collection *opensea.OpenSeaCollection) bool {
+	if f.mode != safelistRequire || f.trusted(collection) {
+		return true
+	}
+	slog.Info("Collection not on the safelist, not calling out", "contract", contract, "safelist_status", collection.Collection.SafelistRequestStatus)
+	return false
+}
+
+// label tags the alert in the tag mode when its collection isn't trusted.
+func (f safelistFilter) label(alert *Alert) {
+	if f.mode != safelistTag || f.trusted(alert.Collection) {
+		return
+	}
+	alert.DYOR = true
+	alert.Headline = f.tag + " " + alert.headline()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	alertKindSales        = "sales"
+	defaultSalesThreshold = 50
+	defaultSalesHeadline  = "Sales Alert"
+)
+
+// marketplaces are the Seaport and Blur exchange contracts, deployed at the
+// same addresses on every chain they support.
+var marketplaces = map[common.Address]bool{
+	common.HexToAddress("0x00000000006c3852cbEf3e08E8dF289169EdE581"): true, // Seaport 1.1
+	common.HexToAddress("0x00000000000001ad428e4906aE43D8F9852d0dD6"): true, // Seaport 1.4
+	common.HexToAddress("0x00000000000000ADc04C56Bf30aC9d3c0aAF14dC"): true, // Seaport 1.5
+	common.HexToAddress("0x0000000000000068F116a894984e2DB1123eB395"): true, // Seaport 1.6
+	common.HexToAddress("0x000000000000Ad05Ccc4F10045630fb830B95127"): true, // Blur Exchange
+	common.HexToAddress("0xb2ecfE4E4D61f8790bbb9DE2D1259B9e2410CEA5"): true, // Blur Exchange v2
+}
+
+// saleEvents are the events the marketplaces emit when they settle a sale.
+var saleEvents = []string{
+	// Seaport
+	"OrderFulfilled(bytes32,address,address,address,(uint8,address,uint256,uint256)[],(uint8,address,uint256,uint256,address)[])",
+	// Blur Exchange
+	"OrdersMatched(address,address,(address,uint8,address,address,uint256,uint256,address,uint256,uint256,uint256,(uint16,address)[],uint256,bytes),bytes32,(address,uint8,address,address,uint256,uint256,address,uint256,uint256,uint256,(uint16,address)[],uint256,bytes),bytes32)",
+	// Blur Exchange v2 (BlurExchangeV2, not the Blend lending contract).
+	// Single ERC-721 fills are packed into one of the three Execution721
+	// events, the rest emit Execution.
+	"Execution((address,uint256,uint256,address,uint8),bytes32,uint256,uint256,(address,uint16),((address,uint16),(address,uint16)),uint8)",
+	"Execution721Packed(bytes32,uint256,uint256)",
+	"Execution721TakerFeePacked(bytes32,uint256,uint256,uint256)",
+	"Execution721MakerFeePacked(bytes32,uint256,uint256,uint256)",
+}
+
+// salesEnabled reports whether the sales alerts are turned on with
+// SALES_ALERTS.
+func salesEnabled() bool {
+	return envBool("SALES_ALERTS")
+}
+
+// saleTopics are the event signatures queried for sales.
+func saleTopics() []common.Hash {
+	topics := make([]common.Hash, len(saleEvents))
+	for i, event := range saleEvents {
+		topics[i] = crypto.Keccak256Hash([]byte(event))
+	}
+	return topics
+}
+
+// saleCounter counts the tokens of each contract sold on the marketplaces.
+// A transfer is a sale when a marketplace settled an order in the same
+// transaction, which is only known once every log of the transaction is in.
+type saleCounter struct {
+	exclude map[common.Address]bool
+	topics  map[common.Hash]bool
+	// transfers holds the tokens transferred per contract in each
+	// transaction
+	transfers map[common.Hash]map[string]uint64
+	settled   map[common.Hash]bool
+}
+
+func newSaleCounter(exclude map[common.Address]bool) *saleCounter {
+	topics := make(map[common.Hash]bool)
+	for _, topic := range saleTopics() {
+		topics[topic] = true
+	}
+	return &saleCounter{
+		exclude:   exclude,
+		topics:    topics,
+		transfers: make(map[common.Hash]map[string]uint64),
+		settled:   make(map[common.Hash]bool),
+	}
+}
+
+func (s *saleCounter) add(txLog types.Log) {
+	if len(txLog.Topics) == 0 {
+		return
+	}
+	if s.topics[txLog.Topics[0]] {
+		if marketplaces[txLog.Address] {
+			s.settled[txLog.TxHash] = true
+		}
+		return
+	}
+	from, tokens, ok := nftTransferOf(txLog, s.exclude)
+	if !ok || from.Hex() == nullAddress {
+		return
+	}
+	if _, burn := burnOf(txLog, s.exclude); burn {
+		return
+	}
+	if s.transfers[txLog.TxHash] == nil {
+		s.transfers[txLog.TxHash] = make(map[string]uint64)
+	}
+	s.transfers[txLog.TxHash][txLog.Address.Hex()] += tokens
+}
+
+// ranked returns the contracts ordered from most to least tokens sold.
+func (s *saleCounter) ranked() PairList {
+	counts := make(map[string]int)
+	for tx := range s.settled {
+		for contract, tokens := range s.transfers[tx] {
+			counts[contract] += int(tokens)
+		}
+	}
+	slog.Info("Counted sales", "sale_txs", len(s.settled), "collections", len(counts))
+	return rankByWordCount(counts)
+}
+
+// salesAlerts posts the collections with more than SALES_THRESHOLD tokens
+// sold.
+func salesAlerts() countedAlert {
+	return countedAlert{
+		kind:      alertKindSales,
+		threshold: envInt("SALES_THRESHOLD", defaultSalesThreshold),
+		headline:  envString("SALES_HEADLINE", defaultSalesHeadline),
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	scoringCount    = "count"
+	scoringTrending = "trending"
+
+	defaultScoreThreshold = 100
+	defaultScoreMinMints  = 20
+	// maxGrowth caps the growth term, so a contract going from nothing to
+	// a few mints does not outscore a busy one
+	maxGrowth = 10.0
+	// maxWindowContracts are the most contracts of a window kept in the
+	// status, the busiest first
+	maxWindowContracts = 500
+)
+
+// WindowCounts are the mint counts of each contract over the last window
+// scanned on a chain, for the growth of the trending score.
+type WindowCounts struct {
+	Time   time.Time      `json:"time"`
+	Counts map[string]int `json:"counts"`
+}
+
+// mintSignals are what a contract is scored on.
+type mintSignals struct {
+	Count int
+	// Previous is the count of the window before, zero when it is not known
+	Previous int
+	// Minters are the wallets minted to and Spent the amount spent on the
+	// mints in the native currency
+	Minters int
+	Spent   float64
+}
+
+// scorer rates how much a contract is trending. The tier thresholds apply
+// to the score.
+type scorer interface {
+	score(signals mintSignals) int
+	// spent reports whether the score uses the amount spent, which takes
+	// RPC calls to read
+	spent() bool
+}
+
+// newScorer returns the scorer selected by SCORING: the mint count by
+// default, or the trending score.
+func newScorer() scorer {
+	if os.Getenv("SCORING") != scoringTrending {
+		return countScorer{}
+	}
+	return trendingScorer{
+		mints:    envFloat("SCORE_WEIGHT_MINTS", 1),
+		growth:   envFloat("SCORE_WEIGHT_GROWTH", 50),
+		minters:  envFloat("SCORE_WEIGHT_MINTERS", 1),
+		spending: envFloat("SCORE_WEIGHT_SPENT", 0),
+		minMints: envInt("SCORE_MIN_MINTS", defaultScoreMinMints),
+	}
+}
+
+// countScorer scores the mint count, the flat MINT_THRESHOLD rule.
+type countScorer struct{}
+
+func (countScorer) score(signals mintSignals) int { return signals.Count }
+
+func (countScorer) spent() bool { return false }
+
+// trendingScorer adds up the weighted mint count, growth over the previous
+// window, unique minters and amount spent. The growth is the increase over
+// the previous window as a multiple of it, so mints doubling add the growth
+// weight once. Contracts with fewer than minMints mints score 0.
+type trendingScorer struct {
+	mints    float64
+	growth   float64
+	minters  float64
+	spending float64
+	minMints int
+}
+
+func (t trendingScorer) score(signals mintSignals) int {
+	if signals.Count < t.minMints {
+		return 0
+	}
+	// a contract without a previous window grows from minMints
+	base := math.Max(float64(signals.Previous), float64(t.minMints))
+	growth := math.Min(math.Max(float64(signals.Count-signals.Previous)/base, 0), maxGrowth)
+	score := t.mints*float64(signals.Count) +
+		t.growth*growth +
+		t.minters*float64(signals.Minters) +
+		t.spending*signals.Spent
+	return int(math.Round(score))
+}
+
+func (t trendingScorer) spent() bool { return t.spending > 0 }
+
+// scoreThreshold is the threshold of the normal tier: MINT_THRESHOLD, or
+// SCORE_THRESHOLD with the trending score.
+func scoreThreshold() (string, int) {
+	if os.Getenv("SCORING") == scoringTrending {
+		return "SCORE_THRESHOLD", envInt("SCORE_THRESHOLD", defaultScoreThreshold)
+	}
+	return "MINT_THRESHOLD", envInt("MINT_THRESHOLD", defaultMintThreshold)
+}
+
+// scoreMints scores the contracts in the mint list against the chain's
+// previous window and orders the list from the highest score. The amounts
+// spent read for the scores are kept for the alerts.
+func (a *alerter) scoreMints(ctx context.Context, chain Chain, mintlist PairList, previous *WindowCounts) PairList {
+	a.scores = make(map[string]int, len(mintlist))
+	a.previous = make(map[string]int)
+	a.spent = make(map[string]*MintStatus)
+	if a.scorer == nil {
+		return mintlist
+	}
+	// the previous window only counts when it is the one right before
+	if previous != nil && time.Since(previous.Time) > 2*time.Duration(a.minutes)*time.Minute {
+		previous = nil
+	}
+	for _, mint := range mintlist {
+		signals := mintSignals{Count: mint.Value}
+		if previous != nil {
+			signals.Previous = previous.Counts[mint.Key]
+			a.previous[mint.Key] = signals.Previous
+		}
+		if stats := a.minters[mint.Key]; stats != nil {
+			signals.Minters = stats.Unique
+		}
+		if a.scorer.spent() && a.prices != nil && a.scorer.score(signals) > 0 && !a.lists.blocked(mint.Key) && a.enrich() {
+			price, err := a.prices.mintValue(ctx, mint.Key, mint.Value)
+			if err != nil {
+				slog.Info("Unable to price the mints for the score", "chain", chain.Name, "contract", mint.Key, "error", err)
+			} else if price != nil {
+				signals.Spent = price.Value
+				a.spent[mint.Key] = price
+			}
+		}
+		a.scores[mint.Key] = a.scorer.score(signals)
+	}
+	scored := append(PairList{}, mintlist...)
+	sort.SliceStable(scored, func(i, j int) bool { return a.score(scored[i]) > a.score(scored[j]) })
+	return scored
+}
+
+// score returns the mint's score, its count when it was not scored.
+func (a *alerter) score(mint Pair) int {
+	if score, ok := a.scores[mint.Key]; ok {
+		return score
+	}
+	return mint.Value
+}
+
+// tierFor returns the tier the mint's score qualifies for.
+func (a *alerter) tierFor(mint Pair) *alertTier {
+	return a.lists.tierFor(a.tiers, mint.Key, a.score(mint))
+}
+
+// newWindowCounts keeps the busiest contracts of the counted mints as the
+// chain's window for the next run.
+func newWindowCounts(mintlist PairList) *WindowCounts {
+	window := &WindowCounts{Time: time.Now(), Counts: make(map[string]int)}
+	for i, mint := range mintlist {
+		if i == maxWindowContracts {
+			break
+		}
+		window.Counts[mint.Key] = mint.Value
+	}
+	return window
+}
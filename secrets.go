@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+const (
+	defaultSecretsRefreshMinutes = 60
+	secretsTimeout               = 10 * time.Second
+)
+
+var secrets struct {
+	sync.Mutex
+	loaded time.Time
+}
+
+// loadSecrets sets the environment variables held in AWS Secrets Manager and
+// SSM Parameter Store, so the credentials don't have to be in the Lambda
+// configuration. SECRETS_MANAGER_SECRET_ID lists secrets whose values are
+// JSON objects of variable names and values. SSM_PARAMETER_PATH is a path
+// whose parameters are named after the variables, e.g.
+// /nftmintalert/OPENSEA_API_KEY. The values replace the environment's and
+// are reloaded after SECRETS_REFRESH_MINUTES, so warm invocations reuse
+// them. When neither is set, or they can't be read, the environment
+// variables are used as they are.
+func loadSecrets() {
+	secretIDs := envList("SECRETS_MANAGER_SECRET_ID", "")
+	parameterPath := os.Getenv("SSM_PARAMETER_PATH")
+	if len(secretIDs) == 0 && parameterPath == "" {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	refresh := time.Duration(envInt("SECRETS_REFRESH_MINUTES", defaultSecretsRefreshMinutes)) * time.Minute
+	if !secrets.loaded.IsZero() && time.Since(secrets.loaded) < refresh {
+		return
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		slog.Error("Unable to load secrets", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	values := make(map[string]string)
+	failed := false
+	for _, id := range secretIDs {
+		if err := readSecret(ctx, secretsmanager.New(sess), id, values); err != nil {
+			slog.Error("Unable to load secrets", "secret", id, "error", err)
+			failed = true
+		}
+	}
+	if parameterPath != "" {
+		if err := readParameters(ctx, ssm.New(sess), parameterPath, values); err != nil {
+			slog.Error("Unable to load secrets", "path", parameterPath, "error", err)
+			failed = true
+		}
+	}
+	for name, value := range values {
+		os.Setenv(name, value)
+	}
+	slog.Info("Loaded secrets", "count", len(values))
+	if !failed {
+		// failures are retried on the next invocation
+		secrets.loaded = time.Now()
+	}
+}
+
+// readSecret adds the variables in the JSON object of the secret to values.
+func readSecret(ctx context.Context, svc *secretsmanager.SecretsManager, id string, values map[string]string) error {
+	result, err := svc.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return err
+	}
+	var secret map[string]interface{}
+	if err := json.Unmarshal([]byte(aws.StringValue(result.SecretString)), &secret); err != nil {
+		return fmt.Errorf("the secret is not a JSON object of variables: %w", err)
+	}
+	for name, value := range secret {
+		switch v := value.(type) {
+		case string:
+			values[name] = v
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// readParameters adds the parameters under the path to values, named by
+// the last part of the parameter name. SecureString parameters are
+// decrypted.
+func readParameters(ctx context.Context, svc *ssm.SSM, parameterPath string, values map[string]string) error {
+	return svc.GetParametersByPathPagesWithContext(ctx, &ssm.GetParametersByPathInput{
+		Path:           aws.String(strings.TrimRight(parameterPath, "/")),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	}, func(page *ssm.GetParametersByPathOutput, last bool) bool {
+		for _, parameter := range page.Parameters {
+			values[path.Base(aws.StringValue(parameter.Name))] = aws.StringValue(parameter.Value)
+		}
+		return true
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const targetSlack = "slack"
+
+func init() {
+	registerNotifier(targetSlack, newSlackNotifier)
+}
+
+// slackNotifier posts the alerts to a Slack incoming webhook as a Block Kit
+// message.
+type slackNotifier struct {
+	webhookURL string
+	client     *http.Client
+	template   *messageTemplate
+}
+
+func newSlackNotifier() (Notifier, error) {
+	s := &slackNotifier{
+		webhookURL: os.Getenv("SLACK_WEBHOOK_URL"),
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.webhookURL == "" {
+		return nil, fmt.Errorf("SLACK_WEBHOOK_URL must be set")
+	}
+	template, err := loadMessageTemplate(targetSlack)
+	if err != nil {
+		return nil, err
+	}
+	s.template = template
+	return s, nil
+}
+
+func (s *slackNotifier) Name() string { return targetSlack }
+
+// slackEscape escapes the characters Slack treats as control characters in
+// mrkdwn text.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// slackText is the built in mrkdwn text of the alert, shown under the
+// headline. Templates replace this text.
+func slackText(alert Alert) string {
+	collection := alert.Collection
+	name := slackEscape(collection.Name)
+	if link := collection.Collection.ExternalURL; link != "" {
+		name = fmt.Sprintf("<%v|%v>", link, name)
+	}
+	text := fmt.Sprintf("*%v*\n*%v %v*%v%v in *%v minutes*", name, alert.Count, alert.action(), alert.mintersText(), slackEscape(alert.priceText()), alert.minutes())
+	if stats := strings.TrimSpace(alert.statsText()); stats != "" {
+		text += "\n" + slackEscape(stats)
+	}
+	return text + fmt.Sprintf("\n<%v|View on OpenSea>", openseaLink(collection))
+}
+
+func (s *slackNotifier) render(alert Alert) (string, error) {
+	return s.template.text(alert, slackText)
+}
+
+func (s *slackNotifier) Notify(ctx context.Context, alert Alert) error {
+	collection := alert.Collection
+	headline := fmt.Sprintf("%v%v!", alert.headline(), chainTag(alert.Chain))
+	text, err := s.render(alert)
+	if err != nil {
+		return err
+	}
+
+	section := map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+	if collection.ImageURL != "" {
+		section["accessory"] = map[string]string{
+			"type":      "image",
+			"image_url": collection.ImageURL,
+			"alt_text":  collection.Name,
+		}
+	}
+	message := map[string]interface{}{
+		// shown in notifications
+		"text": fmt.Sprintf("%v %v %v %v", headline, collection.Name, alert.action(), alert.Count),
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "header",
+				"text": map[string]string{"type": "plain_text", "text": headline},
+			},
+			section,
+		},
+	}
+	buf, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("slack webhook: request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// the webhook URL is a secret, keep it out of the error
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("slack webhook response: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("slack webhook response read: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack webhook status %v: %v", resp.StatusCode, strings.TrimSpace(string(respBytes)))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	stateBackendS3       = "s3"
+	stateBackendDynamoDB = "dynamodb"
+)
+
+// stateStore keeps the Status between runs. Errors are logged, a status
+// that cannot be read starts out empty like a first run.
+type stateStore interface {
+	load() Status
+	save(status Status)
+}
+
+// newStateStore returns the store selected by STATE_BACKEND, S3 by default.
+func newStateStore(sess *session.Session, s3bucket string, s3key string) (stateStore, error) {
+	switch backend := os.Getenv("STATE_BACKEND"); backend {
+	case "", stateBackendS3:
+		return &s3Store{sess: sess, bucket: s3bucket, key: s3key}, nil
+	case stateBackendDynamoDB:
+		table := os.Getenv("DYNAMODB_TABLE")
+		if table == "" {
+			return nil, fmt.Errorf("DynamoDB table environment variable (DYNAMODB_TABLE) is not set")
+		}
+		return newDynamoStore(sess, table), nil
+	case stateBackendRedis:
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			return nil, fmt.Errorf("Redis URL environment variable (REDIS_URL) is not set")
+		}
+		return newRedisStore(url, envString("REDIS_PREFIX", defaultRedisPrefix))
+	default:
+		return nil, fmt.Errorf("unknown STATE_BACKEND %q", backend)
+	}
+}
+
+// s3Store keeps the Status as a single JSON object in S3.
+type s3Store struct {
+	sess   *session.Session
+	bucket string
+	key    string
+}
+
+func (s *s3Store) load() Status {
+	status := GetStatus(s.sess, s.bucket, s.key)
+	status.migrateRecents()
+	return status
+}
+
+func (s *s3Store) save(status Status) {
+	SetStatus(s.sess, status, s.bucket, s.key)
+}
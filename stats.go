@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"nftmintalert/opensea"
+)
+
+// statsFilter holds the minimum collection stats for an alert. Zero values
+// do not filter.
+type statsFilter struct {
+	MinFloorPrice   float64
+	MinOneDayVolume float64
+	MinOwners       int
+}
+
+func getStatsFilter() statsFilter {
+	return statsFilter{
+		MinFloorPrice:   envFloat("MIN_FLOOR_PRICE", 0),
+		MinOneDayVolume: envFloat("MIN_ONE_DAY_VOLUME", 0),
+		MinOwners:       envInt("MIN_OWNERS", 0),
+	}
+}
+
+func (f statsFilter) active() bool {
+	return f.MinFloorPrice > 0 || f.MinOneDayVolume > 0 || f.MinOwners > 0
+}
+
+// passes reports whether the collection stats meet the minimums. Without
+// stats a collection only passes when no minimum is set.
+func (f statsFilter) passes(contract string, stats *opensea.Stats) bool {
+	if !f.active() {
+		return true
+	}
+	if stats == nil {
+		slog.Info("No stats, stats filters not met", "contract", contract)
+		return false
+	}
+	if stats.Total.FloorPrice < f.MinFloorPrice {
+		slog.Info("Floor price below the minimum", "contract", contract, "floor_price", stats.Total.FloorPrice, "minimum", f.MinFloorPrice)
+		return false
+	}
+	if volume := stats.Interval(opensea.IntervalOneDay).Volume; volume < f.MinOneDayVolume {
+		slog.Info("One day volume below the minimum", "contract", contract, "volume", volume, "minimum", f.MinOneDayVolume)
+		return false
+	}
+	if stats.Total.NumOwners < f.MinOwners {
+		slog.Info("Owners below the minimum", "contract", contract, "owners", stats.Total.NumOwners, "minimum", f.MinOwners)
+		return false
+	}
+	return true
+}
+
+// fetchStats looks up the stats of the collection. It returns nil if the
+// contract is not part of a collection yet or the lookup fails.
+func (a *alerter) fetchStats(ctx context.Context, collection *opensea.OpenSeaCollection) *opensea.Stats {
+	slug := collection.Collection.Slug
+	if slug == "" {
+		return nil
+	}
+	reqCtx, calls := countRequests(ctx)
+	stats, err := a.osclient.Stats(reqCtx, slug)
+	a.summary.Usage.OpenSea += calls()
+	if err != nil {
+		a.summary.OpenSeaErrors++
+		a.summary.addError("Opensea API error on stats for %v: %v", slug, err)
+		return nil
+	}
+	return stats
+}
+
+// statsText describes the floor price and one day volume for the alert
+// text, e.g. " Floor: 0.05 ETH, 1d volume: 12.3 ETH". It is empty when the
+// stats are not known.
+func (a Alert) statsText() string {
+	if a.Stats == nil {
+		return ""
+	}
+	symbol := a.Stats.Total.FloorPriceSymbol
+	if symbol == "" {
+		symbol = "ETH"
+	}
+	return fmt.Sprintf(" Floor: %v %v, 1d volume: %.2f %v", a.Stats.Total.FloorPrice, symbol,
+		a.Stats.Interval(opensea.IntervalOneDay).Volume, symbol)
+}
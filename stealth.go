@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+
+	"nftmintalert/opensea"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const defaultStealthHeadline = "🥷 Stealth Mint Alert"
+
+// errCollectionNotFound is returned by the metadata providers for contracts
+// they have no collection for.
+var errCollectionNotFound = errors.New("collection not found")
+
+// nameSelector calls the ERC-721 name() function.
+var nameSelector = common.FromHex("0x06fdde03")
+
+// deploymentSource tells brand new contracts apart from established ones.
+type deploymentSource interface {
+	// deployedSince reports whether the contract had no code before block.
+	deployedSince(ctx context.Context, contract string, block uint64) (bool, error)
+	// contractName reads the name the contract reports on chain.
+	contractName(ctx context.Context, contract string) (string, error)
+}
+
+// stealthDetector reads the contract code and name from the chain.
+type stealthDetector struct {
+	client chainClient
+	usage  *UsageCounts
+}
+
+// newStealthDetector returns the detector for the chain, or nil unless the
+// stealth mint alerts are turned on with STEALTH_MINTS.
+func newStealthDetector(client chainClient, usage *UsageCounts) deploymentSource {
+	if !envBool("STEALTH_MINTS") {
+		return nil
+	}
+	return &stealthDetector{client: client, usage: usage}
+}
+
+func (s *stealthDetector) deployedSince(ctx context.Context, contract string, block uint64) (bool, error) {
+	if block == 0 {
+		return false, nil
+	}
+	s.usage.RPC++
+	code, err := s.client.CodeAt(ctx, common.HexToAddress(contract), new(big.Int).SetUint64(block-1))
+	if err != nil {
+		return false, err
+	}
+	return len(code) == 0, nil
+}
+
+func (s *stealthDetector) contractName(ctx context.Context, contract string) (string, error) {
+	address := common.HexToAddress(contract)
+	s.usage.RPC++
+	result, err := s.client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: nameSelector}, nil)
+	if err != nil {
+		return "", err
+	}
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		return "", err
+	}
+	values, err := abi.Arguments{abi.Argument{Type: stringType}}.Unpack(result)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	name, _ := values[0].(string)
+	return name, nil
+}
+
+// notIndexed reports whether the lookup failed because the collection isn't
+// known yet, rather than the provider being unavailable.
+func notIndexed(err error) bool {
+	if errors.Is(err, errCollectionNotFound) {
+		return true
+	}
+	var response *opensea.ErrorResponse
+	if errors.As(err, &response) {
+		return response.StatusCode == http.StatusNotFound
+	}
+	var httpErr *opensea.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// stealthCollection stands in for the collection of a contract that has no
+// collection yet, named from the contract itself when it has a name.
+func (a *alerter) stealthCollection(ctx context.Context, contract string) *opensea.OpenSeaCollection {
+	collection := &opensea.OpenSeaCollection{Address: contract, Name: contract}
+	name, err := a.deployments.contractName(ctx, contract)
+	if err != nil {
+		slog.Debug("Unable to read the contract name", "contract", contract, "error", err)
+	}
+	if name != "" {
+		collection.Name = name
+		collection.Collection.Name = name
+	}
+	return collection
+}
+
+// isStealth reports whether the contract was deployed within the last block
+// window. Contracts whose age can't be read are treated as established.
+func (a *alerter) isStealth(ctx context.Context, chain Chain, contract string, toBlock *big.Int) bool {
+	since := uint64(0)
+	if toBlock.Uint64() > chain.BlockWindow {
+		since = toBlock.Uint64() - chain.BlockWindow
+	}
+	deployed, err := a.deployments.deployedSince(ctx, contract, since)
+	if err != nil {
+		slog.Warn("Unable to read the contract deployment", "chain", chain.Name, "contract", contract, "error", err)
+		return false
+	}
+	return deployed
+}
+
+// stealthHeadline opens the stealth mint alerts in place of the tier
+// headline.
+func stealthHeadline() string {
+	return envString("STEALTH_HEADLINE", defaultStealthHeadline)
+}
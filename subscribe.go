@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	defaultSubscribeEvalSeconds = 60
+	subscribeReconnectDelay     = 5 * time.Second
+	subscribeMaxReconnectDelay  = 2 * time.Minute
+)
+
+// mintWindow counts the mints per contract over a sliding time window as
+// the logs arrive from a subscription.
+type mintWindow struct {
+	mu        sync.Mutex
+	window    time.Duration
+	exclude   map[common.Address]bool
+	mints     map[mintKey]windowMint
+	lastBlock uint64
+}
+
+// windowMint is when a mint was seen and the wallet it was minted to.
+type windowMint struct {
+	seen time.Time
+	to   common.Address
+}
+
+func newMintWindow(window time.Duration, exclude map[common.Address]bool) *mintWindow {
+	return &mintWindow{
+		window:  window,
+		exclude: exclude,
+		mints:   make(map[mintKey]windowMint),
+	}
+}
+
+func (w *mintWindow) add(txLog types.Log, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if txLog.BlockNumber > w.lastBlock {
+		w.lastBlock = txLog.BlockNumber
+	}
+	key, _, ok := mintOf(txLog, w.exclude)
+	if !ok {
+		return
+	}
+	if txLog.Removed {
+		// the block was reorged out
+		delete(w.mints, key)
+		return
+	}
+	if _, ok := w.mints[key]; !ok {
+		w.mints[key] = windowMint{seen: now, to: mintRecipient(txLog)}
+	}
+}
+
+// ranked drops the mints that have left the window and returns the
+// contracts ordered from most to least mints, the mint transactions and
+// minters of each contract and the last block seen.
+func (w *mintWindow) ranked(now time.Time) (PairList, map[string][]common.Hash, map[string]*MinterStats, uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	counts := make(map[string]int)
+	txs := make(map[string][]common.Hash)
+	minters := make(map[string]map[common.Address]int)
+	for key, mint := range w.mints {
+		if now.Sub(mint.seen) > w.window {
+			delete(w.mints, key)
+			continue
+		}
+		address := key.contract.Hex()
+		counts[address]++
+		txs[address] = append(txs[address], key.tx)
+		if minters[address] == nil {
+			minters[address] = make(map[common.Address]int)
+		}
+		minters[address][mint.to]++
+	}
+	return rankByWordCount(counts), txs, minterStats(minters), w.lastBlock
+}
+
+// chainWSURL returns the WebSocket endpoint for the chain from <NAME>_WS_URL,
+// falling back to the RPC URL when it is already a WebSocket URL.
+func chainWSURL(chain Chain) (string, error) {
+	prefix := strings.ToUpper(chain.Name)
+	url := os.Getenv(prefix + "_WS_URL")
+	if url == "" && (strings.HasPrefix(chain.RPCURL, "wss://") || strings.HasPrefix(chain.RPCURL, "ws://")) {
+		url = chain.RPCURL
+	}
+	if url == "" {
+		return "", fmt.Errorf("%v WebSocket URL environment variable (%v_WS_URL) is not set", chain.DisplayName, prefix)
+	}
+	return url, nil
+}
+
+// subscribeChain feeds the Transfer logs of the chain into the window until
+// the context is canceled, reconnecting when the subscription drops.
+func subscribeChain(ctx context.Context, chain Chain, url string, addresses []common.Address, window *mintWindow) {
+	query := ethereum.FilterQuery{
+		Addresses: addresses,
+		Topics:    [][]common.Hash{transferTopics()},
+	}
+	delay := subscribeReconnectDelay
+	for ctx.Err() == nil {
+		err := streamLogs(ctx, url, query, window)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Subscription error, reconnecting", "chain", chain.Name, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > subscribeMaxReconnectDelay {
+			delay = subscribeMaxReconnectDelay
+		}
+	}
+}
+
+// streamLogs runs a single subscription until it fails.
+func streamLogs(ctx context.Context, url string, query ethereum.FilterQuery, window *mintWindow) error {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return fmt.Errorf("unable to connect to the network: %w", err)
+	}
+	defer client.Close()
+	logs := make(chan types.Log, 256)
+	sub, err := client.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		return fmt.Errorf("unable to subscribe to transfer logs: %w", err)
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case txLog := <-logs:
+			window.add(txLog, time.Now())
+		}
+	}
+}
+
+// runSubscribe is the long running alternative to the Lambda. It subscribes
+// to the Transfer logs of every chain over WebSocket and checks the mints in
+// the sliding window every SUBSCRIBE_EVAL_SECONDS. It returns the exit code.
+func runSubscribe(ctx context.Context) int {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveMetrics()
+	serveAdmin(nil)
+
+	if err := validateConfig(); err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		return 1
+	}
+	chains, err := loadChains()
+	if err != nil {
+		slog.Error("Unable to load the chains", "error", err)
+		return 1
+	}
+	lists, err := loadContractLists()
+	if err != nil {
+		slog.Error("Unable to load the contract lists", "error", err)
+		return 1
+	}
+	lists.exclude(chains)
+	s3bucket := os.Getenv("S3_BUCKET")
+	s3key := os.Getenv("S3_FILE_KEY")
+	openseaKey := os.Getenv("OPENSEA_API_KEY")
+	addresses, err := queryAddresses()
+	if err != nil {
+		slog.Error("Unable to load the watchlist", "error", err)
+		return 1
+	}
+	tiers, err := loadTiers()
+	if err != nil {
+		slog.Error("Unable to load the alert tiers", "error", err)
+		return 1
+	}
+	minutes := envInt("SUBSCRIBE_WINDOW_MINUTES", windowMinutes())
+	windowLength := time.Duration(minutes) * time.Minute
+	interval := time.Duration(envInt("SUBSCRIBE_EVAL_SECONDS", defaultSubscribeEvalSeconds)) * time.Second
+	if windowLength <= 0 || interval <= 0 {
+		slog.Error("SUBSCRIBE_WINDOW_MINUTES and SUBSCRIBE_EVAL_SECONDS must be at least 1")
+		return 1
+	}
+
+	windows := make(map[string]*mintWindow)
+	clients := make(map[string]*ethclient.Client)
+	for _, chain := range chains {
+		url, err := chainWSURL(chain)
+		if err != nil {
+			slog.Error("No websocket URL for the chain", "chain", chain.Name, "error", err)
+			return 1
+		}
+		// The RPC URL is used to price the mints
+		client, err := ethclient.Dial(chain.RPCURL)
+		if err != nil {
+			slog.Error("Unable to connect to the network", "chain", chain.Name, "error", err)
+			return 1
+		}
+		defer client.Close()
+		clients[chain.Name] = client
+		windows[chain.Name] = newMintWindow(windowLength, chain.Exclude)
+		go subscribeChain(ctx, chain, url, addresses, windows[chain.Name])
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		slog.Error("Unable to create a new session", "error", err)
+		return 1
+	}
+	store, err := newStateStore(sess, s3bucket, s3key)
+	if err != nil {
+		slog.Error("Unable to open the state store", "error", err)
+		return 1
+	}
+	status := store.load()
+	ops := getOpsConfig()
+	targets := loadNotifiers(nil)
+	alerts := &alerter{
+		osclient:       newCollectionSource(openseaKey),
+		targets:        targets,
+		canary:         getCanaryConfig(),
+		tiers:          tiers,
+		minutes:        minutes,
+		cooldown:       alertCooldown(),
+		filter:         getStatsFilter(),
+		safelist:       getSafelistFilter(),
+		lists:          lists,
+		minterFilter:   getMinterFilter(),
+		events:         newEventReader(),
+		scorer:         newScorer(),
+		tokens:         getTokenFilter(),
+		concurrency:    envInt("OPENSEA_CONCURRENCY", defaultOpenSeaConcurrency),
+		requestTimeout: time.Duration(envInt("OPENSEA_TIMEOUT_SECONDS", defaultOpenSeaTimeoutSeconds)) * time.Second,
+	}
+	cacheKey := os.Getenv("METADATA_CACHE_KEY")
+	if cacheKey == "" {
+		cacheKey = s3key + ".cache"
+	}
+	cacheTTL := time.Duration(envInt("METADATA_CACHE_TTL_HOURS", defaultMetadataCacheTTLHours)) * time.Hour
+	if cacheTTL > 0 {
+		alerts.cache = loadMetadataCache(sess, s3bucket, cacheKey, cacheTTL)
+	}
+	persist := func() { store.save(status) }
+
+	slog.Info("Subscribed", "chains", len(chains), "window", windowLength.String(), "interval", interval.String())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("End")
+			return 0
+		case <-ticker.C:
+		}
+		summary := newRunSummary()
+		alerts.summary = summary
+		targets.usage = &summary.Usage
+		targets.retryPending(ctx, &status, summary)
+		for _, chain := range chains {
+			mintlist, txs, minters, lastBlock := windows[chain.Name].ranked(time.Now())
+			summary.Blocks = append(summary.Blocks, fmt.Sprintf("%v ..%v", chain.Name, lastBlock))
+			summary.Mints += len(mintlist)
+			alerts.prices = newMintPricer(clients[chain.Name], chain, txs, &summary.Usage)
+			alerts.deployments = newStealthDetector(clients[chain.Name], &summary.Usage)
+			alerts.names = newENSResolver(clients[chain.Name], chain, &summary.Usage)
+			alerts.supplies = newSupplyReader(clients[chain.Name], &summary.Usage)
+			alerts.minters = minters
+			// the window slides, there is no previous one to grow from
+			mintlist = alerts.scoreMints(ctx, chain, mintlist, nil)
+			alerts.post(ctx, &status, chain, mintlist, new(big.Int).SetUint64(lastBlock), persist)
+		}
+		finishStatus(&status, summary, ops, alerts.cooldown)
+		store.save(status)
+		alerts.cache.save(sess, s3bucket, cacheKey)
+		reportRun(summary, ops)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// RunSummary records the outcome of a single run so it can be logged and
+// reported to the ops channel.
+type RunSummary struct {
+	Start      time.Time
+	Blocks     []string
+	Logs       int
+	Mints      int
+	Alerts     int
+	Usage      UsageCounts
+	UsageToday UsageCounts
+	Failed     bool
+	Silent     bool
+	// Skipped is set when the run did not scan, e.g. the previous run still
+	// holds the lock. It is not an error.
+	Skipped bool
+	Errors  []string
+	// BlocksScanned, OpenSeaErrors and Sent, the alerts delivered per
+	// notifier, are published as metrics
+	BlocksScanned uint64
+	OpenSeaErrors int
+	Sent          map[string]int
+	// Archive are the alerts to write to the alert archive
+	Archive []archiveRecord
+}
+
+func newRunSummary() *RunSummary {
+	return &RunSummary{Start: time.Now()}
+}
+
+// fail marks the run as failed. Use it for errors that stop the run.
+func (s *RunSummary) fail(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	slog.Error(msg)
+	s.Failed = true
+	s.Errors = append(s.Errors, msg)
+}
+
+// addError records an error that did not stop the run.
+func (s *RunSummary) addError(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	slog.Warn(msg)
+	s.Errors = append(s.Errors, msg)
+}
+
+// skip records why the run did not scan. It is logged, not reported as an
+// error.
+func (s *RunSummary) skip(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	slog.Info(msg)
+	s.Skipped = true
+}
+
+// countSent records an alert delivered by the notifier.
+func (s *RunSummary) countSent(notifier string) {
+	if s.Sent == nil {
+		s.Sent = make(map[string]int)
+	}
+	s.Sent[notifier]++
+}
+
+// Partial reports whether the run completed with errors.
+func (s *RunSummary) Partial() bool {
+	return !s.Failed && len(s.Errors) > 0
+}
+
+// result is ok, failed, partial or skipped.
+func (s *RunSummary) result() string {
+	switch {
+	case s.Failed:
+		return "failed"
+	case s.Partial():
+		return "partial"
+	case s.Skipped:
+		return "skipped"
+	}
+	return "ok"
+}
+
+// log writes the summary to the log, one field per count.
+func (s *RunSummary) log() {
+	slog.Info("Run summary",
+		"result", s.result(),
+		"duration", time.Since(s.Start).Round(time.Millisecond).String(),
+		"blocks", s.Blocks,
+		"logs", s.Logs,
+		"mint_contracts", s.Mints,
+		"alerts", s.Alerts,
+		"usage", s.Usage.String(),
+		"usage_today", s.UsageToday.String(),
+		"errors", s.Errors,
+		"version", buildInfo())
+}
+
+func (s *RunSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n", buildInfo())
+	fmt.Fprintf(&b, "Run %v in %v. Blocks: %v Logs: %v Mint contracts: %v Alerts: %v",
+		s.result(), time.Since(s.Start).Round(time.Millisecond), strings.Join(s.Blocks, ", "), s.Logs, s.Mints, s.Alerts)
+	fmt.Fprintf(&b, "\nAPI calls this run: %v\nAPI calls today: %v", s.Usage, s.UsageToday)
+	for _, e := range s.Errors {
+		fmt.Fprintf(&b, "\n - %v", e)
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"nftmintalert/opensea"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// totalSupplySelector calls the ERC-721 totalSupply() function.
+var totalSupplySelector = common.FromHex("0x18160ddd")
+
+// collectionDateLayouts are the formats OpenSea and the other providers
+// give the collection creation date in.
+var collectionDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05.999999", "2006-01-02"}
+
+// supplySource reads a contract's total supply from the chain.
+type supplySource interface {
+	totalSupply(ctx context.Context, contract string) (*big.Int, error)
+}
+
+// supplyReader calls totalSupply() on the contract, for the collections
+// the metadata providers have no supply for.
+type supplyReader struct {
+	client chainClient
+	usage  *UsageCounts
+}
+
+// newSupplyReader returns the reader for the chain, or nil unless
+// MIN_SUPPLY or MAX_SUPPLY is set.
+func newSupplyReader(client chainClient, usage *UsageCounts) supplySource {
+	if !getTokenFilter().checksSupply() {
+		return nil
+	}
+	return &supplyReader{client: client, usage: usage}
+}
+
+func (s *supplyReader) totalSupply(ctx context.Context, contract string) (*big.Int, error) {
+	address := common.HexToAddress(contract)
+	s.usage.RPC++
+	result, err := s.client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: totalSupplySelector}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 32 {
+		// not enumerable
+		return nil, nil
+	}
+	return new(big.Int).SetBytes(result[:32]), nil
+}
+
+// tokenFilter keeps semi-fungible spam, zero supply proxies and old
+// collections being airdropped around out of the alerts, from the
+// collection's token standard, total supply and age.
+type tokenFilter struct {
+	// schemas are the allowed token standards, e.g. ERC721. Empty allows
+	// all.
+	schemas map[string]bool
+	// minSupply and maxSupply bound the total supply. Zero is no bound.
+	minSupply int64
+	maxSupply int64
+	// maxAge is the oldest a collection can be. Zero is no limit.
+	maxAge time.Duration
+}
+
+// getTokenFilter reads ALLOWED_SCHEMAS, MIN_SUPPLY, MAX_SUPPLY and
+// MAX_COLLECTION_AGE_DAYS.
+func getTokenFilter() tokenFilter {
+	f := tokenFilter{
+		schemas:   make(map[string]bool),
+		minSupply: int64(envInt("MIN_SUPPLY", 0)),
+		maxSupply: int64(envInt("MAX_SUPPLY", 0)),
+		maxAge:    time.Duration(envInt("MAX_COLLECTION_AGE_DAYS", 0)) * 24 * time.Hour,
+	}
+	for _, schema := range envList("ALLOWED_SCHEMAS", "") {
+		f.schemas[normalizeSchema(schema)] = true
+	}
+	return f
+}
+
+// normalizeSchema turns the providers' token standards, e.g. erc721 or
+// ERC-721, into ERC721.
+func normalizeSchema(schema string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(schema), "-", ""))
+}
+
+func (f tokenFilter) checksSupply() bool {
+	return f.minSupply > 0 || f.maxSupply > 0
+}
+
+// supply returns the collection's total supply from the metadata, or from
+// the chain when the metadata has none. It is nil when it isn't known.
+func (a *alerter) supply(ctx context.Context, contract string, collection *opensea.OpenSeaCollection) *big.Int {
+	if supply, ok := new(big.Int).SetString(collection.TotalSupply, 10); ok && supply.Sign() > 0 {
+		return supply
+	}
+	if a.supplies == nil {
+		return nil
+	}
+	supply, err := a.supplies.totalSupply(ctx, contract)
+	if err != nil {
+		slog.Debug("Unable to read the total supply", "contract", contract, "error", err)
+		return nil
+	}
+	return supply
+}
+
+// tokenPasses reports whether the collection's token standard, supply and
+// age are within the limits. Unknown values pass, and so do the allowlisted
+// contracts.
+func (a *alerter) tokenPasses(ctx context.Context, contract string, collection *opensea.OpenSeaCollection) bool {
+	f := a.tokens
+	if a.lists.allowed(contract) {
+		return true
+	}
+	if schema := normalizeSchema(collection.SchemaName); len(f.schemas) > 0 && schema != "" && !f.schemas[schema] {
+		slog.Info("Token standard not allowed, not alerting", "contract", contract, "schema", schema)
+		return false
+	}
+	if f.checksSupply() {
+		if supply := a.supply(ctx, contract, collection); supply != nil {
+			if f.minSupply > 0 && supply.Cmp(big.NewInt(f.minSupply)) < 0 {
+				slog.Info("Total supply below MIN_SUPPLY, not alerting", "contract", contract, "supply", supply)
+				return false
+			}
+			if f.maxSupply > 0 && supply.Cmp(big.NewInt(f.maxSupply)) > 0 {
+				slog.Info("Total supply above MAX_SUPPLY, not alerting", "contract", contract, "supply", supply)
+				return false
+			}
+		}
+	}
+	if f.maxAge > 0 {
+		if created, ok := collectionCreated(collection); ok && time.Since(created) > f.maxAge {
+			slog.Info("Collection older than MAX_COLLECTION_AGE_DAYS, not alerting", "contract", contract, "created", created.Format(usageDateFormat))
+			return false
+		}
+	}
+	return true
+}
+
+// collectionCreated returns when the collection was created, if the
+// metadata has the date.
+func collectionCreated(collection *opensea.OpenSeaCollection) (time.Time, bool) {
+	for _, date := range []string{collection.Collection.CreatedDate, collection.CreatedDate} {
+		if date == "" {
+			continue
+		}
+		for _, layout := range collectionDateLayouts {
+			if created, err := time.Parse(layout, date); err == nil {
+				return created, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
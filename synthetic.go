@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"nftmintalert/opensea"
+)
+
+// TestMint describes a synthetic mint that is injected into the alert
+// pipeline to check the templates, routing and notifier credentials without
+// waiting for a real mint. Trigger it with an event like
+// {"test": {"contract": "0x...", "count": 150}}.
+type TestMint struct {
+	// Chain defaults to ethereum
+	Chain    string `json:"chain"`
+	Contract string `json:"contract"`
+	Count    int    `json:"count"`
+	// MockEnrichment skips the OpenSea lookup and uses a made up collection.
+	MockEnrichment bool `json:"mock_enrichment"`
+}
+
+func mockCollection(contract string) *opensea.OpenSeaCollection {
+	collection := &opensea.OpenSeaCollection{
+		Address:      contract,
+		Name:         "Test Collection",
+		ExternalLink: "https://opensea.io",
+		ImageURL:     "https://opensea.io/static/images/logos/opensea-logo.png",
+	}
+	collection.Collection.Name = "Test Collection"
+	collection.Collection.Slug = "test-collection"
+	collection.Collection.ExternalURL = "https://opensea.io"
+	collection.Collection.SafelistRequestStatus = "verified"
+	return collection
+}
+
+func mockStats() *opensea.Stats {
+	stats := &opensea.Stats{Intervals: []opensea.StatsInterval{{Interval: opensea.IntervalOneDay, Volume: 12.5, Sales: 250}}}
+	stats.Total.FloorPrice = 0.05
+	stats.Total.FloorPriceSymbol = "ETH"
+	stats.Total.NumOwners = 1000
+	return stats
+}
+
+// sendTest posts an alert for a synthetic mint. The status file is not read
+// or updated, so the test never suppresses or is suppressed by a real alert.
+func (a *alerter) sendTest(ctx context.Context, test TestMint) {
+	if test.Contract == "" {
+		test.Contract = nullAddress
+	}
+	if test.Count == 0 {
+		// just over the lowest threshold
+		test.Count = a.tiers[len(a.tiers)-1].Threshold + 1
+	}
+	if test.Chain == "" {
+		test.Chain = chainEthereum
+	}
+	chain, ok := knownChains[test.Chain]
+	if !ok {
+		a.summary.fail("Unknown chain %q for the test alert", test.Chain)
+		return
+	}
+	slog.Info("Sending test alert", "chain", test.Chain, "contract", test.Contract, "count", test.Count, "mock", test.MockEnrichment)
+
+	var collection *opensea.OpenSeaCollection
+	if test.MockEnrichment {
+		collection = mockCollection(test.Contract)
+	} else {
+		reqCtx, calls := countRequests(ctx)
+		var err error
+		collection, err = a.osclient.ChainAssetContract(reqCtx, chain.OpenSea, test.Contract)
+		a.summary.Usage.OpenSea += calls()
+		if err != nil {
+			a.summary.OpenSeaErrors++
+			a.summary.fail("Opensea API error on test contract %v: %v", test.Contract, err)
+			return
+		}
+	}
+	var stats *opensea.Stats
+	if test.MockEnrichment {
+		stats = mockStats()
+	} else {
+		stats = a.fetchStats(ctx, collection)
+	}
+	if !a.lists.callOut(test.Contract, callOut(collection, test.Contract, test.Count) && a.filter.passes(test.Contract, stats) && a.safelist.passes(test.Contract, collection)) {
+		slog.Info("Test collection does not meet the call out criteria, nothing sent", "contract", test.Contract)
+		return
+	}
+	tier := tierFor(a.tiers, test.Count)
+	if tier == nil {
+		// post below the threshold too, the test is about the delivery
+		tier = &a.tiers[len(a.tiers)-1]
+	}
+	alert := Alert{
+		Key:        fmt.Sprintf("test:%v:%v", test.Contract, time.Now().UnixNano()),
+		Chain:      test.Chain,
+		Contract:   test.Contract,
+		Count:      test.Count,
+		Collection: collection,
+		Stats:      stats,
+		Tier:       tier.Name,
+		Headline:   tier.Headline,
+		Minutes:    a.minutes,
+	}
+	a.safelist.label(&alert)
+	var scratch Status
+	a.send(ctx, &scratch, alert, func() {})
+	a.summary.Alerts++
+}
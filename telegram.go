@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const targetTelegram = "telegram"
+const telegramHost = "https://api.telegram.org"
+
+func init() {
+	registerNotifier(targetTelegram, newTelegramNotifier)
+}
+
+// telegramNotifier posts the alerts to a Telegram channel or chat through
+// the Bot API.
+type telegramNotifier struct {
+	token    string
+	chatId   string
+	client   *http.Client
+	template *messageTemplate
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func newTelegramNotifier() (Notifier, error) {
+	t := &telegramNotifier{
+		token:  os.Getenv("TELEGRAM_BOT_TOKEN"),
+		chatId: os.Getenv("TELEGRAM_CHAT_ID"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if t.token == "" || t.chatId == "" {
+		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID must be set")
+	}
+	template, err := loadMessageTemplate(targetTelegram)
+	if err != nil {
+		return nil, err
+	}
+	t.template = template
+	return t, nil
+}
+
+func (t *telegramNotifier) Name() string { return targetTelegram }
+
+// telegramText is the built in message for the alert, in Telegram's HTML
+// formatting. Templates are sent with the same parse mode.
+func telegramText(alert Alert) string {
+	collection := alert.Collection
+	return fmt.Sprintf("%v%v!\n\n<b><a href=\"%v\">%v</a></b>\n\n<b>%v %v</b>%v%v in <b>%v minutes</b>\n%v\n%v",
+		html.EscapeString(alert.headline()), html.EscapeString(chainTag(alert.Chain)), html.EscapeString(collection.Collection.ExternalURL), html.EscapeString(collection.Name), alert.Count, alert.action(), alert.mintersText(), html.EscapeString(alert.priceText()), alert.minutes(), html.EscapeString(strings.TrimSpace(alert.statsText())),
+		html.EscapeString(openseaLink(collection)))
+}
+
+func (t *telegramNotifier) render(alert Alert) (string, error) {
+	return t.template.text(alert, telegramText)
+}
+
+func (t *telegramNotifier) Notify(ctx context.Context, alert Alert) error {
+	collection := alert.Collection
+	text, err := t.render(alert)
+	if err != nil {
+		return err
+	}
+
+	method := "sendMessage"
+	params := map[string]interface{}{
+		"chat_id":    t.chatId,
+		"parse_mode": "HTML",
+	}
+	if collection.ImageURL != "" {
+		method = "sendPhoto"
+		params["photo"] = collection.ImageURL
+		params["caption"] = text
+	} else {
+		params["text"] = text
+	}
+	return t.call(ctx, method, params)
+}
+
+func (t *telegramNotifier) call(ctx context.Context, method string, params map[string]interface{}) error {
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%v/bot%v/%v", telegramHost, t.token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("telegram %v: request: %w", method, err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// don't leak the bot token in the URL of the error
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("telegram %v response: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("telegram %v response read: %w", method, err)
+	}
+	result := &telegramResponse{}
+	if err := json.Unmarshal(respBytes, result); err != nil {
+		return fmt.Errorf("telegram %v status %v", method, resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram %v status %v: %v", method, resp.StatusCode, result.Description)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"nftmintalert/opensea"
+)
+
+// messageTemplate is an operator supplied text/template for the alert text
+// of one notifier. A nil template keeps the notifier's built in format.
+type messageTemplate struct {
+	tmpl *template.Template
+}
+
+// messageData is the value the message templates are executed with, e.g.
+// {{.Collection.Name}}, {{.Count}} or {{.Link}}.
+type messageData struct {
+	Collection *opensea.OpenSeaCollection
+	Contract   string
+	// Chain is the display name of the chain, e.g. Polygon
+	Chain string
+	// ChainTag is " on Polygon" for chains other than Ethereum
+	ChainTag string
+	// Kind is empty for mint alerts and "sales" for sales alerts, and Action
+	// is what Count counts, "minted" or "sold"
+	Kind          string
+	Action        string
+	Count         int
+	WindowMinutes int
+	Tier          string
+	Headline      string
+	// Stealth is true for brand new contracts, see STEALTH_MINTS
+	Stealth bool
+	// Unverified is true for collections that don't meet the call out
+	// criteria, see <NOTIFIER>_UNVERIFIED
+	Unverified bool
+	// DYOR is true for collections without a trusted safelist status and
+	// SafelistStatus is the status, e.g. verified or not_requested
+	DYOR           bool
+	SafelistStatus string
+	// Price describes the amount spent, e.g. "for ~1.2 ETH total (avg
+	// 0.0120 ETH)". It is empty when the price was not read.
+	Price string
+	// HasStats is false when the OpenSea stats were not fetched and the
+	// floor price and volume are zero
+	HasStats      bool
+	FloorPrice    float64
+	OneDayVolume  float64
+	StatsCurrency string
+	// Score is the trending score and PreviousCount the mint count of the
+	// window before, both zero without SCORING=trending
+	Score         int
+	PreviousCount int
+	// UniqueMinters is the number of wallets minted to and TopMinterShare
+	// the fraction of the mints made by the busiest one. Both are zero when
+	// the minters are not known.
+	UniqueMinters  int
+	TopMinterShare float64
+	// NotableMinters are the ENS names of the top minting wallets, see
+	// ENS_MINTERS
+	NotableMinters []string
+	// OpenSeaMints and OpenSeaSales are the mints and sales in OpenSea's
+	// events, see OPENSEA_EVENTS. HasActivity is false when the events were
+	// not read.
+	HasActivity  bool
+	OpenSeaMints int
+	OpenSeaSales int
+	// Link is the collection's OpenSea page and ExternalURL its own site
+	Link        string
+	ExternalURL string
+}
+
+// loadMessageTemplate reads the template for the named notifier from
+// <NAME>_TEMPLATE, or from the local file or s3://bucket/key in
+// <NAME>_TEMPLATE_FILE. It returns nil when neither is set.
+func loadMessageTemplate(name string) (*messageTemplate, error) {
+	prefix := strings.ToUpper(name) + "_TEMPLATE"
+	text := os.Getenv(prefix)
+	source := prefix
+	if text == "" {
+		file := os.Getenv(prefix + "_FILE")
+		if file == "" {
+			return nil, nil
+		}
+		buf, err := readConfigFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%v_FILE: %w", prefix, err)
+		}
+		text = string(buf)
+		source = file
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template in %v: %w", source, err)
+	}
+	return &messageTemplate{tmpl: tmpl}, nil
+}
+
+// text renders the alert with the template, or with format when there is no
+// template.
+func (m *messageTemplate) text(alert Alert, format func(Alert) string) (string, error) {
+	if m == nil {
+		return format(alert), nil
+	}
+	var buf bytes.Buffer
+	if err := m.tmpl.Execute(&buf, alert.messageData()); err != nil {
+		return "", fmt.Errorf("template %v: %w", m.tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+func (a Alert) messageData() messageData {
+	chain := a.Chain
+	if chain == "" {
+		chain = chainEthereum
+	}
+	data := messageData{
+		Collection:     a.Collection,
+		Contract:       a.Contract,
+		Chain:          chainDisplayName(chain),
+		ChainTag:       chainTag(a.Chain),
+		Kind:           a.Kind,
+		Action:         a.action(),
+		Count:          a.Count,
+		WindowMinutes:  a.minutes(),
+		Tier:           a.Tier,
+		Headline:       a.headline(),
+		Stealth:        a.Stealth,
+		Unverified:     a.Unverified,
+		DYOR:           a.DYOR,
+		SafelistStatus: a.Collection.Collection.SafelistRequestStatus,
+		Price:          strings.TrimSpace(a.priceText()),
+		Score:          a.Score,
+		PreviousCount:  a.Previous,
+		Link:           openseaLink(a.Collection),
+		ExternalURL:    a.Collection.Collection.ExternalURL,
+	}
+	if a.Minters != nil {
+		data.UniqueMinters = a.Minters.Unique
+		data.TopMinterShare = a.Minters.TopShare
+		data.NotableMinters = a.Minters.Notable
+	}
+	if a.Activity != nil {
+		data.HasActivity = true
+		data.OpenSeaMints = a.Activity.Mints
+		data.OpenSeaSales = a.Activity.Sales
+	}
+	if a.Stats != nil {
+		data.HasStats = true
+		data.FloorPrice = a.Stats.Total.FloorPrice
+		data.OneDayVolume = a.Stats.Interval(opensea.IntervalOneDay).Volume
+		data.StatsCurrency = a.Stats.Total.FloorPriceSymbol
+		if data.StatsCurrency == "" {
+			data.StatsCurrency = "ETH"
+		}
+	}
+	return data
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMintThreshold = 100
+	defaultWindowMinutes = 10
+	tierNormal           = "normal"
+	defaultHeadline      = "Mint Alert"
+)
+
+// alertTier is a level of alert for collections minting more than
+// Threshold. The headline opens the alert message.
+type alertTier struct {
+	Name      string
+	Threshold int
+	Headline  string
+}
+
+// loadTiers reads the alert tiers. The normal tier alerts on more than
+// MINT_THRESHOLD mints, or a score over SCORE_THRESHOLD with
+// SCORING=trending. ALERT_TIERS adds higher tiers as a comma separated list
+// of name:threshold:headline, e.g. "hot:500:🔥 Hot Mint Alert". The tiers
+// are returned from the highest threshold to the lowest.
+func loadTiers() ([]alertTier, error) {
+	name, threshold := scoreThreshold()
+	if threshold < 1 {
+		return nil, fmt.Errorf("%v must be at least 1", name)
+	}
+	tiers := []alertTier{{Name: tierNormal, Threshold: threshold, Headline: defaultHeadline}}
+	for _, entry := range envList("ALERT_TIERS", "") {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid ALERT_TIERS entry %q, use name:threshold:headline", entry)
+		}
+		tier := alertTier{Name: strings.TrimSpace(parts[0]), Headline: defaultHeadline}
+		count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || count < threshold {
+			return nil, fmt.Errorf("invalid ALERT_TIERS threshold %q, must be a number of at least %v (%v)", parts[1], name, threshold)
+		}
+		tier.Threshold = count
+		if len(parts) == 3 && strings.TrimSpace(parts[2]) != "" {
+			tier.Headline = strings.TrimSpace(parts[2])
+		}
+		tiers = append(tiers, tier)
+	}
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].Threshold > tiers[j].Threshold })
+	return tiers, nil
+}
+
+// tierFor returns the highest tier the mint count qualifies for, or nil if
+// it is below every threshold.
+func tierFor(tiers []alertTier, count int) *alertTier {
+	for i := range tiers {
+		if count > tiers[i].Threshold {
+			return &tiers[i]
+		}
+	}
+	return nil
+}
+
+// windowMinutes is the time the mint counts cover, used in the alert text.
+// WINDOW_MINUTES should match the block window and the invocation schedule.
+func windowMinutes() int {
+	minutes := envInt("WINDOW_MINUTES", defaultWindowMinutes)
+	if minutes < 1 {
+		return defaultWindowMinutes
+	}
+	return minutes
+}
+
+// headline returns the opening of the alert message. Alerts queued before
+// tiers were added use the default.
+func (a Alert) headline() string {
+	if a.Headline == "" {
+		return defaultHeadline
+	}
+	return a.Headline
+}
+
+// priceText describes the amount spent on the mints, e.g. " for 12.5 ETH
+// total (avg 0.05 ETH)". It is empty when the price is not known.
+func (a Alert) priceText() string {
+	if a.Price == nil {
+		return ""
+	}
+	if a.Price.Value == 0 {
+		return " for free"
+	}
+	approx := ""
+	if a.Price.Sampled {
+		approx = "~"
+	}
+	return fmt.Sprintf(" for %v%.3f %v total (avg %.4f %v)", approx, a.Price.Value, a.Price.Currency, a.Price.average(), a.Price.Currency)
+}
+
+// minutes returns the time the mint count covers.
+func (a Alert) minutes() int {
+	if a.Minutes == 0 {
+		return defaultWindowMinutes
+	}
+	return a.Minutes
+}
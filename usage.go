@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const usageRetentionDays = 14
+const usageDateFormat = "2006-01-02"
+const eventWeeklyReport = "weekly_report"
+
+// UsageCounts counts the calls made to external APIs so operators can keep
+// inside provider quotas.
+type UsageCounts struct {
+	RPC     int `json:"rpc"`
+	OpenSea int `json:"opensea"`
+	// Posts counts the notification attempts per notifier
+	Posts map[string]int `json:"posts,omitempty"`
+}
+
+func (u *UsageCounts) add(other UsageCounts) {
+	u.RPC += other.RPC
+	u.OpenSea += other.OpenSea
+	for name, count := range other.Posts {
+		if u.Posts == nil {
+			u.Posts = make(map[string]int)
+		}
+		u.Posts[name] += count
+	}
+}
+
+func (u *UsageCounts) countPost(notifier string) {
+	if u == nil {
+		return
+	}
+	if u.Posts == nil {
+		u.Posts = make(map[string]int)
+	}
+	u.Posts[notifier]++
+}
+
+func (u UsageCounts) String() string {
+	s := fmt.Sprintf("RPC: %v OpenSea: %v", u.RPC, u.OpenSea)
+	var names []string
+	for name := range u.Posts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s += fmt.Sprintf(" %v: %v", name, u.Posts[name])
+	}
+	return s
+}
+
+// recordUsage adds the usage for a run to today's totals and drops the days
+// older than usageRetentionDays.
+func (s *Status) recordUsage(usage UsageCounts) UsageCounts {
+	if s.Usage == nil {
+		s.Usage = make(map[string]*UsageCounts)
+	}
+	now := time.Now().UTC()
+	today := now.Format(usageDateFormat)
+	if s.Usage[today] == nil {
+		s.Usage[today] = &UsageCounts{}
+	}
+	s.Usage[today].add(usage)
+
+	oldest := now.AddDate(0, 0, -usageRetentionDays).Format(usageDateFormat)
+	for day := range s.Usage {
+		if day < oldest {
+			delete(s.Usage, day)
+		}
+	}
+	return *s.Usage[today]
+}
+
+// usageReport lists the daily usage and the total for the last days.
+func (s *Status) usageReport(days int) string {
+	var total UsageCounts
+	report := ""
+	now := time.Now().UTC()
+	for i := days - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(usageDateFormat)
+		usage, ok := s.Usage[day]
+		if !ok {
+			continue
+		}
+		report += fmt.Sprintf("%v  %v\n", day, usage)
+		total.add(*usage)
+	}
+	report += fmt.Sprintf("Total  %v", total)
+	return report
+}
+
+// sendWeeklyReport posts the API usage for the last 7 days to the ops channel.
+func sendWeeklyReport() {
+	s3bucket := os.Getenv("S3_BUCKET")
+	s3key := os.Getenv("S3_FILE_KEY")
+	if s3bucket == "" || s3key == "" {
+		slog.Error("S3 Bucket (S3_BUCKET) and S3 Key (S3_FILE_KEY) environment variables must be set")
+		return
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		slog.Error("Unable to create a new session", "error", err)
+		return
+	}
+	store, err := newStateStore(sess, s3bucket, s3key)
+	if err != nil {
+		slog.Error("Unable to open the state store", "error", err)
+		return
+	}
+	status := store.load()
+	report := status.usageReport(7) + "\n" + buildInfo()
+	slog.Info("Weekly API usage", "report", report)
+	sendOpsAlert(getOpsConfig(), "NFT Mint Alert weekly API usage", report)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+// Build metadata, set at build time by build.sh with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+func buildInfo() string {
+	return fmt.Sprintf("nftmintalert %v (commit %v, built %v)", version, commit, buildTime)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	targetWebhook = "webhook"
+	// webhookPrefix names extra webhooks, e.g. webhook_zapier posts to
+	// WEBHOOK_ZAPIER_URL
+	webhookPrefix = "webhook_"
+
+	defaultSignatureHeader = "X-Signature-256"
+)
+
+func init() {
+	registerNotifier(targetWebhook, func() (Notifier, error) {
+		return newWebhookNotifier(targetWebhook)
+	})
+}
+
+// webhookNotifier POSTs the alert event JSON to a URL. With a secret the
+// body is signed with HMAC-SHA256, sent as "sha256=<hex>" in the signature
+// header, so the receiver can check the alert came from us.
+type webhookNotifier struct {
+	name     string
+	url      string
+	secret   string
+	header   string
+	attempts int
+	client   *http.Client
+}
+
+// newWebhookNotifier reads the notifier's <NAME>_URL, <NAME>_SECRET,
+// <NAME>_SIGNATURE_HEADER and <NAME>_ATTEMPTS.
+func newWebhookNotifier(name string) (Notifier, error) {
+	prefix := strings.ToUpper(name)
+	w := &webhookNotifier{
+		name:     name,
+		url:      os.Getenv(prefix + "_URL"),
+		secret:   os.Getenv(prefix + "_SECRET"),
+		header:   envString(prefix+"_SIGNATURE_HEADER", defaultSignatureHeader),
+		attempts: envInt(prefix+"_ATTEMPTS", sendAttempts),
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if w.url == "" {
+		return nil, fmt.Errorf("%v_URL must be set", prefix)
+	}
+	if w.attempts < 1 {
+		w.attempts = 1
+	}
+	return w, nil
+}
+
+func (w *webhookNotifier) Name() string { return w.name }
+
+// sendAttempts overrides the attempts of sendWithRetry.
+func (w *webhookNotifier) sendAttempts() int { return w.attempts }
+
+func (w *webhookNotifier) render(alert Alert) (string, error) {
+	return newAlertEvent(alert).json()
+}
+
+// signature is the hex HMAC-SHA256 of the body with the secret.
+func (w *webhookNotifier) signature(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := w.render(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return fmt.Errorf("%v: request: %w", w.name, err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	// the same key on every attempt lets the receiver drop duplicates
+	req.Header.Add("Idempotency-Key", alert.Key)
+	if w.secret != "" {
+		req.Header.Add(w.header, "sha256="+w.signature([]byte(body)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// the URL can hold a token, keep it out of the error
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("%v response: %w", w.name, err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%v response read: %w", w.name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v status %v: %v", w.name, resp.StatusCode, strings.TrimSpace(string(respBytes)))
+	}
+	return nil
+}